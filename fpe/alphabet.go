@@ -0,0 +1,244 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+// Alphabet maps a set of symbols to numerals. The i-th symbol of the alphabet
+// is represented by the numeral i, and the radix is the number of symbols. The symbols
+// are runes, so they may be any Unicode code point, including the ones above the BMP.
+type Alphabet struct {
+	symbols []rune
+	index   map[rune]uint32
+}
+
+// NewAlphabet returns an Alphabet made of the runes of symbols, in order. The radix
+// of the alphabet is the rune count of symbols. It may exceed 2^16, in which case the
+// strings must be converted with ToNumerals32 and ToString32. It returns an error if
+// symbols has less than 2 runes, or if a rune appears more than once, as the symbols
+// would not map one-to-one to the numerals.
+func NewAlphabet(symbols string) (*Alphabet, error) {
+	var runes = []rune(symbols)
+	if len(runes) < minRadixFF1 {
+		return nil, fmt.Errorf("fpe: alphabet must have at least %d symbols", minRadixFF1)
+	}
+
+	var index = make(map[rune]uint32, len(runes))
+	for i, r := range runes {
+		if _, ok := index[r]; ok {
+			return nil, fmt.Errorf("fpe: symbol %q appears more than once in the alphabet", r)
+		}
+		index[r] = uint32(i)
+	}
+
+	return &Alphabet{
+		symbols: runes,
+		index:   index,
+	}, nil
+}
+
+// checkAlphabet takes an alphabet and the FF1, FF3 or FF3-1 BlockModes of a cipher. It
+// returns an error if the alphabet is nil, or if the radix of a mode is not the number of
+// symbols of the alphabet, in which case the ciphertexts would not be meaningful.
+func checkAlphabet(alphabet *Alphabet, modes ...cipher.BlockMode) error {
+	if alphabet == nil {
+		return fmt.Errorf("fpe: alphabet must not be nil")
+	}
+	for _, mode := range modes {
+		if radix := mode.(radixGetter).GetRadix(); radix != alphabet.Radix() {
+			return &ParamError{FieldRadix, int64(radix), int64(alphabet.Radix()), int64(alphabet.Radix()), fmt.Sprintf("radix %d does not match the %d symbols of the alphabet", radix, alphabet.Radix())}
+		}
+	}
+	return nil
+}
+
+// mustNewAlphabet is NewAlphabet for the package's own alphabets, it panics if symbols is
+// not a valid alphabet.
+func mustNewAlphabet(symbols string) *Alphabet {
+	var a, err = NewAlphabet(symbols)
+	if err != nil {
+		panic(fmt.Sprintf("mustNewAlphabet: %v.", err))
+	}
+	return a
+}
+
+// Radix returns the number of symbols in the alphabet.
+func (a *Alphabet) Radix() uint32 {
+	return uint32(len(a.symbols))
+}
+
+// ToNumerals takes a string s and returns the numeral string that represents it in
+// the alphabet. It returns an error if s contains a symbol that is not in the alphabet,
+// or whose numeral does not fit in 16 bits.
+func (a *Alphabet) ToNumerals(s string) ([]uint16, error) {
+	var out = make([]uint16, 0, utf8.RuneCountInString(s))
+
+	for i, r := range s {
+		var numeral, ok = a.index[r]
+		if !ok {
+			return nil, fmt.Errorf("fpe: symbol %q at byte %d is not in the alphabet", r, i)
+		}
+		if numeral > math.MaxUint16 {
+			return nil, fmt.Errorf("fpe: numeral of symbol %q at byte %d does not fit in 16 bits", r, i)
+		}
+		out = append(out, uint16(numeral))
+	}
+
+	return out, nil
+}
+
+// ToNumerals32 is ToNumerals for alphabets of any radix, it returns a NumeralString32.
+func (a *Alphabet) ToNumerals32(s string) (NumeralString32, error) {
+	var out = make(NumeralString32, 0, utf8.RuneCountInString(s))
+
+	for i, r := range s {
+		var numeral, ok = a.index[r]
+		if !ok {
+			return nil, fmt.Errorf("fpe: symbol %q at byte %d is not in the alphabet", r, i)
+		}
+		out = append(out, numeral)
+	}
+
+	return out, nil
+}
+
+// ToString takes a numeral string n and returns the string of the corresponding symbols
+// of the alphabet. It returns an error if a numeral is not smaller than the radix.
+func (a *Alphabet) ToString(n []uint16) (string, error) {
+	var out = make([]rune, len(n))
+
+	for i, numeral := range n {
+		if uint32(numeral) >= a.Radix() {
+			return "", fmt.Errorf("fpe: numeral %d (value %d) exceeds radix %d", i, numeral, a.Radix())
+		}
+		out[i] = a.symbols[numeral]
+	}
+
+	return string(out), nil
+}
+
+// ToString32 is ToString for alphabets of any radix, it takes a NumeralString32.
+func (a *Alphabet) ToString32(n NumeralString32) (string, error) {
+	var out = make([]rune, len(n))
+
+	for i, numeral := range n {
+		if numeral >= a.Radix() {
+			return "", fmt.Errorf("fpe: numeral %d (value %d) exceeds radix %d", i, numeral, a.Radix())
+		}
+		out[i] = a.symbols[numeral]
+	}
+
+	return string(out), nil
+}
+
+// Transcode takes a numeral string src in the alphabet from, and returns the numeral string
+// that represents the same symbols in the alphabet to. It does not encrypt, it only changes
+// the ordering of the symbols. It returns an error if the alphabets do not have the same
+// radix, if a numeral is not smaller than the radix, or if a symbol is not in to.
+func Transcode(src []uint16, from, to *Alphabet) ([]uint16, error) {
+	if from.Radix() != to.Radix() {
+		return nil, fmt.Errorf("fpe: alphabets have different radixes %d and %d", from.Radix(), to.Radix())
+	}
+
+	var out = make([]uint16, len(src))
+	for i, numeral := range src {
+		if uint32(numeral) >= from.Radix() {
+			return nil, fmt.Errorf("fpe: numeral %d (value %d) exceeds radix %d", i, numeral, from.Radix())
+		}
+		var r = from.symbols[numeral]
+		var toNumeral, ok = to.index[r]
+		if !ok {
+			return nil, fmt.Errorf("fpe: symbol %q of numeral %d is not in the target alphabet", r, i)
+		}
+		if toNumeral > math.MaxUint16 {
+			return nil, fmt.Errorf("fpe: numeral of symbol %q of numeral %d does not fit in 16 bits", r, i)
+		}
+		out[i] = uint16(toNumeral)
+	}
+
+	return out, nil
+}
+
+// The symbols of the well-known alphabets returned by Alphabets, in their canonical order.
+var alphabetPresets = map[string]string{
+	"decimal":      "0123456789",
+	"hex":          "0123456789abcdef",
+	"alphanumeric": "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"base32":       "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567",
+	"base36":       "0123456789abcdefghijklmnopqrstuvwxyz",
+	"base62":       "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+}
+
+// Alphabets returns the well-known alphabet with the given name:
+//   - "decimal": the digits 0-9,
+//   - "hex": the digits and the lowercase letters a-f,
+//   - "alphanumeric": the digits and the uppercase letters A-Z,
+//   - "base32": the RFC 4648 base32 alphabet, A-Z then 2-7,
+//   - "base36": the digits and the lowercase letters a-z,
+//   - "base62": the digits, the uppercase letters A-Z and the lowercase letters a-z.
+//
+// It returns an error if the name is unknown. Using the presets ensures that all services
+// order the symbols in the same way, which is required to decrypt each other's tokens.
+func Alphabets(name string) (*Alphabet, error) {
+	var symbols, ok = alphabetPresets[name]
+	if !ok {
+		return nil, fmt.Errorf("fpe: unknown alphabet %q", name)
+	}
+	return NewAlphabet(symbols)
+}
+
+// The digits of the base-N strings, in the conventional order.
+const baseNDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// NumeralStringToBaseN takes a numeral string x and an integer radix in [2..36]. It returns
+// x as a base-N string, where the numerals 0 to 35 are the digits 0-9 then the uppercase
+// letters A-Z, to interoperate with the tools that use this representation. It is the
+// representation of strconv.FormatInt in uppercase.
+// It returns an error if the radix is not in [2..36], or if a numeral is not in [0..radix[.
+func NumeralStringToBaseN(x []uint16, radix uint32) (string, error) {
+	if radix < minRadixFF1 || radix > uint32(len(baseNDigits)) {
+		return "", fmt.Errorf("fpe: radix must be in [%d..%d] for a base-N string", minRadixFF1, len(baseNDigits))
+	}
+
+	var out = make([]byte, len(x))
+	for i, numeral := range x {
+		if uint32(numeral) >= radix {
+			return "", fmt.Errorf("fpe: numeral %d (value %d) exceeds radix %d", i, numeral, radix)
+		}
+		out[i] = baseNDigits[numeral]
+	}
+
+	return string(out), nil
+}
+
+// BaseNToNumeralString takes a base-N string s and an integer radix in [2..36]. It returns
+// the numeral string it represents, see NumeralStringToBaseN. The letters may be uppercase
+// or lowercase, e.g. for the output of strconv.FormatInt. It returns an error if the radix is not in [2..36], or if a character of s
+// is not a digit of the radix.
+func BaseNToNumeralString(s string, radix uint32) ([]uint16, error) {
+	if radix < minRadixFF1 || radix > uint32(len(baseNDigits)) {
+		return nil, fmt.Errorf("fpe: radix must be in [%d..%d] for a base-N string", minRadixFF1, len(baseNDigits))
+	}
+
+	var out = make([]uint16, len(s))
+	for i := 0; i < len(s); i++ {
+		var c, numeral = s[i], radix
+		switch {
+		case '0' <= c && c <= '9':
+			numeral = uint32(c - '0')
+		case 'a' <= c && c <= 'z':
+			numeral = uint32(c-'a') + 10
+		case 'A' <= c && c <= 'Z':
+			numeral = uint32(c-'A') + 10
+		}
+		if numeral >= radix {
+			return nil, fmt.Errorf("fpe: character %q at byte %d is not a digit in radix %d", c, i, radix)
+		}
+		out[i] = uint16(numeral)
+	}
+
+	return out, nil
+}
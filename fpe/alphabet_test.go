@@ -0,0 +1,303 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestNewAlphabet(t *testing.T) {
+	var decimal, err = NewAlphabet("0123456789")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(10), decimal.Radix())
+
+	var upper *Alphabet
+	upper, err = NewAlphabet("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(26), upper.Radix())
+
+	// The radix is the rune count, not the byte count.
+	var greek *Alphabet
+	greek, err = NewAlphabet("αβγδε")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(5), greek.Radix())
+}
+
+func TestNewAlphabetErrors(t *testing.T) {
+	// Less than 2 symbols, duplicated symbols
+	for _, symbols := range []string{"", "0", "0011", "0123456789012", "αβγα", "😀😁😀"} {
+		var alphabet, err = NewAlphabet(symbols)
+		assert.NotNil(t, err, symbols)
+		assert.Nil(t, alphabet, symbols)
+	}
+
+	assert.Panics(t, func() { mustNewAlphabet("00") })
+}
+
+func TestAlphabetToNumerals(t *testing.T) {
+	var alphabet = mustNewAlphabet("0123456789")
+
+	var numerals, err = alphabet.ToNumerals("0123456789")
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, numerals)
+
+	// Symbol not in the alphabet
+	numerals, err = alphabet.ToNumerals("0123A")
+	assert.NotNil(t, err)
+	assert.Nil(t, numerals)
+
+	// Empty string
+	numerals, err = alphabet.ToNumerals("")
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{}, numerals)
+}
+
+func TestAlphabetToString(t *testing.T) {
+	var alphabet = mustNewAlphabet("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+
+	var s, err = alphabet.ToString([]uint16{7, 4, 11, 11, 14})
+	assert.Nil(t, err)
+	assert.Equal(t, "HELLO", s)
+
+	// Numeral greater than the radix
+	_, err = alphabet.ToString([]uint16{7, 26})
+	assert.NotNil(t, err)
+}
+
+func TestAlphabetConversions(t *testing.T) {
+	var alphabet = mustNewAlphabet("αβγδεζηθικλμνξοπρστυφχψω")
+	var radix = alphabet.Radix()
+
+	for i := 0; i < nbrTests; i++ {
+		var x = generateRandomNumeralString(radix, i%50)
+
+		var s, err = alphabet.ToString(x)
+		assert.Nil(t, err)
+		var result []uint16
+		result, err = alphabet.ToNumerals(s)
+		assert.Nil(t, err)
+
+		assert.Equal(t, x, result)
+	}
+}
+
+// The alphabet output can be fed directly to the FF1 block modes.
+func TestAlphabetFF1(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, blockSizeFF1)
+	var alphabet = mustNewAlphabet("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+
+	var encrypter, err = getFF1Encrypter(key, tweak, alphabet.Radix())
+	assert.Nil(t, err)
+	var decrypter cipher.BlockMode
+	decrypter, err = getFF1Decrypter(key, tweak, alphabet.Radix())
+	assert.Nil(t, err)
+
+	var plaintext = "FORMATPRESERVING"
+	var numerals []uint16
+	numerals, err = alphabet.ToNumerals(plaintext)
+	assert.Nil(t, err)
+
+	var buf = NumeralStringToBytes(numerals)
+	encrypter.CryptBlocks(buf, buf)
+	var ciphertext string
+	ciphertext, err = alphabet.ToString(BytesToNumeralString(buf))
+	assert.Nil(t, err)
+	assert.Equal(t, len(plaintext), len(ciphertext))
+
+	numerals, err = alphabet.ToNumerals(ciphertext)
+	assert.Nil(t, err)
+	buf = NumeralStringToBytes(numerals)
+	decrypter.CryptBlocks(buf, buf)
+	var decrypted string
+	decrypted, err = alphabet.ToString(BytesToNumeralString(buf))
+	assert.Nil(t, err)
+
+	assert.Equal(t, plaintext, decrypted)
+}
+
+func TestTranscode(t *testing.T) {
+	var from = mustNewAlphabet("0123456789")
+	var to = mustNewAlphabet("9876543210")
+
+	var out, err = Transcode([]uint16{0, 1, 2, 9}, from, to)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{9, 8, 7, 0}, out)
+
+	// The symbols are preserved.
+	var numerals []uint16
+	numerals, err = from.ToNumerals("4111111111111111")
+	assert.Nil(t, err)
+	out, err = Transcode(numerals, from, to)
+	assert.Nil(t, err)
+	var s string
+	s, err = to.ToString(out)
+	assert.Nil(t, err)
+	assert.Equal(t, "4111111111111111", s)
+
+	// Different radixes
+	_, err = Transcode([]uint16{0}, from, mustNewAlphabet("01"))
+	assert.NotNil(t, err)
+	// Numeral not smaller than the radix
+	_, err = Transcode([]uint16{10}, from, to)
+	assert.NotNil(t, err)
+	// Symbol not in the target alphabet
+	_, err = Transcode([]uint16{0}, from, mustNewAlphabet("abcdefghij"))
+	assert.NotNil(t, err)
+}
+
+func TestAlphabets(t *testing.T) {
+	var expected = []struct {
+		name   string
+		radix  uint32
+		sample string
+	}{
+		{"decimal", 10, "4111111111111111"},
+		{"hex", 16, "deadbeef0123"},
+		{"alphanumeric", 36, "AZ09XY"},
+		{"base32", 32, "MZXW6YTBOI"},
+		{"base36", 36, "az09xy"},
+		{"base62", 62, "Az09xY"},
+	}
+
+	for _, test := range expected {
+		var alphabet, err = Alphabets(test.name)
+		assert.Nil(t, err)
+		assert.Equal(t, test.radix, alphabet.Radix())
+
+		var numerals []uint16
+		numerals, err = alphabet.ToNumerals(test.sample)
+		assert.Nil(t, err)
+		var s string
+		s, err = alphabet.ToString(numerals)
+		assert.Nil(t, err)
+		assert.Equal(t, test.sample, s)
+	}
+
+	// Canonical ordering
+	var hex, _ = Alphabets("hex")
+	var numerals, _ = hex.ToNumerals("09af")
+	assert.Equal(t, []uint16{0, 9, 10, 15}, numerals)
+
+	var _, err = Alphabets("base64")
+	assert.NotNil(t, err)
+}
+
+func TestAlphabetAboveBMP(t *testing.T) {
+	// Emoji are above the BMP, they are 4 bytes in UTF-8.
+	var emoji = mustNewAlphabet("😀😁😂🤣😃😄😅😆😉😊")
+	assert.Equal(t, uint32(10), emoji.Radix())
+
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var c, err = NewFF1Cipher(key, tweak, emoji)
+	assert.Nil(t, err)
+
+	var plaintext = "😀😂😅😉😊🤣😃😄"
+	var ciphertext string
+	ciphertext, err = c.EncryptString(plaintext)
+	assert.Nil(t, err)
+	assert.True(t, utf8.ValidString(ciphertext))
+	assert.Equal(t, utf8.RuneCountInString(plaintext), utf8.RuneCountInString(ciphertext))
+
+	var decrypted string
+	decrypted, err = c.DecryptString(ciphertext)
+	assert.Nil(t, err)
+	assert.Equal(t, plaintext, decrypted)
+}
+
+func TestAlphabetRadixAbove16Bits(t *testing.T) {
+	var alphabet = generateAlphabet(70000)
+	assert.Equal(t, uint32(70000), alphabet.Radix())
+
+	var runes = alphabet.symbols
+	var s = string([]rune{runes[0], runes[65535], runes[65536], runes[69999]})
+	var numerals, err = alphabet.ToNumerals32(s)
+	assert.Nil(t, err)
+	assert.Equal(t, NumeralString32{0, 65535, 65536, 69999}, numerals)
+	var result string
+	result, err = alphabet.ToString32(numerals)
+	assert.Nil(t, err)
+	assert.Equal(t, s, result)
+
+	_, err = alphabet.ToString32(NumeralString32{70000})
+	assert.NotNil(t, err)
+
+	// The 16-bit numerals only cover the first 2^16 symbols.
+	var numerals16 []uint16
+	numerals16, err = alphabet.ToNumerals(string(runes[:3]))
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{0, 1, 2}, numerals16)
+	_, err = alphabet.ToNumerals(s)
+	assert.NotNil(t, err)
+}
+
+// generateAlphabet returns an alphabet of the given radix, made of the code points from
+// U+10000, which are all valid runes.
+func generateAlphabet(radix int) *Alphabet {
+	var runes = make([]rune, radix)
+	for i := range runes {
+		runes[i] = rune(0x10000 + i)
+	}
+	return mustNewAlphabet(string(runes))
+}
+
+func TestBaseN(t *testing.T) {
+	for radix := uint32(2); radix <= 36; radix++ {
+		var x = generateRandomNumeralString(radix, 50)
+		var s, err = NumeralStringToBaseN(x, radix)
+		assert.Nil(t, err)
+		assert.Len(t, s, len(x))
+
+		var result []uint16
+		result, err = BaseNToNumeralString(s, radix)
+		assert.Nil(t, err)
+		assert.Equal(t, x, result, fmt.Sprintf("radix %d", radix))
+
+		// The representation is the one of strconv, in uppercase.
+		var expected = strconv.FormatUint(1234567890, int(radix))
+		result, err = BaseNToNumeralString(expected, radix)
+		assert.Nil(t, err)
+		s, err = NumeralStringToBaseN(result, radix)
+		assert.Nil(t, err)
+		assert.Equal(t, strings.ToUpper(expected), s)
+	}
+
+	// The ordering is the one of the base36 preset, the letters of both cases are accepted,
+	// and the uppercase ones are returned.
+	var base36, _ = Alphabets("base36")
+	var x, err = BaseNToNumeralString("0Az9zA", 36)
+	assert.Nil(t, err)
+	var s, _ = base36.ToString(x)
+	assert.Equal(t, "0az9za", s)
+	s, err = NumeralStringToBaseN(x, 36)
+	assert.Nil(t, err)
+	assert.Equal(t, "0AZ9ZA", s)
+	s, err = NumeralStringToBaseN([]uint16{15, 14, 13, 12, 11, 10}, 16)
+	assert.Nil(t, err)
+	assert.Equal(t, "FEDCBA", s)
+
+	// Empty strings.
+	s, err = NumeralStringToBaseN([]uint16{}, 16)
+	assert.Nil(t, err)
+	assert.Equal(t, "", s)
+	x, err = BaseNToNumeralString("", 16)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{}, x)
+
+	// Invalid radixes, numerals and characters.
+	for _, radix := range []uint32{0, 1, 37, maxRadixFF1} {
+		_, err = NumeralStringToBaseN([]uint16{0, 1}, radix)
+		assert.NotNil(t, err)
+		_, err = BaseNToNumeralString("01", radix)
+		assert.NotNil(t, err)
+	}
+	_, err = NumeralStringToBaseN([]uint16{1, 16}, 16)
+	assert.NotNil(t, err)
+	for _, s := range []string{"0g", "0G", "0-", "0 ", "0é"} {
+		_, err = BaseNToNumeralString(s, 16)
+		assert.NotNil(t, err)
+	}
+}
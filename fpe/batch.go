@@ -0,0 +1,137 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// FF1EncryptBatch encrypts each numeral string of inputs with FF1, using the given key,
+// tweak and radix, as FF1Encrypt does. The work is spread over workers goroutines, which
+// share one FF1 encrypter, and the results are returned in the order of the inputs. If
+// workers <= 0, GOMAXPROCS goroutines are used. If an input is not valid, the batch stops
+// and a *BatchError holding the index and the error of the first invalid input is returned.
+func FF1EncryptBatch(key, tweak []byte, radix uint32, inputs [][]uint16, workers int) ([][]uint16, error) {
+	return ff1CryptBatch(key, tweak, radix, inputs, workers, func(enc, _ cipher.BlockMode) cipher.BlockMode { return enc })
+}
+
+// FF1DecryptBatch decrypts each numeral string of inputs with FF1, as FF1EncryptBatch
+// encrypts them. The key, tweak and radix must match the ones used to encrypt the data.
+func FF1DecryptBatch(key, tweak []byte, radix uint32, inputs [][]uint16, workers int) ([][]uint16, error) {
+	return ff1CryptBatch(key, tweak, radix, inputs, workers, func(_, dec cipher.BlockMode) cipher.BlockMode { return dec })
+}
+
+// FF1DecryptEach decrypts each numeral string of inputs with FF1, as FF1DecryptBatch does,
+// but an invalid input does not abort the batch: the returned errors are in the order of
+// the inputs, and errs[i] is nil if inputs[i] was decrypted into outputs[i]. If the key,
+// tweak or radix are not valid, all the errors are set.
+func FF1DecryptEach(key, tweak []byte, radix uint32, inputs [][]uint16, workers int) ([][]uint16, []error) {
+	return ff1CryptEach(key, tweak, radix, inputs, workers, func(_, dec cipher.BlockMode) cipher.BlockMode { return dec })
+}
+
+// BatchError is returned by FF1EncryptBatch and FF1DecryptBatch when an input is not valid.
+// Index is the index of the first invalid input, and Err the error it caused, usually a
+// *ParamError, which errors.As finds through BatchError.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("fpe: input %d: %s", e.Index, strings.TrimPrefix(e.Err.Error(), "fpe: "))
+}
+
+// Unwrap returns the error of the invalid input.
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+func ff1CryptBatch(key, tweak []byte, radix uint32, inputs [][]uint16, workers int, selectMode func(enc, dec cipher.BlockMode) cipher.BlockMode) ([][]uint16, error) {
+	var mode, err = newFF1BatchMode(key, tweak, radix, selectMode)
+	if err != nil {
+		return nil, err
+	}
+
+	// The inputs after the first invalid one are not processed, but all the inputs before it
+	// were handed to the workers earlier, so the first error in errs is the one of the first
+	// invalid input.
+	var outputs, errs = ff1CryptEachWithMode(mode, inputs, workers, true)
+	for i, err := range errs {
+		if err != nil {
+			return nil, &BatchError{Index: i, Err: err}
+		}
+	}
+	return outputs, nil
+}
+
+// ff1CryptEach processes the inputs with the BlockMode chosen by selectMode, over workers
+// goroutines. It returns the outputs and the errors in the order of the inputs.
+func ff1CryptEach(key, tweak []byte, radix uint32, inputs [][]uint16, workers int, selectMode func(enc, dec cipher.BlockMode) cipher.BlockMode) ([][]uint16, []error) {
+	var mode, err = newFF1BatchMode(key, tweak, radix, selectMode)
+	if err != nil {
+		var outputs, errs = make([][]uint16, len(inputs)), make([]error, len(inputs))
+		for i := range errs {
+			errs[i] = err
+		}
+		return outputs, errs
+	}
+	return ff1CryptEachWithMode(mode, inputs, workers, false)
+}
+
+// newFF1BatchMode checks the parameters and returns the BlockMode chosen by selectMode, once
+// for the whole batch. The FF1 BlockModes are safe for concurrent use, so the workers share it.
+func newFF1BatchMode(key, tweak []byte, radix uint32, selectMode func(enc, dec cipher.BlockMode) cipher.BlockMode) (cipher.BlockMode, error) {
+	var enc, dec, err = newFF1BlockModes(key, tweak, radix)
+	if err != nil {
+		return nil, err
+	}
+	return selectMode(enc, dec), nil
+}
+
+// ff1CryptEachWithMode processes the inputs with mode over workers goroutines. It returns the
+// outputs and the errors in the order of the inputs. If stopOnError is true, the inputs are
+// no longer handed to the workers once one of them failed, their outputs and errors are nil.
+func ff1CryptEachWithMode(mode cipher.BlockMode, inputs [][]uint16, workers int, stopOnError bool) ([][]uint16, []error) {
+	var outputs = make([][]uint16, len(inputs))
+	var errs = make([]error, len(inputs))
+
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(inputs) {
+		workers = len(inputs)
+	}
+
+	var indexes = make(chan int)
+	var failed = make(chan struct{})
+	var failOnce sync.Once
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				outputs[i], errs[i] = cryptModeNumerals(mode, inputs[i])
+				if errs[i] != nil && stopOnError {
+					failOnce.Do(func() { close(failed) })
+				}
+			}
+		}()
+	}
+
+send:
+	for i := range inputs {
+		select {
+		case indexes <- i:
+		case <-failed:
+			break send
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return outputs, errs
+}
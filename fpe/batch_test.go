@@ -0,0 +1,167 @@
+package fpe
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestFF1Batch(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var radix uint32 = 10
+
+	var inputs = make([][]uint16, 100)
+	for i := range inputs {
+		inputs[i] = generateRandomNumeralString(radix, 8+i%10)
+	}
+
+	for _, workers := range []int{-1, 0, 1, 3, 200} {
+		var outputs, err = FF1EncryptBatch(key, tweak, radix, inputs, workers)
+		assert.Nil(t, err)
+		assert.Len(t, outputs, len(inputs))
+
+		for i := range inputs {
+			var expected, err = FF1Encrypt(key, tweak, radix, inputs[i])
+			assert.Nil(t, err)
+			assert.Equal(t, expected, outputs[i])
+		}
+
+		var decrypted [][]uint16
+		decrypted, err = FF1DecryptBatch(key, tweak, radix, outputs, workers)
+		assert.Nil(t, err)
+		assert.Equal(t, inputs, decrypted)
+	}
+
+	// Empty batch
+	var outputs, err = FF1EncryptBatch(key, tweak, radix, [][]uint16{}, 4)
+	assert.Nil(t, err)
+	assert.Empty(t, outputs)
+}
+
+func TestFF1BatchErrors(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var radix uint32 = 10
+
+	var inputs = make([][]uint16, 10)
+	for i := range inputs {
+		inputs[i] = generateRandomNumeralString(radix, 10)
+	}
+	inputs[7] = []uint16{1, 2, 3, 10}
+	inputs[4] = []uint16{1}
+
+	// The error of the first invalid input is returned, with its index and its cause.
+	for _, workers := range []int{1, 4} {
+		var outputs, err = FF1EncryptBatch(key, tweak, radix, inputs, workers)
+		assert.Nil(t, outputs)
+		assert.NotNil(t, err)
+		assert.Equal(t, "fpe: input 4: "+strings.TrimPrefix(validateFF1InputLen(radix, 1).Error(), "fpe: "), err.Error())
+
+		var batchErr *BatchError
+		assert.True(t, errors.As(err, &batchErr))
+		assert.Equal(t, 4, batchErr.Index)
+		var paramErr *ParamError
+		assert.True(t, errors.As(err, &paramErr))
+		assert.Equal(t, FieldInputLen, paramErr.Field)
+	}
+	var outputs, err = FF1DecryptBatch(key, tweak, radix, inputs[5:], 2)
+	assert.Nil(t, outputs)
+	var batchErr *BatchError
+	assert.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, 2, batchErr.Index)
+
+	// Invalid key
+	outputs, err = FF1EncryptBatch(key[:10], tweak, radix, inputs, 4)
+	assert.Nil(t, outputs)
+	assert.NotNil(t, err)
+	assert.False(t, errors.As(err, &batchErr))
+}
+
+// The inputs after an invalid one are not handed to the workers.
+func TestFF1BatchStopsOnError(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var encrypter, _, err = newFF1BlockModes(key, tweak, 10)
+	assert.Nil(t, err)
+
+	var inputs = make([][]uint16, 1000)
+	for i := range inputs {
+		inputs[i] = generateRandomNumeralString(10, 10)
+	}
+	inputs[0] = []uint16{1}
+
+	var outputs, errs = ff1CryptEachWithMode(encrypter, inputs, 1, true)
+	assert.NotNil(t, errs[0])
+	var processed int
+	for i := range inputs {
+		if outputs[i] != nil {
+			processed++
+		}
+	}
+	assert.True(t, processed < len(inputs)-1)
+
+	// Without stopOnError, all the inputs are processed.
+	outputs, errs = ff1CryptEachWithMode(encrypter, inputs, 1, false)
+	for i := 1; i < len(inputs); i++ {
+		assert.Nil(t, errs[i])
+		assert.NotNil(t, outputs[i])
+	}
+}
+
+// Run with -race to check the workers do not share state.
+func TestFF1DecryptEach(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var radix uint32 = 10
+
+	var inputs = make([][]uint16, 100)
+	for i := range inputs {
+		inputs[i] = generateRandomNumeralString(radix, 8+i%10)
+	}
+	var ciphertexts, err = FF1EncryptBatch(key, tweak, radix, inputs, 4)
+	assert.Nil(t, err)
+
+	// Malformed records
+	var invalid = map[int][]uint16{3: {1, 2, 3, 10}, 42: {1}, 99: {}}
+	for i, x := range invalid {
+		ciphertexts[i] = x
+	}
+
+	for _, workers := range []int{0, 1, 8} {
+		var outputs, errs = FF1DecryptEach(key, tweak, radix, ciphertexts, workers)
+		assert.Len(t, outputs, len(inputs))
+		assert.Len(t, errs, len(inputs))
+
+		for i := range inputs {
+			if _, ok := invalid[i]; ok {
+				assert.NotNil(t, errs[i], i)
+				assert.Nil(t, outputs[i], i)
+			} else {
+				assert.Nil(t, errs[i], i)
+				assert.Equal(t, inputs[i], outputs[i], i)
+			}
+		}
+	}
+
+	// Invalid key
+	var outputs, errs = FF1DecryptEach(key[:10], tweak, radix, ciphertexts, 4)
+	assert.Len(t, outputs, len(inputs))
+	for i := range inputs {
+		assert.Nil(t, outputs[i])
+		assert.NotNil(t, errs[i])
+	}
+}
+
+// Run with -cpu 1,2,4,8 to see how the batch scales with GOMAXPROCS.
+func BenchmarkFF1EncryptBatch(b *testing.B) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var radix uint32 = 10
+
+	var inputs = make([][]uint16, 1000)
+	for i := range inputs {
+		inputs[i] = generateRandomNumeralString(radix, 16)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		FF1EncryptBatch(key, tweak, radix, inputs, 0)
+	}
+}
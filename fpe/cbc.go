@@ -0,0 +1,53 @@
+package fpe
+
+import (
+	"crypto/cipher"
+)
+
+type cbc struct {
+	block cipher.Block
+	iv    []byte
+}
+
+// NewCBCWithSetIV returns a BlockMode which encrypts in CBC mode, using the given Block
+// and iv. The length of iv must be the block size. The returned BlockMode has a SetIV
+// function, as required by NewFF1Encrypter and NewFF1Decrypter.
+func NewCBCWithSetIV(block cipher.Block, iv []byte) cipher.BlockMode {
+	if len(iv) != block.BlockSize() {
+		panic("NewCBCWithSetIV: IV length must equal block size.")
+	}
+	return &cbc{
+		block: block,
+		iv:    dup(iv),
+	}
+}
+
+func (x *cbc) BlockSize() int {
+	return x.block.BlockSize()
+}
+
+func (x *cbc) CryptBlocks(dst, src []byte) {
+	var blockSize = x.block.BlockSize()
+
+	if len(src)%blockSize != 0 {
+		panic("CBC/CryptBlocks: input not full blocks.")
+	}
+	if len(dst) < len(src) {
+		panic("CBC/CryptBlocks: output smaller than input.")
+	}
+
+	for i := 0; i < len(src); i += blockSize {
+		for j := 0; j < blockSize; j++ {
+			x.iv[j] ^= src[i+j]
+		}
+		x.block.Encrypt(x.iv, x.iv)
+		copy(dst[i:i+blockSize], x.iv)
+	}
+}
+
+func (x *cbc) SetIV(iv []byte) {
+	if len(iv) != len(x.iv) {
+		panic("CBC/SetIV: IV length must equal block size.")
+	}
+	copy(x.iv, iv)
+}
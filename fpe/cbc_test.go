@@ -0,0 +1,59 @@
+package fpe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestCBCWithSetIV(t *testing.T) {
+	var key, _, iv []byte = getRandomParameters(ff1DefaultKeySize, 0, blockSizeFF1)
+	var aesBlock, err = aes.NewCipher(key)
+	assert.Nil(t, err)
+
+	var cbcMode = NewCBCWithSetIV(aesBlock, iv)
+	var _, ok = cbcMode.(cbcWithSetIV)
+	assert.True(t, ok)
+	assert.Equal(t, blockSizeFF1, cbcMode.BlockSize())
+
+	// The output must be the one of the standard library CBC encrypter.
+	for i := 0; i < 10; i++ {
+		var src = make([]byte, blockSizeFF1*(i+1))
+		rand.Read(src)
+
+		var expected = make([]byte, len(src))
+		cipher.NewCBCEncrypter(aesBlock, iv).CryptBlocks(expected, src)
+
+		var dst = make([]byte, len(src))
+		cbcMode.(cbcWithSetIV).SetIV(iv)
+		cbcMode.CryptBlocks(dst, src)
+		assert.Equal(t, expected, dst)
+	}
+
+	// Invalid IV and input lengths
+	assert.Panics(t, func() { NewCBCWithSetIV(aesBlock, iv[:8]) })
+	assert.Panics(t, func() { cbcMode.(cbcWithSetIV).SetIV(iv[:8]) })
+	assert.Panics(t, func() { cbcMode.CryptBlocks(make([]byte, 20), make([]byte, 20)) })
+	assert.Panics(t, func() { cbcMode.CryptBlocks(make([]byte, 16), make([]byte, 32)) })
+}
+
+// FF1 can be built end-to-end with exported symbols only.
+func TestFF1WithCBCWithSetIV(t *testing.T) {
+	for _, test := range ff1Tests {
+		var aesBlock, err = aes.NewCipher(test.key)
+		assert.Nil(t, err)
+		var cbcMode = NewCBCWithSetIV(aesBlock, make([]byte, aesBlock.BlockSize()))
+
+		var encrypter = NewFF1Encrypter(aesBlock, cbcMode, test.tweak, test.radix)
+		var decrypter = NewFF1Decrypter(aesBlock, cbcMode, test.tweak, test.radix)
+
+		var result = make([]byte, 2*len(test.in))
+		encrypter.CryptBlocks(result, NumeralString(test.in).Bytes())
+		assert.Equal(t, NumeralString(test.out), NumeralStringFromBytes(result))
+
+		decrypter.CryptBlocks(result, NumeralString(test.out).Bytes())
+		assert.Equal(t, NumeralString(test.in), NumeralStringFromBytes(result))
+	}
+}
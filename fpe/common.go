@@ -4,23 +4,94 @@
 package fpe
 
 import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/subtle"
 	"encoding/binary"
+	"fmt"
 	"math"
 	"math/big"
+	"math/bits"
+	"sync"
 )
 
+// FPE is the interface of the FF1, FF3 and FF3-1 encrypters and decrypters returned by the
+// constructors of this package, so that the mode can be chosen at runtime. The numeral
+// strings given to CryptBlocks are represented as byte strings, see NumeralStringToBytes.
+type FPE interface {
+	cipher.BlockMode
+	SetTweak(tweak []byte)
+	SetRadix(radix uint32)
+}
+
+// TweakCrypter is implemented by the FF1, FF3 and FF3-1 encrypters and decrypters returned
+// by the constructors of this package. CryptBlocksWithTweak is CryptBlocks with a tweak for
+// this call only, so that one BlockMode can serve several tweaks concurrently, where SetTweak
+// would modify the tweak shared by all the calls.
+type TweakCrypter interface {
+	cipher.BlockMode
+	CryptBlocksWithTweak(dst, src, tweak []byte)
+}
+
+// bigIntPool holds scratch big.Int values for the Feistel rounds arithmetic, to reduce
+// the allocations when radix^m does not fit in a uint64. sync.Pool is safe for concurrent
+// use, and a value is only used by one goroutine between acquireBigInt and releaseBigInt.
+var bigIntPool = sync.Pool{
+	New: func() interface{} {
+		return new(big.Int)
+	},
+}
+
+// acquireBigInt returns a scratch big.Int from the pool, set to 0.
+func acquireBigInt() *big.Int {
+	return bigIntPool.Get().(*big.Int).SetInt64(0)
+}
+
+// releaseBigInt puts the scratch big.Int values back in the pool. They must not be used afterwards.
+func releaseBigInt(xs ...*big.Int) {
+	for _, x := range xs {
+		bigIntPool.Put(x)
+	}
+}
+
 // numRadix takes a number radix and a numeral string x. It returns the
 // number that the numeral string x represents in base radix when the numerals
 // are valued in decreasing order of significance.
 func numRadix(x []uint16, radix uint32) *big.Int {
-	var out = big.NewInt(0)
-	var l = len(x)
-	var r = big.NewInt(int64(radix))
+	return numRadixInto(new(big.Int), x, radix)
+}
 
-	for i := 0; i < l; i++ {
-		out.Mul(out, r)
-		out.Add(out, big.NewInt(int64(x[i])))
+// numRadixInto is numRadix, but it sets the preallocated out to the result and returns it,
+// e.g. to use a scratch big.Int acquired from the pool.
+func numRadixInto(out *big.Int, x []uint16, radix uint32) *big.Int {
+	if k, ok := log2Radix(radix); ok {
+		return numRadixPow2(out, x, k)
 	}
+	return numRadixGeneric(out, x, radix)
+}
+
+// numRadixGeneric is numRadix for any radix, computed with Horner's method. The numerals are
+// accumulated in a uint64 as long as it does not overflow, so that there is one big.Int
+// multiplication for each chunk of numerals instead of one for each numeral.
+func numRadixGeneric(out *big.Int, x []uint16, radix uint32) *big.Int {
+	var scratch = acquireBigInt()
+	defer releaseBigInt(scratch)
+
+	// chunk = numRadix(x[start:i]) and chunkPow = radix^(i-start) < 2^64.
+	var chunk, chunkPow uint64 = 0, 1
+	out.SetInt64(0)
+	for i := 0; i < len(x); i++ {
+		var hi, lo = bits.Mul64(chunkPow, uint64(radix))
+		if hi != 0 {
+			out.Mul(out, scratch.SetUint64(chunkPow))
+			out.Add(out, scratch.SetUint64(chunk))
+			chunk, chunkPow, lo = 0, 1, uint64(radix)
+		}
+		chunk = chunk*uint64(radix) + uint64(x[i])
+		chunkPow = lo
+	}
+	out.Mul(out, scratch.SetUint64(chunkPow))
+	out.Add(out, scratch.SetUint64(chunk))
 
 	return out
 }
@@ -36,15 +107,25 @@ func num(x []byte) *big.Int {
 // It returns the representation of x as a string of m numerals in base radix, in
 // decreasing order of significance.
 func strMRadix(radix, m uint32, x *big.Int) []uint16 {
+	if k, ok := log2Radix(radix); ok {
+		return strMRadixPow2(k, m, x)
+	}
+	return strMRadixGeneric(radix, m, x)
+}
+
+// strMRadixGeneric is strMRadix for any radix, computed with divisions.
+func strMRadixGeneric(radix, m uint32, x *big.Int) []uint16 {
 	var out = make([]uint16, m)
-	var bigRadix = big.NewInt(int64(radix))
+	var bigRadix = acquireBigInt().SetUint64(uint64(radix))
+	var maxX = radixPow(radix, m)
+	var temp = acquireBigInt()
+	defer releaseBigInt(bigRadix, maxX, temp)
+
 	// x must be in [0..radix^[
-	var maxX = big.NewInt(0).Exp(bigRadix, big.NewInt(int64(m)), nil)
-	if x.Cmp(big.NewInt(0)) == -1 || x.Cmp(maxX) != -1 {
+	if x.Sign() == -1 || x.Cmp(maxX) != -1 {
 		panic("strMRadix: x must be in [0..radix^m[.")
 	}
 
-	var temp big.Int
 	var i uint32
 	for i = 0; i < m; i++ {
 		temp.Mod(x, bigRadix)
@@ -55,6 +136,168 @@ func strMRadix(radix, m uint32, x *big.Int) []uint16 {
 	return out
 }
 
+// When the radix is a power of two 2^k, a numeral is a group of k bits, so numRadix and
+// strMRadix pack and unpack the bits instead of multiplying and dividing big integers. The
+// power of two is detected on each call rather than flagged by the constructors: the test
+// is a mask and a comparison, negligible next to the conversion, SetRadix would have to keep
+// a flag in sync, and numRadix and strMRadix are also called outside of the BlockModes.
+
+// log2Radix takes an integer radix. It returns k and true if radix = 2^k, and false otherwise.
+func log2Radix(radix uint32) (uint32, bool) {
+	if radix == 0 || radix&(radix-1) != 0 {
+		return 0, false
+	}
+	return uint32(bits.TrailingZeros32(radix)), true
+}
+
+// numRadixPow2 is numRadix for radix = 2^k, with k in [1..16].
+func numRadixPow2(out *big.Int, x []uint16, k uint32) *big.Int {
+	var buf = make([]byte, (uint64(len(x))*uint64(k)+7)/8)
+	var acc uint32
+	var nbrBits uint32
+	var j = len(buf)
+
+	// The numerals are packed from the least significant one, into the last bytes of buf.
+	for i := len(x) - 1; i >= 0; i-- {
+		acc |= uint32(x[i]) << nbrBits
+		nbrBits += k
+		for nbrBits >= 8 {
+			j--
+			buf[j] = byte(acc)
+			acc >>= 8
+			nbrBits -= 8
+		}
+	}
+	if nbrBits > 0 {
+		buf[j-1] = byte(acc)
+	}
+
+	return out.SetBytes(buf)
+}
+
+// strMRadixPow2 is strMRadix for radix = 2^k, with k in [1..16].
+func strMRadixPow2(k, m uint32, x *big.Int) []uint16 {
+	// x must be in [0..2^(k*m)[
+	if x.Sign() == -1 || x.BitLen() > int(k*m) {
+		panic("strMRadix: x must be in [0..radix^m[.")
+	}
+
+	var out = make([]uint16, m)
+	var buf = x.Bytes()
+	var mask = uint32(1)<<k - 1
+	var acc uint32
+	var nbrBits uint32
+	var j = len(buf)
+
+	// The numerals are unpacked from the least significant one, from the last bytes of buf.
+	for i := int(m) - 1; i >= 0; i-- {
+		for nbrBits < k && j > 0 {
+			j--
+			acc |= uint32(buf[j]) << nbrBits
+			nbrBits += 8
+		}
+		out[i] = uint16(acc & mask)
+		acc >>= k
+		if nbrBits < k {
+			nbrBits = 0
+		} else {
+			nbrBits -= k
+		}
+	}
+
+	return out
+}
+
+// radixPow takes the integers radix and m. It returns radix^m in a scratch big.Int
+// acquired from the pool, that the caller must release.
+func radixPow(radix, m uint32) *big.Int {
+	var exponent = acquireBigInt().SetUint64(uint64(m))
+	defer releaseBigInt(exponent)
+
+	var out = acquireBigInt().SetUint64(uint64(radix))
+	return out.Exp(out, exponent, nil)
+}
+
+// The functions below are the uint64 counterparts of numRadix, num and strMRadix. They
+// are used by the Feistel rounds instead of the big.Int arithmetic when radix^m fits in
+// a uint64, and must return exactly the same results.
+
+// radixPowUint64 takes the integers radix and m. It returns radix^m and true if radix^m
+// fits in a uint64, and false otherwise.
+func radixPowUint64(radix, m uint32) (uint64, bool) {
+	var out uint64 = 1
+
+	for i := uint32(0); i < m; i++ {
+		var hi, lo = bits.Mul64(out, uint64(radix))
+		if hi != 0 {
+			return 0, false
+		}
+		out = lo
+	}
+
+	return out, true
+}
+
+// numRadixUint64 is numRadix for numeral strings x such that radix^len(x) fits in a uint64.
+func numRadixUint64(x []uint16, radix uint32) uint64 {
+	var out uint64
+
+	for i := 0; i < len(x); i++ {
+		out = out*uint64(radix) + uint64(x[i])
+	}
+
+	return out
+}
+
+// numModUint64 takes a bit string x and an integer mod. It returns num(x) mod mod.
+func numModUint64(x []byte, mod uint64) uint64 {
+	var out uint64
+
+	for i := 0; i < len(x); i++ {
+		// out < mod, so hi < mod and the division cannot overflow.
+		var hi, lo = bits.Mul64(out, 256)
+		var carry uint64
+		lo, carry = bits.Add64(lo, uint64(x[i]), 0)
+		_, out = bits.Div64(hi+carry, lo, mod)
+	}
+
+	return out
+}
+
+// strMRadixUint64 is strMRadix for integers x in [0..radix^m[ that fit in a uint64.
+func strMRadixUint64(radix, m uint32, x uint64) []uint16 {
+	var out = make([]uint16, m)
+	strMRadixUint64Into(out, radix, x)
+	return out
+}
+
+// strMRadixUint64Into is strMRadixUint64, but it writes the len(out) numerals to out.
+func strMRadixUint64Into(out []uint16, radix uint32, x uint64) {
+	var m = len(out)
+
+	for i := 0; i < m; i++ {
+		out[m-i-1] = uint16(x % uint64(radix))
+		x /= uint64(radix)
+	}
+}
+
+// addModUint64 takes the integers x and y in [0..mod[. It returns (x + y) mod mod.
+func addModUint64(x, y, mod uint64) uint64 {
+	var sum, carry = bits.Add64(x, y, 0)
+	if carry != 0 || sum >= mod {
+		sum -= mod
+	}
+	return sum
+}
+
+// subModUint64 takes the integers x and y in [0..mod[. It returns (x - y) mod mod.
+func subModUint64(x, y, mod uint64) uint64 {
+	if x >= y {
+		return x - y
+	}
+	return mod - y + x
+}
+
 // rev takes a numeral string x and returns the numeral string that
 // consists of the numerals of x in reverse order.
 func rev(x []uint16) []uint16 {
@@ -68,6 +311,13 @@ func rev(x []uint16) []uint16 {
 	return out
 }
 
+// revInPlace takes a numeral string x and reverses the order of its numerals in place.
+func revInPlace(x []uint16) {
+	for i, j := 0, len(x)-1; i < j; i, j = i+1, j-1 {
+		x[i], x[j] = x[j], x[i]
+	}
+}
+
 // RevB takes a byte string x returns the byte string that consists
 // of the bytes of x in reverse order.
 func RevB(x []byte) []byte {
@@ -81,31 +331,223 @@ func RevB(x []byte) []byte {
 	return out
 }
 
+// RevBInPlace takes a byte string x and reverses the order of its bytes in place.
+func RevBInPlace(x []byte) {
+	for i, j := 0, len(x)-1; i < j; i, j = i+1, j-1 {
+		x[i], x[j] = x[j], x[i]
+	}
+}
+
 // getAsBBytes takes an integer b and a an integer x in[0..256^b[. It returns the
 // representation of x as a string of b bytes.
 func getAsBBytes(x *big.Int, b uint64) []byte {
-	var maxX = big.NewInt(256)
-	maxX.Exp(maxX, big.NewInt(int64(b)), nil)
-	if x.Cmp(big.NewInt(0)) == -1 || x.Cmp(maxX) != -1 {
+	var out, err = getAsBBytesErr(x, b)
+	if err != nil {
 		panic("getAsBBytes: x must be in [0..256^b[.")
 	}
+	return out
+}
+
+// getAsBBytesErr is getAsBBytes, but it returns an error instead of panicking if x is not
+// in [0..256^b[.
+func getAsBBytesErr(x *big.Int, b uint64) ([]byte, error) {
+	// x < 256^b if and only if its bit length is at most 8 * b.
+	if x.Sign() == -1 || uint64(x.BitLen()) > 8*b {
+		return nil, fmt.Errorf("fpe: integer of %d bits does not fit in %d bytes", x.BitLen(), b)
+	}
 
 	var out = make([]byte, b)
 	var numRadixAsBytes = x.Bytes()
 	var l = uint64(len(numRadixAsBytes))
 	copy(out[b-l:], numRadixAsBytes)
-	return out
+	return out, nil
+}
+
+// isDomainLargeEnough takes the integers radix, n and min. It returns true if
+// radix^n >= min. The comparison is exact, the computation stops as soon as min is
+// reached, and radix^n is computed in a uint64 without allocating: if it overflows,
+// it is above min.
+func isDomainLargeEnough(radix uint32, n uint64, min int64) bool {
+	if min <= 1 {
+		return true
+	}
+
+	var domain uint64 = 1
+	for i := uint64(0); i < n && domain < uint64(min); i++ {
+		var hi, lo = bits.Mul64(domain, uint64(radix))
+		if hi != 0 {
+			return true
+		}
+		domain = lo
+	}
+
+	return domain >= uint64(min)
+}
+
+// isDomainLargeEnoughBig is isDomainLargeEnough for a min which may not fit in an int64. The
+// comparison is exact, radix^n is only computed when its bit length does not already show
+// that it is above min.
+func isDomainLargeEnoughBig(radix uint32, n uint64, min *big.Int) bool {
+	if min.IsInt64() {
+		return isDomainLargeEnough(radix, n, min.Int64())
+	}
+	// radix^n >= 2^(n*(bits.Len32(radix)-1)), which is above min if the exponent is at
+	// least the bit length of min.
+	var minBits = uint64(min.BitLen())
+	if uint64(bits.Len32(radix)-1) >= (minBits+n-1)/n {
+		return true
+	}
+	var domain = new(big.Int).Exp(big.NewInt(int64(radix)), new(big.Int).SetUint64(n), nil)
+	return domain.Cmp(min) >= 0
+}
+
+// MinInputLength takes an integer radix in [2..2^16]. It returns the minimum length of
+// a numeral string that FF1 and FF3 accept for this radix, i.e. the smallest n >= 2 such
+// that radix^n >= 100.
+func MinInputLength(radix uint32) int {
+	if radix < minRadixFF1 || radix > maxRadixFF1 {
+		panic(fmt.Sprintf("MinInputLength: radix must be in [%d..%d].", minRadixFF1, maxRadixFF1))
+	}
+
+	return minDomainLength(radix, minDomainFF1)
+}
+
+// minDomainLength takes the integers radix >= 2 and min. It returns the smallest n >= 2 such
+// that radix^n >= min.
+func minDomainLength(radix uint32, min int64) int {
+	var n = minInputLenFF1
+	for !isDomainLargeEnough(radix, uint64(n), min) {
+		n++
+	}
+	return n
+}
+
+// DomainSize takes an integer radix in [2..2^16] and a length n >= 0. It returns the
+// number of numeral strings of length n, i.e. radix^n.
+func DomainSize(radix uint32, n int) *big.Int {
+	checkDomainParams("DomainSize", radix, n)
+	return new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(n)), nil)
+}
+
+// DomainSizeLog10 takes an integer radix in [2..2^16] and a length n >= 0. It returns
+// log10(radix^n), an approximation of the number of decimal digits of DomainSize that
+// remains finite when radix^n overflows a float64, e.g. for display.
+func DomainSizeLog10(radix uint32, n int) float64 {
+	checkDomainParams("DomainSizeLog10", radix, n)
+	return float64(n) * math.Log10(float64(radix))
+}
+
+// CollisionProbability takes an integer radix in [2..2^16], a length n >= 0 and a number of
+// tokens k. It returns the probability that k values drawn at random among the radix^n
+// numeral strings of length n are not all distinct, with the birthday approximation
+// 1 - exp(-k(k-1) / (2 * radix^n)), or 1 if k > radix^n. FF1 and FF3 are permutations, so the
+// tokens of distinct plaintexts never collide under one key and tweak, but the tokens computed
+// under different tweaks, or truncated, behave as random values. The domain is computed with
+// big integers, so the result remains correct when radix^n overflows a float64.
+func CollisionProbability(radix uint32, n int, k uint64) float64 {
+	checkDomainParams("CollisionProbability", radix, n)
+
+	var domain = DomainSize(radix, n)
+	var bigK = new(big.Int).SetUint64(k)
+	if bigK.Cmp(domain) > 0 {
+		return 1
+	}
+	if k < 2 {
+		return 0
+	}
+
+	// x = k(k-1) / (2 * radix^n), which underflows to 0 for the large domains.
+	var pairs = new(big.Int).Mul(bigK, new(big.Int).SetUint64(k-1))
+	var x, _ = new(big.Float).Quo(new(big.Float).SetInt(pairs), new(big.Float).SetInt(domain.Lsh(domain, 1))).Float64()
+	return -math.Expm1(-x)
+}
+
+func checkDomainParams(funcName string, radix uint32, n int) {
+	if radix < minRadixFF1 || radix > maxRadixFF1 {
+		panic(fmt.Sprintf("%s: radix must be in [%d..%d].", funcName, minRadixFF1, maxRadixFF1))
+	}
+	if n < 0 {
+		panic(fmt.Sprintf("%s: n must not be negative.", funcName))
+	}
+}
+
+// isBlockCipher takes a Block and runs a self-test on it. It returns true if the Block behaves
+// like a block cipher: Encrypt only writes the BlockSize() bytes of dst, even if dst has a
+// larger capacity, it is deterministic, it does not return its input, and Decrypt inverts it.
+// The key is not known, so the Block cannot be checked against a test vector of AES.
+func isBlockCipher(block cipher.Block) bool {
+	var blockSize = block.BlockSize()
+	var src = make([]byte, blockSize)
+	for i := range src {
+		src[i] = byte(i)
+	}
+
+	// The second half of buf is a guard, which must not be modified by Encrypt.
+	var buf = make([]byte, 2*blockSize)
+	for i := blockSize; i < len(buf); i++ {
+		buf[i] = 0xa5
+	}
+	var enc, encAgain, dec = buf[:blockSize], make([]byte, blockSize), make([]byte, blockSize)
+	block.Encrypt(enc, src)
+	block.Encrypt(encAgain, src)
+	block.Decrypt(dec, enc)
+
+	for i := blockSize; i < len(buf); i++ {
+		if buf[i] != 0xa5 {
+			return false
+		}
+	}
+	return !bytes.Equal(enc, src) && bytes.Equal(enc, encAgain) && bytes.Equal(dec, src)
 }
 
 // isNumeralStringValid takes a numeral string x and an integer radix. It returns true if
 // the numeral string is valid, false otherwise.
 func isNumeralStringValid(x []uint16, radix uint32) bool {
+	return FirstInvalidNumeral(x, radix) == -1
+}
+
+// FirstInvalidNumeral takes a numeral string x and an integer radix. It returns the index of
+// the first numeral of x which is not in [0..radix[, or -1 if the numeral string is valid.
+func FirstInvalidNumeral(x []uint16, radix uint32) int {
 	for i := 0; i < len(x); i++ {
 		if uint32(x[i]) >= radix {
-			return false
+			return i
 		}
 	}
-	return true
+	return -1
+}
+
+// EqualNumeralStrings takes the numeral strings a and b. It returns true if they are equal,
+// false otherwise. The time taken depends on the lengths of a and b, but not on their
+// content, as for subtle.ConstantTimeCompare. The lengths are not secret.
+func EqualNumeralStrings(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	var v uint16
+	for i := range a {
+		v |= a[i] ^ b[i]
+	}
+	return subtle.ConstantTimeEq(int32(v), 0) == 1
+}
+
+// EncodedByteLen takes the length of a numeral string. It returns the length of its
+// representation as a byte string, as taken by CryptBlocks and returned by
+// NumeralStringToBytes, where each numeral is stored using 2 bytes. It is the size of the
+// dst buffer given to CryptBlocks.
+func EncodedByteLen(numeralLen int) int {
+	return 2 * numeralLen
+}
+
+// NumeralLen takes the length of the representation of a numeral string as a byte string.
+// It returns the length of the numeral string. It panics if byteLen is odd, as the byte
+// string would not represent a numeral string.
+func NumeralLen(byteLen int) int {
+	if byteLen%2 != 0 {
+		panic("NumeralLen: byteLen must be even.")
+	}
+	return byteLen / 2
 }
 
 // NumeralStringToBytes takes a string of numerals, each of them is
@@ -113,7 +555,7 @@ func isNumeralStringValid(x []uint16, radix uint32) bool {
 // a byte array, where each numeral is stored using 2 bytes.
 func NumeralStringToBytes(numeralString []uint16) []byte {
 	var l = len(numeralString)
-	var out = make([]byte, 2*l)
+	var out = make([]byte, EncodedByteLen(l))
 
 	for i := 0; i < l; i++ {
 		binary.BigEndian.PutUint16(out[2*i:2*(i+1)], numeralString[i])
@@ -123,10 +565,13 @@ func NumeralStringToBytes(numeralString []uint16) []byte {
 }
 
 // BytesToNumeralString takes a byte array and returns its representation
-// as a string of numerals.
+// as a string of numerals, where each numeral is stored using 2 bytes. The
+// length of the byte array must be even.
 func BytesToNumeralString(bytes []byte) []uint16 {
-	var size = int(math.Ceil(float64(len(bytes) / 2)))
-	var out = make([]uint16, size)
+	if len(bytes)%2 != 0 {
+		panic("BytesToNumeralString: the length of bytes must be even.")
+	}
+	var out = make([]uint16, NumeralLen(len(bytes)))
 	var l = len(out)
 
 	for i := 0; i < l; i++ {
@@ -136,6 +581,212 @@ func BytesToNumeralString(bytes []byte) []uint16 {
 	return out
 }
 
+// PackNumerals takes a numeral string x and an integer radix in [2..2^16]. It returns a
+// compact representation of x as a byte string, to store or transmit it: a header byte
+// holding the width w of the numerals, followed by each numeral stored using w bytes, big
+// endian, where w is 1 if radix <= 256 and 2 otherwise. It is not the representation taken
+// by CryptBlocks, see NumeralStringToBytes. It panics if a numeral is not in [0..radix[.
+func PackNumerals(x []uint16, radix uint32) []byte {
+	if radix < minRadixFF1 || radix > maxRadixFF1 {
+		panic(fmt.Sprintf("PackNumerals: radix must be in [%d..%d].", minRadixFF1, maxRadixFF1))
+	}
+	if i := FirstInvalidNumeral(x, radix); i != -1 {
+		panic(fmt.Sprintf("PackNumerals: numeral %d (value %d) exceeds radix %d.", i, x[i], radix))
+	}
+
+	if radix > 256 {
+		return append([]byte{2}, NumeralStringToBytes(x)...)
+	}
+
+	var out = make([]byte, 1+len(x))
+	out[0] = 1
+	for i, numeral := range x {
+		out[1+i] = byte(numeral)
+	}
+	return out
+}
+
+// UnpackNumerals takes a byte string returned by PackNumerals. It returns the numeral string
+// it represents, or an error if the header byte is not a valid width or if the length of the
+// numerals is not a multiple of it.
+func UnpackNumerals(b []byte) ([]uint16, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("fpe: packed numerals must start with a header byte")
+	}
+
+	switch b[0] {
+	case 1:
+		var out = make([]uint16, len(b)-1)
+		for i := range out {
+			out[i] = uint16(b[1+i])
+		}
+		return out, nil
+	case 2:
+		if (len(b)-1)%2 != 0 {
+			return nil, fmt.Errorf("fpe: %d bytes of packed numerals of width 2", len(b)-1)
+		}
+		return BytesToNumeralString(b[1:]), nil
+	default:
+		return nil, fmt.Errorf("fpe: packed numerals of unknown width %d", b[0])
+	}
+}
+
+// The length of the header of EncodeNumeralString: the radix and the length, on 4 bytes each.
+const encodedHeaderLen = 8
+
+// EncodeNumeralString takes a numeral string x and an integer radix in [2..2^16]. It returns
+// a self-describing representation of x as a byte string, to persist it:
+// [radix]4 || [len(x)]4 || NumeralStringToBytes(x), with big-endian integers, so that
+// DecodeNumeralString can check it on read. It panics if a numeral is not in [0..radix[, or
+// if x has more than 2^32 - 1 numerals. CryptBlocks takes the raw NumeralStringToBytes.
+func EncodeNumeralString(x []uint16, radix uint32) []byte {
+	if radix < minRadixFF1 || radix > maxRadixFF1 {
+		panic(fmt.Sprintf("EncodeNumeralString: radix must be in [%d..%d].", minRadixFF1, maxRadixFF1))
+	}
+	if uint64(len(x)) > math.MaxUint32 {
+		panic("EncodeNumeralString: x must have at most 2^32 - 1 numerals.")
+	}
+	if i := FirstInvalidNumeral(x, radix); i != -1 {
+		panic(fmt.Sprintf("EncodeNumeralString: numeral %d (value %d) exceeds radix %d.", i, x[i], radix))
+	}
+
+	var out = make([]byte, encodedHeaderLen+EncodedByteLen(len(x)))
+	binary.BigEndian.PutUint32(out[0:4], radix)
+	binary.BigEndian.PutUint32(out[4:8], uint32(len(x)))
+	for i, numeral := range x {
+		binary.BigEndian.PutUint16(out[encodedHeaderLen+2*i:], numeral)
+	}
+	return out
+}
+
+// DecodeNumeralString takes a byte string returned by EncodeNumeralString. It returns the
+// numeral string and the radix it represents. It returns an error if the radix is not in
+// [2..2^16], if the length does not match the number of bytes, or if a numeral is not in
+// [0..radix[. This detects the truncated or corrupted byte strings, not a deliberate
+// tampering, which needs a MAC.
+func DecodeNumeralString(b []byte) ([]uint16, uint32, error) {
+	if len(b) < encodedHeaderLen {
+		return nil, 0, fmt.Errorf("fpe: encoded numeral string must have a %d-byte header", encodedHeaderLen)
+	}
+
+	var radix = binary.BigEndian.Uint32(b[0:4])
+	if err := validateFF1Radix(radix); err != nil {
+		return nil, 0, err
+	}
+	var n = binary.BigEndian.Uint32(b[4:8])
+	if uint64(len(b)-encodedHeaderLen) != 2*uint64(n) {
+		return nil, 0, fmt.Errorf("fpe: encoded numeral string of %d numerals has %d bytes of numerals", n, len(b)-encodedHeaderLen)
+	}
+
+	var x = BytesToNumeralString(b[encodedHeaderLen:])
+	if err := validateNumerals(x, radix); err != nil {
+		return nil, 0, err
+	}
+	return x, radix, nil
+}
+
+// NumeralString is a string of numerals, each of them is in [0..2^16[.
+type NumeralString []uint16
+
+// NumeralStringFromBytes takes a byte array, where each numeral is stored using 2 bytes,
+// and returns the corresponding NumeralString. See BytesToNumeralString.
+func NumeralStringFromBytes(bytes []byte) NumeralString {
+	return NumeralString(BytesToNumeralString(bytes))
+}
+
+// IsValid takes an integer radix. It returns true if all the numerals are in [0..radix[,
+// false otherwise.
+func (x NumeralString) IsValid(radix uint32) bool {
+	return isNumeralStringValid(x, radix)
+}
+
+// Bytes returns the representation of the numeral string as a byte array, where each
+// numeral is stored using 2 bytes. See NumeralStringToBytes.
+func (x NumeralString) Bytes() []byte {
+	return NumeralStringToBytes(x)
+}
+
+// NumeralString32 is a string of numerals, each of them is in [0..2^32[. It can represent
+// numeral strings of radix greater than 2^16, e.g. for large sets of symbols. Note that
+// FF1 and FF3 are specified for radices in [2..2^16] only (the FF1 P block encodes the
+// radix on 3 bytes, but the NIST standard caps it at 2^16), so a NumeralString32 must be
+// converted to a NumeralString before encryption.
+type NumeralString32 []uint32
+
+// NumeralString32FromBytes takes a byte array, where each numeral is stored using 4 bytes,
+// and returns the corresponding NumeralString32. See BytesToNumeralString32.
+func NumeralString32FromBytes(bytes []byte) NumeralString32 {
+	return NumeralString32(BytesToNumeralString32(bytes))
+}
+
+// IsValid takes an integer radix. It returns true if all the numerals are in [0..radix[,
+// false otherwise.
+func (x NumeralString32) IsValid(radix uint32) bool {
+	return isNumeralString32Valid(x, radix)
+}
+
+// Bytes returns the representation of the numeral string as a byte array, where each
+// numeral is stored using 4 bytes. See NumeralString32ToBytes.
+func (x NumeralString32) Bytes() []byte {
+	return NumeralString32ToBytes(x)
+}
+
+// NumeralString returns the numeral string as a NumeralString. It returns an error if
+// a numeral is not in [0..2^16[.
+func (x NumeralString32) NumeralString() (NumeralString, error) {
+	var out = make(NumeralString, len(x))
+
+	for i, numeral := range x {
+		if numeral > math.MaxUint16 {
+			return nil, fmt.Errorf("fpe: numeral %d (value %d) does not fit in 16 bits", i, numeral)
+		}
+		out[i] = uint16(numeral)
+	}
+
+	return out, nil
+}
+
+// isNumeralString32Valid takes a numeral string x and an integer radix. It returns true if
+// the numeral string is valid, false otherwise.
+func isNumeralString32Valid(x []uint32, radix uint32) bool {
+	for i := 0; i < len(x); i++ {
+		if x[i] >= radix {
+			return false
+		}
+	}
+	return true
+}
+
+// NumeralString32ToBytes takes a string of numerals, each of them is
+// in [0..2^32[. It returns the representation of numeralString as
+// a byte array, where each numeral is stored using 4 bytes.
+func NumeralString32ToBytes(numeralString []uint32) []byte {
+	var l = len(numeralString)
+	var out = make([]byte, 4*l)
+
+	for i := 0; i < l; i++ {
+		binary.BigEndian.PutUint32(out[4*i:4*(i+1)], numeralString[i])
+	}
+
+	return out
+}
+
+// BytesToNumeralString32 takes a byte array and returns its representation
+// as a string of numerals, where each numeral is stored using 4 bytes. The
+// length of the byte array must be a multiple of 4.
+func BytesToNumeralString32(bytes []byte) []uint32 {
+	if len(bytes)%4 != 0 {
+		panic("BytesToNumeralString32: the length of bytes must be a multiple of 4.")
+	}
+	var out = make([]uint32, len(bytes)/4)
+
+	for i := 0; i < len(out); i++ {
+		out[i] = binary.BigEndian.Uint32(bytes[4*i : 4*(i+1)])
+	}
+
+	return out
+}
+
 //This function is taken from the go crypto package (in xor.go)
 func xorBytes(dst, a, b []byte) int {
 	n := len(a)
@@ -154,3 +805,10 @@ func dup(p []byte) []byte {
 	copy(q, p)
 	return q
 }
+
+// zero overwrites the byte string p with zeros.
+func zero(p []byte) {
+	for i := range p {
+		p[i] = 0
+	}
+}
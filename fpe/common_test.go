@@ -1,9 +1,16 @@
 package fpe
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"math"
 	"math/big"
 	"math/rand"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -21,6 +28,58 @@ func TestNumRadix(t *testing.T) {
 	assert.Equal(t, result, expected)
 }
 
+// numRadixReference is the straightforward implementation of numRadix, with one big.Int
+// multiplication and one allocation per numeral. It is the reference for the tests and
+// the benchmarks.
+func numRadixReference(x []uint16, radix uint32) *big.Int {
+	var out = big.NewInt(0)
+	for i := 0; i < len(x); i++ {
+		out.Mul(out, big.NewInt(int64(radix)))
+		out.Add(out, big.NewInt(int64(x[i])))
+	}
+	return out
+}
+
+func TestNumRadixDifferential(t *testing.T) {
+	var radices = []uint32{2, 3, 10, 16, 26, 36, 62, 255, 1000, 4096, 65535, maxRadixFF1}
+
+	for _, radix := range radices {
+		for _, l := range []int{0, 1, 2, 10, 19, 20, 21, 56, 100, 500} {
+			var x = generateRandomNumeralString(radix, l)
+			var expected = numRadixReference(x, radix)
+			assert.Equal(t, 0, expected.Cmp(numRadix(x, radix)), radix, l)
+
+			// The preallocated output is overwritten.
+			var out = big.NewInt(-12345)
+			assert.Equal(t, out, numRadixInto(out, x, radix))
+			assert.Equal(t, 0, expected.Cmp(out), radix, l)
+		}
+		// Largest numerals
+		var x = make([]uint16, 60)
+		for i := range x {
+			x[i] = uint16(radix - 1)
+		}
+		assert.Equal(t, 0, numRadixReference(x, radix).Cmp(numRadix(x, radix)), radix)
+	}
+}
+
+func BenchmarkNumRadixReference(b *testing.B) {
+	var x = generateRandomNumeralString(10, 56)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		numRadixReference(x, 10)
+	}
+}
+
+func BenchmarkNumRadix(b *testing.B) {
+	var x = generateRandomNumeralString(10, 56)
+	var out = new(big.Int)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		numRadixInto(out, x, 10)
+	}
+}
+
 func TestNum(t *testing.T) {
 	var x = []byte{0x52, 0x1f, 0x6e, 0x4a, 0x88, 0xb7, 0xe0, 0x30}
 	var expected = big.NewInt(5917569701788508208)
@@ -64,6 +123,194 @@ func TestStrMRadix(t *testing.T) {
 	assert.Panics(t, f)
 }
 
+func TestGetAsBBytesErr(t *testing.T) {
+	for b := uint64(0); b <= 32; b++ {
+		// 256^b - 1 fits in b bytes, 256^b does not.
+		var max = new(big.Int).Lsh(big.NewInt(1), uint(8*b))
+		var result, err = getAsBBytesErr(new(big.Int).Sub(max, big.NewInt(1)), b)
+		assert.Nil(t, err)
+		assert.Equal(t, bytes.Repeat([]byte{0xff}, int(b)), result)
+
+		result, err = getAsBBytesErr(max, b)
+		assert.NotNil(t, err)
+		assert.Nil(t, result)
+		assert.Panics(t, func() { getAsBBytes(max, b) })
+	}
+
+	var result, err = getAsBBytesErr(big.NewInt(0), 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 0, 0}, result)
+	_, err = getAsBBytesErr(big.NewInt(-1), 3)
+	assert.NotNil(t, err)
+}
+
+func TestRadixPowUint64(t *testing.T) {
+	var tests = []struct {
+		radix uint32
+		m     uint32
+		fits  bool
+	}{
+		{10, 19, true},
+		{10, 20, false},
+		{2, 63, true},
+		{2, 64, false},
+		{3, 40, true},
+		{3, 41, false},
+		{maxRadixFF1, 3, true},
+		{maxRadixFF1, 4, false},
+		{maxRadixFF1, maxInputLenFF1, false},
+	}
+
+	for _, test := range tests {
+		var result, fits = radixPowUint64(test.radix, test.m)
+		assert.Equal(t, test.fits, fits)
+		if fits {
+			var expected = big.NewInt(0).Exp(big.NewInt(int64(test.radix)), big.NewInt(int64(test.m)), nil)
+			assert.Equal(t, expected.Uint64(), result)
+		}
+	}
+}
+
+// This test checks that the uint64 functions return the same results as their big.Int counterparts.
+func TestUint64Arithmetic(t *testing.T) {
+	for i := 0; i < nbrTests; i++ {
+		var radix, m, radixM = generateRandomUint64Domain()
+		var bigRadixM = big.NewInt(0).SetUint64(radixM)
+
+		// numRadix
+		var x = generateRandomNumeralString(radix, int(m))
+		assert.Equal(t, numRadix(x, radix).Uint64(), numRadixUint64(x, radix))
+
+		// num mod radix^m
+		var s = make([]byte, rand.Intn(40))
+		rand.Read(s)
+		var expected = big.NewInt(0).Mod(num(s), bigRadixM)
+		assert.Equal(t, expected.Uint64(), numModUint64(s, radixM))
+
+		// strMRadix
+		var c = numRadixUint64(x, radix)
+		assert.Equal(t, strMRadix(radix, m, big.NewInt(0).SetUint64(c)), strMRadixUint64(radix, m, c))
+
+		// Modular addition and subtraction
+		var y = expected.Uint64()
+		var sum = big.NewInt(0).Add(numRadix(x, radix), expected)
+		var diff = big.NewInt(0).Sub(numRadix(x, radix), expected)
+		assert.Equal(t, sum.Mod(sum, bigRadixM).Uint64(), addModUint64(c, y, radixM))
+		assert.Equal(t, diff.Mod(diff, bigRadixM).Uint64(), subModUint64(c, y, radixM))
+	}
+}
+
+// This test encrypts concurrently with separate cipher instances, on domains that do not fit in a
+// uint64 so the pooled big.Int values are used. It is meant to be run with the -race flag.
+func TestConcurrentEncryption(t *testing.T) {
+	var nbrGoroutines = 8
+	var radix uint32 = maxRadixFF1
+	var key, tweak, _ = getRandomParameters(ff1DefaultKeySize, tweakLenFF3, 0)
+	var plaintext = NumeralStringToBytes(generateRandomNumeralString(radix, maxLength(radix)))
+
+	// Expected ciphertexts, computed sequentially.
+	var getters = []func(key, tweak []byte, radix uint32) (cipher.BlockMode, error){
+		getFF1Encrypter,
+		getFF3Encrypter,
+	}
+	var expected = make([][]byte, len(getters))
+	for i, getEncrypter := range getters {
+		var encrypter, err = getEncrypter(key, tweak, radix)
+		assert.Nil(t, err)
+		expected[i] = make([]byte, len(plaintext))
+		encrypter.CryptBlocks(expected[i], plaintext)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < nbrGoroutines; g++ {
+		for i, getEncrypter := range getters {
+			wg.Add(1)
+			go func(getEncrypter func(key, tweak []byte, radix uint32) (cipher.BlockMode, error), expected []byte) {
+				defer wg.Done()
+				var encrypter, err = getEncrypter(key, tweak, radix)
+				assert.Nil(t, err)
+				for j := 0; j < 50; j++ {
+					var ciphertext = make([]byte, len(plaintext))
+					encrypter.CryptBlocks(ciphertext, plaintext)
+					assert.Equal(t, expected, ciphertext)
+				}
+			}(getEncrypter, expected[i])
+		}
+	}
+	wg.Wait()
+}
+
+func TestConcurrentSharedEncryption(t *testing.T) {
+	var nbrGoroutines = 8
+	var radix uint32 = 10
+	var key, tweak, _ = getRandomParameters(ff1DefaultKeySize, tweakLenFF3, 0)
+
+	// The same encrypter and decrypter are shared by all goroutines.
+	var getters = []func(key, tweak []byte, radix uint32) (cipher.BlockMode, cipher.BlockMode, error){
+		newFF1BlockModes,
+		newFF3BlockModes,
+	}
+
+	for _, getBlockModes := range getters {
+		var encrypter, decrypter, err = getBlockModes(key, tweak, radix)
+		assert.Nil(t, err)
+
+		var wg sync.WaitGroup
+		for g := 0; g < nbrGoroutines; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					var plaintext = NumeralStringToBytes(generateRandomNumeralString(radix, 20))
+					var ciphertext = make([]byte, len(plaintext))
+					var decrypted = make([]byte, len(plaintext))
+					encrypter.CryptBlocks(ciphertext, plaintext)
+					decrypter.CryptBlocks(decrypted, ciphertext)
+					assert.Equal(t, plaintext, decrypted)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func TestInPlaceCryptBlocks(t *testing.T) {
+	var key, tweak, _ = getRandomParameters(ff1DefaultKeySize, tweakLenFF3, 0)
+	var getters = []func(key, tweak []byte, radix uint32) (cipher.BlockMode, cipher.BlockMode, error){
+		newFF1BlockModes,
+		newFF3BlockModes,
+		func(key, tweak []byte, radix uint32) (cipher.BlockMode, cipher.BlockMode, error) {
+			var aesBlock, err = aes.NewCipher(RevB(key))
+			if err != nil {
+				return nil, nil, err
+			}
+			return NewFF31Encrypter(aesBlock, tweak[:tweakLenFF31], radix), NewFF31Decrypter(aesBlock, tweak[:tweakLenFF31], radix), nil
+		},
+	}
+
+	for _, radix := range []uint32{10, 26, 1000, maxRadixFF1} {
+		for _, getBlockModes := range getters {
+			var encrypter, decrypter, err = getBlockModes(key, tweak, radix)
+			assert.Nil(t, err)
+
+			for _, mode := range []cipher.BlockMode{encrypter, decrypter} {
+				for i := 0; i < 10; i++ {
+					// The length satisfies the FF3-1 domain condition and the FF3 maximum length.
+					var minLen = MinInputLength(radix) + 5
+					var l = minLen + rand.Intn(maxLength(radix)-minLen+1)
+					var src = NumeralStringToBytes(generateRandomNumeralString(radix, l))
+
+					var expected = make([]byte, len(src))
+					mode.CryptBlocks(expected, src)
+
+					mode.CryptBlocks(src, src)
+					assert.Equal(t, expected, src)
+				}
+			}
+		}
+	}
+}
+
 func TestRev(t *testing.T) {
 	var x = []uint16{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
 	var expected = []uint16{10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0}
@@ -80,6 +327,225 @@ func TestRevB(t *testing.T) {
 	assert.Equal(t, result, expected)
 }
 
+func TestRevBInPlace(t *testing.T) {
+	for l := 0; l < 20; l++ {
+		var x = make([]byte, l)
+		rand.Read(x)
+		var expected = RevB(x)
+
+		RevBInPlace(x)
+		assert.Equal(t, expected, x)
+	}
+}
+
+// overflowBlock wraps a Block, but its Encrypt writes one byte past the block, within the
+// capacity of dst.
+type overflowBlock struct {
+	cipher.Block
+}
+
+func (b overflowBlock) Encrypt(dst, src []byte) {
+	b.Block.Encrypt(dst, src)
+	dst = dst[:cap(dst)]
+	if len(dst) > b.BlockSize() {
+		dst[b.BlockSize()] ^= 0xff
+	}
+}
+
+// identityBlock is a 16-byte Block which does not encrypt.
+type identityBlock struct{}
+
+func (identityBlock) BlockSize() int          { return 16 }
+func (identityBlock) Encrypt(dst, src []byte) { copy(dst, src[:16]) }
+func (identityBlock) Decrypt(dst, src []byte) { copy(dst, src[:16]) }
+
+// panickingBlock is a Block which panics in Encrypt once armed is set.
+type panickingBlock struct {
+	cipher.Block
+	armed *bool
+}
+
+func (b panickingBlock) Encrypt(dst, src []byte) {
+	if *b.armed {
+		panic("panickingBlock: Encrypt")
+	}
+	b.Block.Encrypt(dst, src)
+}
+
+// When CryptBlocks panics, on an invalid input or in the block, dst must be left unchanged.
+func TestCryptBlocksPanicLeavesDst(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, tweakLenFF3, 0)
+	var aesBlock, _ = aes.NewCipher(key)
+	var armed bool
+	var block = panickingBlock{aesBlock, &armed}
+	var cbcMode = NewCBCWithSetIV(block, make([]byte, blockSizeFF1))
+
+	var modes = []cipher.BlockMode{
+		NewFF1Encrypter(block, cbcMode, tweak, 10),
+		NewFF1Decrypter(block, cbcMode, tweak, 10),
+		NewFF3Encrypter(block, tweak, 10),
+		NewFF3Decrypter(block, tweak, 10),
+		NewFF31Encrypter(block, tweak[:tweakLenFF31], 10),
+		NewFF31Decrypter(block, tweak[:tweakLenFF31], 10),
+	}
+	var valid = NumeralStringToBytes([]uint16{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	var invalidInputs = [][]byte{
+		NumeralStringToBytes([]uint16{0, 1, 2, 3, 4, 5, 6, 7, 8, 10}),
+		NumeralStringToBytes([]uint16{0}),
+		valid[:len(valid)-1],
+	}
+
+	for _, mode := range modes {
+		for _, src := range invalidInputs {
+			var dst = bytes.Repeat([]byte{0xa5}, len(src))
+			assert.Panics(t, func() { mode.CryptBlocks(dst, src) })
+			assert.Equal(t, bytes.Repeat([]byte{0xa5}, len(src)), dst)
+		}
+
+		// In place, the src must not be modified either.
+		var buf = append([]byte(nil), valid...)
+		armed = true
+		assert.Panics(t, func() { mode.CryptBlocks(buf, buf) })
+		armed = false
+		assert.Equal(t, valid, buf)
+	}
+}
+
+func TestIsBlockCipher(t *testing.T) {
+	var key, _, _ []byte = getRandomParameters(32, 0, 0)
+	var aesBlock, _ = aes.NewCipher(key)
+
+	assert.True(t, isBlockCipher(aesBlock))
+	assert.False(t, isBlockCipher(overflowBlock{aesBlock}))
+	assert.False(t, isBlockCipher(identityBlock{}))
+
+	// The constructors must reject the misbehaving blocks.
+	var cbcMode = NewCBCWithSetIV(aesBlock, make([]byte, blockSizeFF1))
+	for _, block := range []cipher.Block{overflowBlock{aesBlock}, identityBlock{}} {
+		assert.Panics(t, func() { NewFF1Encrypter(block, cbcMode, nil, 10) })
+		assert.Panics(t, func() { NewFF1Decrypter(block, cbcMode, nil, 10) })
+		assert.Panics(t, func() { NewFF3Encrypter(block, make([]byte, tweakLenFF3), 10) })
+		assert.Panics(t, func() { NewFF3Decrypter(block, make([]byte, tweakLenFF3), 10) })
+		assert.Panics(t, func() { NewFF31Encrypter(block, make([]byte, tweakLenFF31), 10) })
+		assert.Panics(t, func() { NewFF31Decrypter(block, make([]byte, tweakLenFF31), 10) })
+	}
+}
+
+// The FF1 and FF3 encrypters must be usable through the FPE interface.
+func TestFPEInterface(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(32, tweakLenFF3, 0)
+	var aesBlock, _ = aes.NewCipher(key)
+	var cbcMode = NewCBCWithSetIV(aesBlock, make([]byte, blockSizeFF1))
+	var newTweak = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	var modes = []FPE{
+		NewFF1Encrypter(aesBlock, cbcMode, tweak, 10).(FPE),
+		NewFF3Encrypter(aesBlock, tweak, 10).(FPE),
+	}
+	var expected = []cipher.BlockMode{
+		NewFF1Encrypter(aesBlock, cbcMode, newTweak, 16),
+		NewFF3Encrypter(aesBlock, newTweak, 16),
+	}
+
+	var plaintext = NumeralStringToBytes(generateRandomNumeralString(16, 20))
+	for i, mode := range modes {
+		mode.SetTweak(newTweak)
+		mode.SetRadix(16)
+
+		var ciphertext, want = make([]byte, len(plaintext)), make([]byte, len(plaintext))
+		mode.CryptBlocks(ciphertext, plaintext)
+		expected[i].CryptBlocks(want, plaintext)
+		assert.Equal(t, want, ciphertext)
+	}
+
+	// All the encrypters and decrypters implement FPE.
+	var ff31Tweak = tweak[:tweakLenFF31]
+	for _, mode := range []cipher.BlockMode{
+		NewFF1Decrypter(aesBlock, cbcMode, tweak, 10),
+		NewFF3Decrypter(aesBlock, tweak, 10),
+		NewFF31Encrypter(aesBlock, ff31Tweak, 10),
+		NewFF31Decrypter(aesBlock, ff31Tweak, 10),
+	} {
+		var _, ok = mode.(FPE)
+		assert.True(t, ok)
+	}
+}
+
+// CryptBlocksWithTweak must encrypt with the given tweak, as a BlockMode built with it,
+// without modifying the tweak of the BlockMode.
+func TestCryptBlocksWithTweak(t *testing.T) {
+	var key, _, _ []byte = getRandomParameters(32, 0, 0)
+	var aesBlock, _ = aes.NewCipher(key)
+	var cbcMode = NewCBCWithSetIV(aesBlock, make([]byte, blockSizeFF1))
+	var tweak, otherTweak = []byte{1, 2, 3, 4, 5, 6, 7, 8}, []byte{8, 7, 6, 5, 4, 3, 2, 1}
+
+	var newModes = []func(tweak []byte) cipher.BlockMode{
+		func(tweak []byte) cipher.BlockMode { return NewFF1Encrypter(aesBlock, cbcMode, tweak, 10) },
+		func(tweak []byte) cipher.BlockMode { return NewFF1Decrypter(aesBlock, cbcMode, tweak, 10) },
+		func(tweak []byte) cipher.BlockMode { return NewFF3Encrypter(aesBlock, tweak, 10) },
+		func(tweak []byte) cipher.BlockMode { return NewFF3Decrypter(aesBlock, tweak, 10) },
+		func(tweak []byte) cipher.BlockMode { return NewFF31Encrypter(aesBlock, tweak[:tweakLenFF31], 10) },
+		func(tweak []byte) cipher.BlockMode { return NewFF31Decrypter(aesBlock, tweak[:tweakLenFF31], 10) },
+	}
+
+	var plaintext = NumeralStringToBytes(generateRandomNumeralString(10, 16))
+	for i, newMode := range newModes {
+		var mode = newMode(tweak).(TweakCrypter)
+		var otherLen = len(otherTweak)
+		if i >= 4 {
+			otherLen = tweakLenFF31
+		}
+
+		// The result is the one of a BlockMode built with the other tweak.
+		var result, expected = make([]byte, len(plaintext)), make([]byte, len(plaintext))
+		mode.CryptBlocksWithTweak(result, plaintext, otherTweak[:otherLen])
+		newMode(otherTweak).CryptBlocks(expected, plaintext)
+		assert.Equal(t, expected, result)
+
+		// The tweak of the BlockMode is not modified.
+		mode.CryptBlocks(result, plaintext)
+		newMode(tweak).CryptBlocks(expected, plaintext)
+		assert.Equal(t, expected, result)
+
+		if i >= 2 {
+			assert.Panics(t, func() { mode.CryptBlocksWithTweak(result, plaintext, make([]byte, otherLen+1)) })
+		} else {
+			assert.Panics(t, func() { mode.CryptBlocksWithTweak(result, plaintext, make([]byte, maxTweakLenFF1+1)) })
+		}
+	}
+}
+
+// One BlockMode serves many tweaks concurrently. It is meant to be run with the -race flag.
+func TestCryptBlocksWithTweakConcurrent(t *testing.T) {
+	var key, _, _ []byte = getRandomParameters(32, 0, 0)
+	var encrypter, _ = NewFF1EncrypterFromKey(key, nil, 10)
+	var mode = encrypter.(TweakCrypter)
+
+	const nbrTweaks = 64
+	var plaintext = NumeralStringToBytes(generateRandomNumeralString(10, 16))
+	var tweaks, expected = make([][]byte, nbrTweaks), make([][]byte, nbrTweaks)
+	for i := range tweaks {
+		tweaks[i] = []byte{byte(i), byte(i >> 8)}
+		var e, _ = NewFF1EncrypterFromKey(key, tweaks[i], 10)
+		expected[i] = make([]byte, len(plaintext))
+		e.CryptBlocks(expected[i], plaintext)
+	}
+
+	var wg sync.WaitGroup
+	var results = make([][]byte, nbrTweaks)
+	for i := range tweaks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = make([]byte, len(plaintext))
+			mode.CryptBlocksWithTweak(results[i], plaintext, tweaks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, expected, results)
+}
+
 func TestGetAsBBytes(t *testing.T) {
 	for b := 1; b <= 100; b++ {
 		var x = big.NewInt(int64(b))
@@ -117,6 +583,16 @@ func TestGetAsBBytes(t *testing.T) {
 	assert.Panics(t, f)
 }
 
+func TestEncodedByteLen(t *testing.T) {
+	for n := 0; n < 100; n++ {
+		var b = NumeralStringToBytes(make([]uint16, n))
+		assert.Equal(t, len(b), EncodedByteLen(n))
+		assert.Equal(t, n, NumeralLen(EncodedByteLen(n)))
+	}
+
+	assert.Panics(t, func() { NumeralLen(7) })
+}
+
 func TestNumeralStringToBytes(t *testing.T) {
 	var x = []uint16{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
 	var expected = []byte{
@@ -141,6 +617,23 @@ func TestNumeralStringToBytes(t *testing.T) {
 	}
 }
 
+// The conversions must keep the leading zero numerals.
+func TestConversionsLeadingZeros(t *testing.T) {
+	var alphabet, _ = Alphabets("decimal")
+	var x, err = alphabet.ToNumerals("0000000001")
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, x)
+
+	var b = NumeralStringToBytes(x)
+	assert.Equal(t, 20, len(b))
+	assert.Equal(t, x, BytesToNumeralString(b))
+
+	var s string
+	s, err = alphabet.ToString(BytesToNumeralString(b))
+	assert.Nil(t, err)
+	assert.Equal(t, "0000000001", s)
+}
+
 func TestBytesToNumeralString(t *testing.T) {
 	var x = []byte{
 		0x00, 0x00, 0x00, 0x01, 0x00, 0x02, 0x00, 0x03, 0x00, 0x04,
@@ -162,6 +655,108 @@ func TestBytesToNumeralString(t *testing.T) {
 	for _, x := range result {
 		assert.Equal(t, x, uint16(maxRadixFF1-1))
 	}
+
+	// Test odd lengths, which must fail with a clear message instead of an out-of-range slice.
+	for _, l := range []int{1, 3, 5, 101} {
+		var f = func() (msg interface{}) {
+			defer func() { msg = recover() }()
+			BytesToNumeralString(make([]byte, l))
+			return nil
+		}
+		assert.Equal(t, "BytesToNumeralString: the length of bytes must be even.", f())
+	}
+}
+
+func TestPackNumerals(t *testing.T) {
+	for _, test := range []struct {
+		radix uint32
+		width int
+	}{
+		{2, 1},
+		{10, 1},
+		{256, 1},
+		{257, 2},
+		{maxRadixFF1, 2},
+	} {
+		for _, l := range []int{0, 1, 16, 1000} {
+			var x = generateRandomNumeralString(test.radix, l)
+			var packed = PackNumerals(x, test.radix)
+			assert.Equal(t, 1+test.width*l, len(packed))
+			assert.Equal(t, byte(test.width), packed[0])
+
+			var result, err = UnpackNumerals(packed)
+			assert.Nil(t, err)
+			assert.Equal(t, x, result)
+		}
+	}
+
+	// The largest numerals of each width.
+	assert.Equal(t, []byte{1, 0, 0xff}, PackNumerals([]uint16{0, 255}, 256))
+	assert.Equal(t, []byte{2, 0, 0, 0xff, 0xff}, PackNumerals([]uint16{0, 0xffff}, maxRadixFF1))
+
+	assert.Panics(t, func() { PackNumerals([]uint16{0, 10}, 10) })
+	assert.Panics(t, func() { PackNumerals([]uint16{0, 1}, 1) })
+
+	for _, packed := range [][]byte{nil, {0}, {3, 1}, {2, 0, 1, 2}} {
+		var result, err = UnpackNumerals(packed)
+		assert.NotNil(t, err)
+		assert.Nil(t, result)
+	}
+}
+
+func TestEncodeNumeralString(t *testing.T) {
+	for _, radix := range []uint32{2, 10, 256, maxRadixFF1} {
+		for _, l := range []int{0, 1, 16, 1000} {
+			var x = generateRandomNumeralString(radix, l)
+			var encoded = EncodeNumeralString(x, radix)
+			assert.Equal(t, encodedHeaderLen+2*l, len(encoded))
+
+			var result, resultRadix, err = DecodeNumeralString(encoded)
+			assert.Nil(t, err)
+			assert.Equal(t, x, result)
+			assert.Equal(t, radix, resultRadix)
+		}
+	}
+
+	var encoded = EncodeNumeralString([]uint16{1, 2, 9}, 10)
+	assert.Equal(t, []byte{0, 0, 0, 10, 0, 0, 0, 3, 0, 1, 0, 2, 0, 9}, encoded)
+
+	assert.Panics(t, func() { EncodeNumeralString([]uint16{1, 10}, 10) })
+	assert.Panics(t, func() { EncodeNumeralString([]uint16{1, 2}, 1) })
+}
+
+// The truncated or corrupted encodings must be rejected.
+func TestDecodeNumeralStringCorrupted(t *testing.T) {
+	var encoded = EncodeNumeralString([]uint16{1, 2, 9}, 10)
+	var corrupt = func(i int, v byte) []byte {
+		var out = append([]byte(nil), encoded...)
+		out[i] = v
+		return out
+	}
+
+	for _, b := range [][]byte{
+		nil,
+		encoded[:7],
+		encoded[:len(encoded)-1],
+		encoded[:len(encoded)-2],
+		append(append([]byte(nil), encoded...), 0, 0),
+		// Radix 1 and 2^16 + 1
+		corrupt(3, 1),
+		corrupt(1, 1),
+		// Length 4 and 2
+		corrupt(7, 4),
+		corrupt(7, 2),
+		// Numeral 9 replaced by 10, and by 9 + 256
+		corrupt(13, 10),
+		corrupt(12, 1),
+		// Radix 8, below the numeral 9
+		corrupt(3, 8),
+	} {
+		var x, radix, err = DecodeNumeralString(b)
+		assert.NotNil(t, err)
+		assert.Nil(t, x)
+		assert.Equal(t, uint32(0), radix)
+	}
 }
 
 func TestConversions(t *testing.T) {
@@ -174,6 +769,194 @@ func TestConversions(t *testing.T) {
 
 		assert.Equal(t, result, x)
 	}
+
+	// Test all even lengths, including the empty string
+	for l := 0; l <= 100; l += 2 {
+		var x = make([]byte, l)
+		rand.Read(x)
+		var result = NumeralStringToBytes(BytesToNumeralString(x))
+
+		assert.Equal(t, result, x)
+	}
+}
+
+func TestIsDomainLargeEnough(t *testing.T) {
+	// Radix 2: 2^6 = 64 and 2^7 = 128
+	assert.False(t, isDomainLargeEnough(2, 6, 100))
+	assert.True(t, isDomainLargeEnough(2, 7, 100))
+	// Exact boundary: 10^2 = 100
+	assert.False(t, isDomainLargeEnough(10, 1, 100))
+	assert.True(t, isDomainLargeEnough(10, 2, 100))
+	assert.False(t, isDomainLargeEnough(10, 5, 1000000))
+	assert.True(t, isDomainLargeEnough(10, 6, 1000000))
+	// Empty numeral string
+	assert.False(t, isDomainLargeEnough(maxRadixFF1, 0, 100))
+	// radix^n does not fit in a float64
+	assert.True(t, isDomainLargeEnough(maxRadixFF1, maxInputLenFF1, 100))
+}
+
+// isDomainLargeEnough must agree with the exact big.Int comparison, including around the
+// lengths where radix^n overflows a uint64 (n = 64 for radix 2) and a float64 (n = 1024).
+func TestIsDomainLargeEnoughExact(t *testing.T) {
+	for _, radix := range []uint32{2, 3, 10, 255, maxRadixFF1} {
+		for _, n := range []uint64{0, 1, 2, 6, 7, 63, 64, 65, 200, 1023, 1024, 1025} {
+			var domain = new(big.Int).Exp(big.NewInt(int64(radix)), new(big.Int).SetUint64(n), nil)
+			for _, min := range []int64{-1, 0, 1, 100, 1000000, 1 << 62, math.MaxInt64} {
+				var expected = domain.Cmp(big.NewInt(min)) >= 0
+				assert.Equal(t, expected, isDomainLargeEnough(radix, n, min), fmt.Sprintf("radix %d, n %d, min %d", radix, n, min))
+			}
+		}
+	}
+}
+
+// The NIST standard does not make the number of rounds depend on the input length.
+func TestNumRounds(t *testing.T) {
+	for _, l := range []int{minInputLenFF1, 10, 32, 64, 128, 1000} {
+		assert.Equal(t, 10, NumRoundsFF1(l))
+	}
+	assert.Equal(t, 8, NumRoundsFF3())
+}
+
+func TestInputLength(t *testing.T) {
+	var radixes = []uint32{2, 10, 26, 65536}
+	var minLen = []int{7, 2, 2, 2}
+	var maxLenFF3 = []int{192, 56, 40, 12}
+
+	for i, radix := range radixes {
+		assert.Equal(t, minLen[i], MinInputLength(radix))
+		assert.Equal(t, maxLenFF3[i], MaxInputLengthFF3(radix))
+		assert.Equal(t, uint64(maxInputLenFF1), MaxInputLengthFF1())
+
+		// The minimum length is accepted, shorter inputs are not.
+		assert.Nil(t, checkFF1Input(make([]uint16, minLen[i]), radix))
+		assert.Nil(t, checkFF3Input(make([]uint16, minLen[i]), radix))
+		assert.NotNil(t, checkFF1Input(make([]uint16, minLen[i]-1), radix))
+		assert.NotNil(t, checkFF3Input(make([]uint16, minLen[i]-1), radix))
+		// The maximum length is accepted by FF3, longer inputs are not.
+		assert.Nil(t, checkFF3Input(make([]uint16, maxLenFF3[i]), radix))
+		assert.NotNil(t, checkFF3Input(make([]uint16, maxLenFF3[i]+1), radix))
+	}
+
+	// Invalid radix
+	assert.Panics(t, func() { MinInputLength(1) })
+	assert.Panics(t, func() { MinInputLength(maxRadixFF1 + 1) })
+	assert.Panics(t, func() { MaxInputLengthFF3(1) })
+	assert.Panics(t, func() { MaxInputLengthFF3(maxRadixFF3 + 1) })
+}
+
+func TestCollisionProbability(t *testing.T) {
+	var expected = []struct {
+		radix       uint32
+		n           int
+		k           uint64
+		probability float64
+	}{
+		// The birthday problem: 1 - exp(-23 * 22 / 730) = 0.50000, the exact probability is 0.5073.
+		{365, 1, 23, 0.50000},
+		// 1 - exp(-10 * 9 / 200) = 0.36237.
+		{10, 2, 10, 0.36237},
+		// 1 - exp(-2^32 (2^32 - 1) / 2^65), about 1 - exp(-1/2) = 0.39347.
+		{2, 64, 1 << 32, 0.39347},
+		// 1 - exp(-1000000 * 999999 / (2 * 10^16)), about 5e-5.
+		{10, 16, 1000000, 0.00005},
+		// No collision with less than 2 tokens, and a certain one with more tokens than values.
+		{10, 2, 0, 0},
+		{10, 2, 1, 0},
+		{10, 2, 101, 1},
+		{10, 0, 2, 1},
+	}
+
+	for _, test := range expected {
+		assert.InDelta(t, test.probability, CollisionProbability(test.radix, test.n, test.k), 1e-5)
+	}
+
+	// The domain overflows a float64, the probability is negligible but not NaN.
+	var p = CollisionProbability(10, 400, math.MaxUint64)
+	assert.True(t, p >= 0 && p < 1e-300)
+	assert.Equal(t, 1.0, CollisionProbability(2, 2, math.MaxUint64))
+
+	assert.Panics(t, func() { CollisionProbability(1, 2, 10) })
+	assert.Panics(t, func() { CollisionProbability(10, -1, 10) })
+}
+
+func TestDomainSize(t *testing.T) {
+	var expected = []struct {
+		radix  uint32
+		n      int
+		domain string
+	}{
+		{10, 0, "1"},
+		{10, 2, "100"},
+		{2, 64, "18446744073709551616"},
+		{36, 10, "3656158440062976"},
+		{1 << 16, 4, "18446744073709551616"},
+	}
+
+	for _, test := range expected {
+		var domain, _ = new(big.Int).SetString(test.domain, 10)
+		assert.Equal(t, 0, domain.Cmp(DomainSize(test.radix, test.n)))
+		assert.InDelta(t, float64(len(test.domain)-1), DomainSizeLog10(test.radix, test.n), 1)
+	}
+
+	// 10^400 and 2^(16*1000) overflow float64, but not their log10.
+	var large, _ = new(big.Int).SetString("1"+strings.Repeat("0", 400), 10)
+	assert.Equal(t, 0, large.Cmp(DomainSize(10, 400)))
+	var f, _ = new(big.Float).SetInt(large).Float64()
+	assert.True(t, math.IsInf(f, 1))
+	assert.InDelta(t, 400, DomainSizeLog10(10, 400), 1e-9)
+	assert.Equal(t, 16001, DomainSize(1<<16, 1000).BitLen())
+	assert.InDelta(t, 16000*math.Log10(2), DomainSizeLog10(1<<16, 1000), 1e-6)
+
+	assert.Panics(t, func() { DomainSize(1, 2) })
+	assert.Panics(t, func() { DomainSize(10, -1) })
+	assert.Panics(t, func() { DomainSizeLog10(maxRadixFF1+1, 2) })
+}
+
+func TestReset(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var radix uint32 = 10
+	var plaintext = NumeralStringToBytes(generateRandomNumeralString(radix, 20))
+
+	type fpeWithReset interface {
+		cipher.BlockMode
+		SetTweak([]byte)
+		GetTweak() []byte
+		Reset()
+	}
+
+	var aesBlock, err = aes.NewCipher(key)
+	assert.Nil(t, err)
+	var newCBC = func() cipher.BlockMode { return cipher.NewCBCEncrypter(aesBlock, make([]byte, blockSizeFF1)) }
+
+	var newBlockModes = []func() cipher.BlockMode{
+		func() cipher.BlockMode { return NewFF1Encrypter(aesBlock, newCBC(), tweak, radix) },
+		func() cipher.BlockMode { return NewFF1Decrypter(aesBlock, newCBC(), tweak, radix) },
+		func() cipher.BlockMode { return NewFF3Encrypter(aesBlock, tweak, radix) },
+		func() cipher.BlockMode { return NewFF3Decrypter(aesBlock, tweak, radix) },
+		func() cipher.BlockMode { return NewFF31Encrypter(aesBlock, tweak[:tweakLenFF31], radix) },
+		func() cipher.BlockMode { return NewFF31Decrypter(aesBlock, tweak[:tweakLenFF31], radix) },
+	}
+
+	for _, newBlockMode := range newBlockModes {
+		var blockMode, ok = newBlockMode().(fpeWithReset)
+		assert.True(t, ok)
+
+		var expected = make([]byte, len(plaintext))
+		newBlockMode().CryptBlocks(expected, plaintext)
+
+		var out = make([]byte, len(plaintext))
+		blockMode.CryptBlocks(out, plaintext)
+
+		// Reset zeroes the tweak.
+		var savedTweak = blockMode.GetTweak()
+		blockMode.Reset()
+		assert.Equal(t, make([]byte, len(savedTweak)), blockMode.GetTweak())
+
+		// After setting the tweak again, the block mode behaves like a new one.
+		blockMode.SetTweak(savedTweak)
+		blockMode.CryptBlocks(out, plaintext)
+		assert.Equal(t, expected, out)
+	}
 }
 
 func TestIsNumeralStringValid(t *testing.T) {
@@ -185,6 +968,91 @@ func TestIsNumeralStringValid(t *testing.T) {
 	assert.False(t, isNumeralStringValid(invalid, radix))
 }
 
+func TestFirstInvalidNumeral(t *testing.T) {
+	var radix uint32 = 10
+
+	assert.Equal(t, -1, FirstInvalidNumeral([]uint16{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, radix))
+	assert.Equal(t, -1, FirstInvalidNumeral(nil, radix))
+	assert.Equal(t, 0, FirstInvalidNumeral([]uint16{10, 1, 2}, radix))
+	assert.Equal(t, 7, FirstInvalidNumeral([]uint16{0, 1, 2, 3, 4, 5, 6, 42, 8, 11}, radix))
+}
+
+func TestEqualNumeralStrings(t *testing.T) {
+	var x = generateRandomNumeralString(maxRadixFF1, 20)
+
+	assert.True(t, EqualNumeralStrings(x, dupNumeralString(x)))
+	assert.True(t, EqualNumeralStrings([]uint16{}, nil))
+
+	// Differences at each position, and in the highest bit.
+	for i := range x {
+		var y = dupNumeralString(x)
+		y[i] ^= 0x8000
+		assert.False(t, EqualNumeralStrings(x, y))
+	}
+	// Length mismatch
+	assert.False(t, EqualNumeralStrings(x, x[:19]))
+	assert.False(t, EqualNumeralStrings(nil, x))
+}
+
+func TestNumeralString(t *testing.T) {
+	var bytes = []byte{
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x02, 0x00, 0x03, 0x00, 0x04,
+		0x00, 0x05, 0x00, 0x06, 0x00, 0x07, 0x00, 0x08, 0x00, 0x09}
+	var x = NumeralStringFromBytes(bytes)
+
+	assert.Equal(t, NumeralString{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, x)
+	assert.Equal(t, bytes, x.Bytes())
+	assert.True(t, x.IsValid(10))
+	assert.False(t, x.IsValid(9))
+
+	// NumeralString can be used wherever a []uint16 is expected
+	assert.Equal(t, NumeralStringToBytes(x), x.Bytes())
+	assert.Equal(t, []uint16(x), BytesToNumeralString(bytes))
+}
+
+func TestNumeralString32(t *testing.T) {
+	var x = NumeralString32{0, 1, maxRadixFF1, math.MaxUint32}
+	var expected = []byte{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x01, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff}
+
+	assert.Equal(t, expected, x.Bytes())
+	assert.Equal(t, x, NumeralString32FromBytes(expected))
+	assert.True(t, x[:3].IsValid(maxRadixFF1+1))
+	assert.False(t, x[:3].IsValid(maxRadixFF1))
+	assert.False(t, x.IsValid(math.MaxUint32))
+
+	// Test lengths that are not a multiple of 4
+	for _, l := range []int{1, 2, 3, 5} {
+		var f = func() {
+			BytesToNumeralString32(make([]byte, l))
+		}
+		assert.Panics(t, f)
+	}
+
+	// Round trip
+	for i := 0; i < nbrTests; i++ {
+		var x = make([]uint32, rand.Intn(100))
+		for j := range x {
+			x[j] = rand.Uint32()
+		}
+		assert.Equal(t, x, BytesToNumeralString32(NumeralString32ToBytes(x)))
+	}
+}
+
+func TestNumeralString32ToNumeralString(t *testing.T) {
+	var x = NumeralString32{0, 1, maxRadixFF1 - 1}
+	var result, err = x.NumeralString()
+	assert.Nil(t, err)
+	assert.Equal(t, NumeralString{0, 1, maxRadixFF1 - 1}, result)
+
+	// Numeral that does not fit in 16 bits
+	x = NumeralString32{0, 1, maxRadixFF1}
+	result, err = x.NumeralString()
+	assert.NotNil(t, err)
+	assert.Nil(t, result)
+}
+
 func TestXorBytes(t *testing.T) {
 	var x = []byte{0x0F, 0x0F, 0x0F, 0x0F, 0x0F}
 	var y = []byte{0xF0, 0xF0, 0xF0, 0xF0}
@@ -205,6 +1073,27 @@ func generateRandomNumeralString(radix uint32, len int) []uint16 {
 	return out
 }
 
+// generateRandomUint64Domain returns a random radix and a random m such that radix^m fits
+// in a uint64, along with radix^m. Domains close to 2^64 are favoured to exercise the carries.
+func generateRandomUint64Domain() (radix, m uint32, radixM uint64) {
+	radix = (rand.Uint32() % (maxRadixFF1 - minRadixFF1 + 1)) + minRadixFF1
+
+	var maxM uint32 = 1
+	for {
+		if _, fits := radixPowUint64(radix, maxM+1); !fits {
+			break
+		}
+		maxM++
+	}
+
+	m = maxM
+	if rand.Intn(2) == 0 {
+		m = uint32(rand.Intn(int(maxM))) + 1
+	}
+	radixM, _ = radixPowUint64(radix, m)
+	return
+}
+
 // Mock Block Cipher
 type mockBlock struct{}
 
@@ -224,3 +1113,50 @@ func getRandomParameters(keySize, tweakSize, ivSize int) (key, tweak, iv []byte)
 	rand.Read(iv)
 	return
 }
+
+// This test checks that the bit-packing conversions used for power-of-two radices return the
+// same results as the generic ones, for all the power-of-two radices in [2..2^16].
+func TestRadixPow2(t *testing.T) {
+	for k := uint32(1); k <= 16; k++ {
+		var radix = uint32(1) << k
+		var log2, ok = log2Radix(radix)
+		assert.True(t, ok)
+		assert.Equal(t, k, log2)
+
+		for i := 0; i < 100; i++ {
+			var m = uint32(rand.Intn(100) + 1)
+			var x = generateRandomNumeralString(radix, int(m))
+
+			var expected = numRadixGeneric(new(big.Int), x, radix)
+			var result = numRadixPow2(new(big.Int), x, k)
+			assert.Equal(t, 0, expected.Cmp(result))
+
+			assert.Equal(t, x, strMRadixPow2(k, m, result))
+			assert.Equal(t, strMRadixGeneric(radix, m, expected), strMRadixPow2(k, m, numRadixGeneric(new(big.Int), x, radix)))
+		}
+
+		// radix^m is out of range.
+		var m = uint32(10)
+		var radixM = radixPow(radix, m)
+		assert.Panics(t, func() { strMRadixPow2(k, m, radixM) })
+		assert.Panics(t, func() { strMRadixPow2(k, m, big.NewInt(-1)) })
+	}
+
+	for _, radix := range []uint32{0, 3, 10, 26, 65535} {
+		var _, ok = log2Radix(radix)
+		assert.False(t, ok)
+	}
+}
+
+func TestIsDomainLargeEnoughBig(t *testing.T) {
+	for _, radix := range []uint32{2, 3, 10, 36, 255, 256, 65535, 65536} {
+		for _, n := range []int{1, 2, 10, 63, 64, 100} {
+			var domain = DomainSize(radix, n)
+			for _, delta := range []int64{-1, 0, 1} {
+				var min = new(big.Int).Add(domain, big.NewInt(delta))
+				var msg = fmt.Sprintf("radix %d, n %d, delta %d", radix, n, delta)
+				assert.Equal(t, delta <= 0, isDomainLargeEnoughBig(radix, uint64(n), min), msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package fpe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+)
+
+// Mode identifies a format-preserving encryption mode.
+type Mode byte
+
+// The modes that can be stored in a Config.
+const (
+	ModeFF1  Mode = 1
+	ModeFF3  Mode = 2
+	ModeFF31 Mode = 3
+)
+
+// The version of the binary layout of Config.
+const configVersion = 1
+
+// Config holds the non-secret parameters of a cipher: the mode, the radix and the tweak.
+// It does not hold the key, which must be stored separately.
+type Config struct {
+	Mode  Mode
+	Radix uint32
+	Tweak []byte
+}
+
+// MarshalBinary encodes the configuration as
+// [version]1 || [mode]1 || [radix]4 || [len(tweak)]4 || tweak,
+// where the integers are big-endian. The version is 1.
+func (c *Config) MarshalBinary() ([]byte, error) {
+	var out = make([]byte, 10+len(c.Tweak))
+
+	out[0] = configVersion
+	out[1] = byte(c.Mode)
+	binary.BigEndian.PutUint32(out[2:], c.Radix)
+	binary.BigEndian.PutUint32(out[6:], uint32(len(c.Tweak)))
+	copy(out[10:], c.Tweak)
+
+	return out, nil
+}
+
+// UnmarshalBinary decodes a configuration encoded by MarshalBinary. It returns an error if
+// the version or the mode are unknown, or if the length of data does not match the layout.
+// The radix and the tweak are validated when a cipher is built with NewFromConfig.
+func (c *Config) UnmarshalBinary(data []byte) error {
+	if len(data) < 10 {
+		return fmt.Errorf("fpe: config must be at least 10 bytes")
+	}
+	if data[0] != configVersion {
+		return fmt.Errorf("fpe: unknown config version %d", data[0])
+	}
+
+	var mode = Mode(data[1])
+	if mode != ModeFF1 && mode != ModeFF3 && mode != ModeFF31 {
+		return fmt.Errorf("fpe: unknown mode %d", data[1])
+	}
+	var tweakLen = binary.BigEndian.Uint32(data[6:])
+	if uint64(len(data)-10) != uint64(tweakLen) {
+		return fmt.Errorf("fpe: config tweak length %d does not match the data", tweakLen)
+	}
+
+	c.Mode = mode
+	c.Radix = binary.BigEndian.Uint32(data[2:])
+	c.Tweak = dup(data[10:])
+	return nil
+}
+
+// NewFromConfig returns the encrypter and decrypter described by the configuration c, using
+// the given key. The key must be 16, 24 or 32 bytes. For FF3 and FF3-1, it is given in the
+// byte order of the NIST standard (it is reversed internally).
+func NewFromConfig(key []byte, c Config) (cipher.BlockMode, cipher.BlockMode, error) {
+	switch c.Mode {
+	case ModeFF1:
+		return newFF1BlockModes(key, c.Tweak, c.Radix)
+	case ModeFF3:
+		return newFF3BlockModes(key, c.Tweak, c.Radix)
+	case ModeFF31:
+		return newFF31BlockModes(key, c.Tweak, c.Radix)
+	default:
+		return nil, nil, fmt.Errorf("fpe: unknown mode %d", c.Mode)
+	}
+}
+
+// The label of the column keys in the input of the key derivation function.
+const columnKeyLabel = "fpe column key"
+
+// DeriveColumnCipher returns the encrypter and decrypter in the given mode and radix for the
+// database column columnName, under a key derived from masterKey and the column name, so
+// that each column is encrypted under its own key. The master key must be 16, 24 or 32
+// bytes, and the column keys have the same length. The key derivation function is the one of
+// NIST SP 800-108 in counter mode, with AES-CMAC under the master key as PRF, for the label
+// "fpe column key" and the context [mode]1 || columnName: the keys of a column differ for
+// each mode. The tweak is the empty one for FF1 and the all-zero one for FF3 and FF3-1, a
+// per-row tweak may be set with SetTweak.
+func DeriveColumnCipher(masterKey []byte, columnName string, radix uint32, mode Mode) (FPE, FPE, error) {
+	var tweak []byte
+	switch mode {
+	case ModeFF1:
+		tweak = []byte{}
+	case ModeFF3:
+		tweak = make([]byte, tweakLenFF3)
+	case ModeFF31:
+		tweak = make([]byte, tweakLenFF31)
+	default:
+		return nil, nil, fmt.Errorf("fpe: unknown mode %d", mode)
+	}
+
+	var key, err = deriveColumnKey(masterKey, columnName, mode)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer zero(key)
+
+	var encrypter, decrypter cipher.BlockMode
+	if encrypter, decrypter, err = NewFromConfig(key, Config{Mode: mode, Radix: radix, Tweak: tweak}); err != nil {
+		return nil, nil, err
+	}
+	return encrypter.(FPE), decrypter.(FPE), nil
+}
+
+// deriveColumnKey takes a master key, a column name and a mode. It returns the key of the
+// column, of the length of the master key, see DeriveColumnCipher. The i-th block of the key
+// is CMAC(masterKey, [i]1 || label || 0x00 || [mode]1 || columnName || [len(key)*8]4).
+func deriveColumnKey(masterKey []byte, columnName string, mode Mode) ([]byte, error) {
+	if err := validateKeyLen(len(masterKey)); err != nil {
+		return nil, err
+	}
+	var aesBlock, err = aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg = make([]byte, 0, 1+len(columnKeyLabel)+2+len(columnName)+4)
+	msg = append(msg, 0)
+	msg = append(msg, columnKeyLabel...)
+	msg = append(msg, 0, byte(mode))
+	msg = append(msg, columnName...)
+	msg = append(msg, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(msg[len(msg)-4:], uint32(8*len(masterKey)))
+
+	var out = make([]byte, 0, 2*blockSizeFF1)
+	for i := byte(1); len(out) < len(masterKey); i++ {
+		msg[0] = i
+		out = append(out, cmac(aesBlock, msg)...)
+	}
+	return out[:len(masterKey)], nil
+}
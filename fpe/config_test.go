@@ -0,0 +1,175 @@
+package fpe
+
+import (
+	"crypto/aes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestConfigMarshalling(t *testing.T) {
+	var configs = []Config{
+		{ModeFF1, 36, []byte{}},
+		{ModeFF1, maxRadixFF1, make([]byte, 100)},
+		{ModeFF3, 10, []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{ModeFF31, 26, []byte{1, 2, 3, 4, 5, 6, 7}},
+	}
+
+	for _, c := range configs {
+		var data, err = c.MarshalBinary()
+		assert.Nil(t, err)
+
+		var decoded Config
+		assert.Nil(t, decoded.UnmarshalBinary(data))
+		assert.Equal(t, c, decoded)
+	}
+
+	// Stable layout
+	var data, _ = (&Config{ModeFF3, 10, []byte{0xaa, 0xbb}}).MarshalBinary()
+	assert.Equal(t, []byte{1, 2, 0, 0, 0, 10, 0, 0, 0, 2, 0xaa, 0xbb}, data)
+}
+
+func TestConfigUnmarshalErrors(t *testing.T) {
+	var invalid = [][]byte{
+		// Too short
+		{1, 1, 0, 0, 0, 10, 0, 0, 0},
+		// Unknown version
+		{2, 1, 0, 0, 0, 10, 0, 0, 0, 0},
+		{0, 1, 0, 0, 0, 10, 0, 0, 0, 0},
+		// Unknown mode
+		{1, 4, 0, 0, 0, 10, 0, 0, 0, 0},
+		// Tweak length does not match
+		{1, 1, 0, 0, 0, 10, 0, 0, 0, 2, 0xaa},
+		{1, 1, 0, 0, 0, 10, 0, 0, 0, 0, 0xaa},
+	}
+
+	for _, data := range invalid {
+		var c Config
+		assert.NotNil(t, c.UnmarshalBinary(data))
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, tweakLenFF3, 0)
+	var radix uint32 = 10
+	var plaintext = NumeralStringToBytes(generateRandomNumeralString(radix, 10))
+
+	var aesBlock, err = aes.NewCipher(key)
+	assert.Nil(t, err)
+	var revBlock, _ = aes.NewCipher(RevB(key))
+	var cbcMode = NewCBCWithSetIV(aesBlock, make([]byte, blockSizeFF1))
+
+	var tests = []struct {
+		config   Config
+		expected []byte
+	}{
+		{Config{ModeFF1, radix, tweak}, nil},
+		{Config{ModeFF3, radix, tweak}, nil},
+		{Config{ModeFF31, radix, tweak[:tweakLenFF31]}, nil},
+	}
+	tests[0].expected = make([]byte, len(plaintext))
+	NewFF1Encrypter(aesBlock, cbcMode, tweak, radix).CryptBlocks(tests[0].expected, plaintext)
+	tests[1].expected = make([]byte, len(plaintext))
+	NewFF3Encrypter(revBlock, tweak, radix).CryptBlocks(tests[1].expected, plaintext)
+	tests[2].expected = make([]byte, len(plaintext))
+	NewFF31Encrypter(revBlock, tweak[:tweakLenFF31], radix).CryptBlocks(tests[2].expected, plaintext)
+
+	for _, test := range tests {
+		// Round trip through the binary layout.
+		var data, _ = test.config.MarshalBinary()
+		var c Config
+		assert.Nil(t, c.UnmarshalBinary(data))
+
+		var encrypter, decrypter, err = NewFromConfig(key, c)
+		assert.Nil(t, err)
+
+		var result = make([]byte, len(plaintext))
+		encrypter.CryptBlocks(result, plaintext)
+		assert.Equal(t, test.expected, result)
+		decrypter.CryptBlocks(result, result)
+		assert.Equal(t, plaintext, result)
+	}
+
+	// Invalid configurations
+	var invalid = []Config{
+		{Mode(0), radix, tweak},
+		{ModeFF1, 1, tweak},
+		{ModeFF3, radix, tweak[:7]},
+		{ModeFF31, radix, tweak},
+	}
+	for _, c := range invalid {
+		var _, _, err = NewFromConfig(key, c)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestDeriveColumnCipher(t *testing.T) {
+	for _, keySize := range []int{16, 24, 32} {
+		var masterKey, _, _ = getRandomParameters(keySize, 0, 0)
+
+		for _, test := range []struct {
+			mode  Mode
+			radix uint32
+		}{
+			{ModeFF1, 10},
+			{ModeFF3, 10},
+			{ModeFF31, 36},
+		} {
+			var plaintext = NumeralStringToBytes(generateRandomNumeralString(test.radix, 16))
+			var encrypt = func(columnName string) []byte {
+				var encrypter, decrypter, err = DeriveColumnCipher(masterKey, columnName, test.radix, test.mode)
+				assert.Nil(t, err)
+				var ciphertext = make([]byte, len(plaintext))
+				encrypter.CryptBlocks(ciphertext, plaintext)
+				var decrypted = make([]byte, len(plaintext))
+				decrypter.CryptBlocks(decrypted, ciphertext)
+				assert.Equal(t, plaintext, decrypted)
+				return ciphertext
+			}
+
+			// The same column name is deterministic, different ones yield different ciphertexts.
+			var ssn = encrypt("ssn")
+			assert.Equal(t, ssn, encrypt("ssn"))
+			assert.NotEqual(t, ssn, encrypt("phone"))
+			assert.NotEqual(t, ssn, encrypt("SSN"))
+			assert.NotEqual(t, ssn, encrypt(""))
+
+			// The column key has the length of the master key and differs from it.
+			var key, err = deriveColumnKey(masterKey, "ssn", test.mode)
+			assert.Nil(t, err)
+			assert.Len(t, key, keySize)
+			assert.NotEqual(t, masterKey, key)
+		}
+
+		// The keys of a column differ for each mode.
+		var ff1Key, _ = deriveColumnKey(masterKey, "ssn", ModeFF1)
+		var ff3Key, _ = deriveColumnKey(masterKey, "ssn", ModeFF3)
+		assert.NotEqual(t, ff1Key, ff3Key)
+	}
+}
+
+func TestDeriveColumnCipherErrors(t *testing.T) {
+	var masterKey, _, _ = getRandomParameters(ff1DefaultKeySize, 0, 0)
+
+	var tests = []struct {
+		masterKey []byte
+		radix     uint32
+		mode      Mode
+	}{
+		// Invalid master key length
+		{masterKey[:10], 10, ModeFF1},
+		{masterKey[:10], 10, ModeFF3},
+		// Invalid radix
+		{masterKey, maxRadixFF1 + 1, ModeFF1},
+		{masterKey, 1, ModeFF3},
+		// Unknown mode
+		{masterKey, 10, 0},
+		{masterKey, 10, ModeFF31 + 1},
+	}
+
+	for _, test := range tests {
+		var encrypter, decrypter, err = DeriveColumnCipher(test.masterKey, "ssn", test.radix, test.mode)
+		assert.NotNil(t, err)
+		assert.Nil(t, encrypter)
+		assert.Nil(t, decrypter)
+	}
+}
@@ -0,0 +1,146 @@
+package fpe
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// The conversions between numeral strings and integers are done with big.Int by default,
+// whose running time depends on the values. The functions of this file are used instead
+// by the FF1 block modes built with WithConstantTime. They only work on integers that fit
+// in a uint64, and they execute the same operations whatever the values of the numerals:
+// there is no branch and no division depending on them. The radix and the lengths are
+// public, they may change the running time.
+
+// maxUint64Exponent takes an integer radix. It returns the largest m such that radix^m fits
+// in a uint64.
+func maxUint64Exponent(radix uint32) int {
+	var m uint32
+	for {
+		if _, fits := radixPowUint64(radix, m+1); !fits {
+			return int(m)
+		}
+		m++
+	}
+}
+
+// MaxConstantTimeLength takes an integer radix in [2..2^16]. It returns the maximum length
+// of the numeral strings that the FF1 block modes built with WithConstantTime accept, that
+// is the largest n such that radix^ceil(n/2) fits in a uint64: 126 for radix 2, 38 for
+// radix 10 and 6 for radix 2^16.
+func MaxConstantTimeLength(radix uint32) int {
+	if radix < minRadixFF1 || radix > maxRadixFF1 {
+		panic(fmt.Sprintf("MaxConstantTimeLength: radix must be in [%d..%d].", minRadixFF1, maxRadixFF1))
+	}
+	return 2 * maxUint64Exponent(radix)
+}
+
+// ConstantTimeNumRadix takes a numeral string x and an integer radix in [2..2^16]. It
+// returns the number that the numeral string x represents in base radix, as numRadix does,
+// in a time that only depends on the length of x. radix^len(x) must fit in a uint64. It
+// returns an error if the radix or the length are not valid, or if a numeral is not in
+// [0..radix[, without telling which one.
+func ConstantTimeNumRadix(x []uint16, radix uint32) (uint64, error) {
+	if err := validateFF1Radix(radix); err != nil {
+		return 0, err
+	}
+	if max := maxUint64Exponent(radix); len(x) > max {
+		return 0, &ParamError{FieldInputLen, int64(len(x)), 0, int64(max), fmt.Sprintf("radix^len must fit in 64 bits, len must be at most %d", max)}
+	}
+
+	// invalid is set to 1 if a numeral is not in [0..radix[, i.e. if radix - 1 - x[i] < 0.
+	var invalid uint64
+	for i := range x {
+		invalid |= (uint64(radix) - 1 - uint64(x[i])) >> 63
+	}
+	if invalid != 0 {
+		return 0, &ParamError{Field: FieldInput, Msg: "numeral string not valid"}
+	}
+
+	return numRadixUint64(x, radix), nil
+}
+
+// validateConstantTimeLen returns an error if n is above MaxConstantTimeLength(radix).
+func validateConstantTimeLen(radix uint32, n int) error {
+	if max := MaxConstantTimeLength(radix); n > max {
+		return &ParamError{FieldInputLen, int64(n), minInputLenFF1, int64(max), fmt.Sprintf("input length must be at most %d in constant-time mode", max)}
+	}
+	return nil
+}
+
+// selectUint64 returns x if mask is all ones, and y if mask is 0.
+func selectUint64(mask, x, y uint64) uint64 {
+	return y ^ (mask & (x ^ y))
+}
+
+// getCConstantTime is getCEncUint64 if add is true, and getCDecUint64 otherwise, computed in
+// constant time.
+func getCConstantTime(x []uint16, s []byte, radix uint32, radixM uint64, add bool) uint64 {
+	var a, y = numRadixUint64(x, radix), numModConstantTime(s, radixM)
+	if add {
+		return addModConstantTime(a, y, radixM)
+	}
+	return subModConstantTime(a, y, radixM)
+}
+
+// numModConstantTime is numModUint64 in constant time. The bits of x are shifted in one at a
+// time, and the modulus is subtracted with a mask when the remainder exceeds it.
+func numModConstantTime(x []byte, mod uint64) uint64 {
+	var out uint64
+
+	for i := 0; i < len(x); i++ {
+		for j := 7; j >= 0; j-- {
+			// out < mod, so 2 * out + 1 < 2 * mod: one subtraction is enough. hi is the
+			// bit shifted out of the uint64, if it is set the subtraction is needed.
+			var hi = out >> 63
+			out = out<<1 | uint64(x[i]>>uint(j))&1
+			var diff, borrow = bits.Sub64(out, mod, 0)
+			out = selectUint64(-(hi | (borrow ^ 1)), diff, out)
+		}
+	}
+
+	return out
+}
+
+// addModConstantTime is addModUint64 in constant time.
+func addModConstantTime(x, y, mod uint64) uint64 {
+	var sum, carry = bits.Add64(x, y, 0)
+	var diff, borrow = bits.Sub64(sum, mod, 0)
+	return selectUint64(-(carry | (borrow ^ 1)), diff, sum)
+}
+
+// subModConstantTime is subModUint64 in constant time.
+func subModConstantTime(x, y, mod uint64) uint64 {
+	var diff, borrow = bits.Sub64(x, y, 0)
+	return diff + (mod & -borrow)
+}
+
+// divModConstantTime takes the integers x and d, with d in [1..2^16]. It returns x / d and
+// x mod d, computed by long division, one bit of x at a time.
+func divModConstantTime(x uint64, d uint32) (uint64, uint64) {
+	var q, r uint64
+
+	for i := 63; i >= 0; i-- {
+		// r < d, so r stays below 2^17.
+		r = r<<1 | (x>>uint(i))&1
+		var diff, borrow = bits.Sub64(r, uint64(d), 0)
+		var mask = -(borrow ^ 1)
+		r = selectUint64(mask, diff, r)
+		q |= (mask & 1) << uint(i)
+	}
+
+	return q, r
+}
+
+// strMRadixConstantTime is strMRadixUint64 in constant time.
+func strMRadixConstantTime(radix, m uint32, x uint64) []uint16 {
+	var out = make([]uint16, m)
+
+	for i := uint32(0); i < m; i++ {
+		var r uint64
+		x, r = divModConstantTime(x, radix)
+		out[m-i-1] = uint16(r)
+	}
+
+	return out
+}
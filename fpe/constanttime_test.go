@@ -0,0 +1,102 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func TestMaxConstantTimeLength(t *testing.T) {
+	assert.Equal(t, 126, MaxConstantTimeLength(2))
+	assert.Equal(t, 38, MaxConstantTimeLength(10))
+	assert.Equal(t, 6, MaxConstantTimeLength(maxRadixFF1))
+
+	for _, radix := range []uint32{2, 3, 10, 26, 36, 255, 1000, maxRadixFF1} {
+		var max = uint32(MaxConstantTimeLength(radix))
+		var _, fits = radixPowUint64(radix, max/2)
+		assert.True(t, fits)
+		_, fits = radixPowUint64(radix, max/2+1)
+		assert.False(t, fits)
+	}
+
+	assert.Panics(t, func() { MaxConstantTimeLength(1) })
+}
+
+// The constant-time conversions must return the same results as the big.Int ones.
+func TestConstantTimeConversions(t *testing.T) {
+	for _, radix := range []uint32{2, 3, 10, 26, 36, 255, 1000, 4096, maxRadixFF1} {
+		var max = maxUint64Exponent(radix)
+
+		for i := 0; i < 100; i++ {
+			var m = rand.Intn(max + 1)
+			var x = generateRandomNumeralString(radix, m)
+			var radixM, _ = radixPowUint64(radix, uint32(m))
+
+			var n, err = ConstantTimeNumRadix(x, radix)
+			assert.Nil(t, err)
+			assert.Equal(t, numRadix(x, radix).Uint64(), n)
+			assert.Equal(t, x, strMRadixConstantTime(radix, uint32(m), n))
+
+			var s = make([]byte, 16)
+			rand.Read(s)
+			var y = new(big.Int).Mod(new(big.Int).SetBytes(s), new(big.Int).SetUint64(radixM))
+			assert.Equal(t, y.Uint64(), numModConstantTime(s, radixM))
+
+			assert.Equal(t, addModUint64(n, y.Uint64(), radixM), addModConstantTime(n, y.Uint64(), radixM))
+			assert.Equal(t, subModUint64(n, y.Uint64(), radixM), subModConstantTime(n, y.Uint64(), radixM))
+		}
+	}
+
+	// Moduli close to 2^64, where the shifted remainder does not fit in a uint64.
+	var radixM, _ = radixPowUint64(maxRadixFF1-1, 4)
+	var s = []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	var y = new(big.Int).Mod(new(big.Int).SetBytes(s), new(big.Int).SetUint64(radixM))
+	assert.Equal(t, y.Uint64(), numModConstantTime(s, radixM))
+	assert.Equal(t, radixM-2, addModConstantTime(radixM-1, radixM-1, radixM))
+}
+
+func TestConstantTimeNumRadixErrors(t *testing.T) {
+	var _, err = ConstantTimeNumRadix([]uint16{1, 2}, 1)
+	assert.NotNil(t, err)
+	_, err = ConstantTimeNumRadix(make([]uint16, 20), 10)
+	assert.NotNil(t, err)
+	_, err = ConstantTimeNumRadix([]uint16{1, 10, 2}, 10)
+	assert.NotNil(t, err)
+}
+
+// The FF1 block modes built with WithConstantTime must return the same results as the
+// default ones.
+func TestFF1ConstantTime(t *testing.T) {
+	for _, radix := range []uint32{2, 10, 26, 62, maxRadixFF1} {
+		var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+		var encrypter, decrypter, err = NewFF1(key, WithTweak(tweak), WithRadix(radix))
+		assert.Nil(t, err)
+		var ctEncrypter, ctDecrypter cipher.BlockMode
+		ctEncrypter, ctDecrypter, err = NewFF1(key, WithTweak(tweak), WithRadix(radix), WithConstantTime())
+		assert.Nil(t, err)
+
+		var max = MaxConstantTimeLength(radix)
+		for n := MinInputLength(radix); n <= max; n++ {
+			var plaintext = NumeralStringToBytes(generateRandomNumeralString(radix, n))
+			var expected, ciphertext = make([]byte, len(plaintext)), make([]byte, len(plaintext))
+			encrypter.CryptBlocks(expected, plaintext)
+			ctEncrypter.CryptBlocks(ciphertext, plaintext)
+			assert.Equal(t, expected, ciphertext)
+
+			var decrypted, ctDecrypted = make([]byte, len(plaintext)), make([]byte, len(plaintext))
+			decrypter.CryptBlocks(decrypted, ciphertext)
+			ctDecrypter.CryptBlocks(ctDecrypted, ciphertext)
+			assert.Equal(t, plaintext, decrypted)
+			assert.Equal(t, plaintext, ctDecrypted)
+		}
+
+		// Longer inputs are rejected.
+		var tooLong = make([]byte, 2*(max+1))
+		assert.Panics(t, func() { ctEncrypter.CryptBlocks(tooLong, tooLong) })
+		assert.Panics(t, func() { ctDecrypter.CryptBlocks(tooLong, tooLong) })
+		_, err = cryptModeNumerals(ctEncrypter, make([]uint16, max+1))
+		assert.NotNil(t, err)
+	}
+}
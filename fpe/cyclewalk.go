@@ -0,0 +1,32 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"fmt"
+)
+
+// CycleWalk applies the FF1, FF3 or FF3-1 BlockMode mode to the numeral string input until
+// the result satisfies valid, and returns it. It restricts the permutation of the mode to the
+// numeral strings that satisfy valid, e.g. to keep a valid prefix: with an encrypter the
+// result is the ciphertext, and with the matching decrypter, CycleWalk of the ciphertext
+// walks back to input. The input must satisfy valid, so that the walk ends at the latest
+// when it cycles back to input. As the cycle may be long if few numeral strings are valid,
+// an error is returned after maxIterations applications of mode. The input is not modified.
+func CycleWalk(mode cipher.BlockMode, input []uint16, valid func([]uint16) bool, maxIterations int) ([]uint16, error) {
+	if err := checkModeInput(mode, input); err != nil {
+		return nil, err
+	}
+	if !valid(input) {
+		return nil, fmt.Errorf("fpe: input does not satisfy the predicate")
+	}
+
+	var buf = NumeralStringToBytes(input)
+	for i := 0; i < maxIterations; i++ {
+		mode.CryptBlocks(buf, buf)
+		var out = BytesToNumeralString(buf)
+		if valid(out) {
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("fpe: no valid numeral string after %d iterations", maxIterations)
+}
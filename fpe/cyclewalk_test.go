@@ -0,0 +1,62 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCycleWalk(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var ff3Key, ff3Tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var ff1Encrypter, ff1Decrypter, _ = newFF1BlockModes(key, tweak, 10)
+	var ff3Encrypter, ff3Decrypter, _ = newFF3BlockModes(ff3Key, ff3Tweak, 10)
+	var firstDigitNonZero = func(x []uint16) bool { return x[0] != 0 }
+
+	for _, modes := range [][2]cipher.BlockMode{{ff1Encrypter, ff1Decrypter}, {ff3Encrypter, ff3Decrypter}} {
+		for i := 0; i < 200; i++ {
+			var input = generateRandomNumeralString(10, 2+i%10)
+			input[0] = 1 + input[0]%9
+
+			var ciphertext, err = CycleWalk(modes[0], input, firstDigitNonZero, 1000)
+			assert.Nil(t, err)
+			assert.NotEqual(t, uint16(0), ciphertext[0])
+
+			var decrypted []uint16
+			decrypted, err = CycleWalk(modes[1], ciphertext, firstDigitNonZero, 1000)
+			assert.Nil(t, err)
+			assert.Equal(t, input, decrypted)
+		}
+	}
+
+	// With a predicate that is always true, CycleWalk is a single encryption.
+	var input = []uint16{1, 2, 3, 4, 5, 6}
+	var expected = make([]byte, 2*len(input))
+	ff1Encrypter.CryptBlocks(expected, NumeralStringToBytes(input))
+	var result, err = CycleWalk(ff1Encrypter, input, func([]uint16) bool { return true }, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, BytesToNumeralString(expected), result)
+}
+
+func TestCycleWalkErrors(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var encrypter, _, _ = newFF1BlockModes(key, tweak, 10)
+	var input = []uint16{1, 2, 3, 4, 5, 6, 7, 8, 9, 0, 1, 2}
+
+	// The input does not satisfy the predicate.
+	var _, err = CycleWalk(encrypter, []uint16{0, 2, 3, 4}, func(x []uint16) bool { return x[0] != 0 }, 10)
+	assert.NotNil(t, err)
+
+	// Only the input satisfies the predicate, and the cycle is longer than maxIterations.
+	var onlyInput = func(x []uint16) bool { return EqualNumeralStrings(x, input) }
+	_, err = CycleWalk(encrypter, input, onlyInput, 5)
+	assert.NotNil(t, err)
+
+	// No iteration
+	_, err = CycleWalk(encrypter, input, func([]uint16) bool { return true }, 0)
+	assert.NotNil(t, err)
+
+	// Invalid input
+	_, err = CycleWalk(encrypter, []uint16{1}, func([]uint16) bool { return true }, 10)
+	assert.NotNil(t, err)
+}
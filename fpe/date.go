@@ -0,0 +1,66 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"time"
+)
+
+// The number of seconds in a day, in UTC where days have no DST transitions.
+const secondsPerDay = 24 * 60 * 60
+
+// EncryptDate encrypts the date with FF1 and returns another date in the range [min..max].
+// Only the calendar date (year, month and day) of date, min and max is used, the time of
+// day is ignored and the returned date is at midnight in the location of date. The date is
+// mapped to the number of days since min, which is encrypted with FF1 in radix 10 with
+// cycle walking (see EncryptUint64), so that the result stays in the range. The key must be
+// a valid AES key and the length of tweak must be in [0..maxTweakLenFF1].
+func EncryptDate(key, tweak []byte, date, min, max time.Time) (time.Time, error) {
+	return cryptDate(key, tweak, date, min, max, func(enc, _ cipher.BlockMode) cipher.BlockMode { return enc })
+}
+
+// DecryptDate takes a date returned by EncryptDate and returns the original date. The key,
+// tweak, min and max must match the ones used to encrypt it.
+func DecryptDate(key, tweak []byte, date, min, max time.Time) (time.Time, error) {
+	return cryptDate(key, tweak, date, min, max, func(_, dec cipher.BlockMode) cipher.BlockMode { return dec })
+}
+
+func cryptDate(key, tweak []byte, date, min, max time.Time, selectMode func(enc, dec cipher.BlockMode) cipher.BlockMode) (time.Time, error) {
+	var first, last, day = daysSinceEpoch(min), daysSinceEpoch(max), daysSinceEpoch(date)
+	if first > last {
+		return time.Time{}, fmt.Errorf("fpe: min date must not be after max date")
+	}
+	if day < first || day > last {
+		return time.Time{}, fmt.Errorf("fpe: date must be in [%s..%s]", min.Format("2006-01-02"), max.Format("2006-01-02"))
+	}
+
+	var encrypter, decrypter, err = newFF1BlockModes(key, tweak, decimalAlphabet.Radix())
+	if err != nil {
+		return time.Time{}, err
+	}
+	var mode = selectMode(encrypter, decrypter)
+
+	// The offset of the date in the range is written with enough digits for the whole
+	// range, and with at least the minimum length for FF1.
+	var domainSize = uint64(last-first) + 1
+	var n = len(fmt.Sprint(domainSize - 1))
+	if minLen := MinInputLength(decimalAlphabet.Radix()); n < minLen {
+		n = minLen
+	}
+
+	var offset uint64
+	offset, err = cycleWalkUint64(mode, decimalAlphabet.Radix(), uint32(n), uint64(day-first), domainSize)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var y, m, d = time.Unix((first+int64(offset))*secondsPerDay, 0).UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, date.Location()), nil
+}
+
+// daysSinceEpoch returns the number of days between 1970-01-01 and the calendar date of t,
+// in the location of t.
+func daysSinceEpoch(t time.Time) int64 {
+	var y, m, d = t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / secondsPerDay
+}
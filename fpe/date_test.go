@@ -0,0 +1,77 @@
+package fpe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestEncryptDecryptDate(t *testing.T) {
+	var ranges = [][2]time.Time{
+		// Single day
+		{date(2020, 2, 29), date(2020, 2, 29)},
+		// Leap years
+		{date(2020, 1, 1), date(2024, 12, 31)},
+		{date(1900, 1, 1), date(2100, 12, 31)},
+		// Before the Unix epoch
+		{date(1950, 6, 15), date(1969, 12, 31)},
+	}
+
+	for _, r := range ranges {
+		var min, max = r[0], r[1]
+		var days = int(daysSinceEpoch(max)-daysSinceEpoch(min)) + 1
+		for i := 0; i < 50; i++ {
+			var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+			var d = min.AddDate(0, 0, rand.Intn(days))
+
+			var encrypted, err = EncryptDate(key, tweak, d, min, max)
+			assert.Nil(t, err)
+			assert.False(t, encrypted.Before(min))
+			assert.False(t, encrypted.After(max))
+
+			var decrypted time.Time
+			decrypted, err = DecryptDate(key, tweak, encrypted, min, max)
+			assert.Nil(t, err)
+			assert.Equal(t, d, decrypted)
+		}
+	}
+}
+
+func TestEncryptDateIsPermutation(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var min, max = date(2024, 2, 1), date(2024, 3, 31)
+
+	var seen = map[time.Time]bool{}
+	for d := min; !d.After(max); d = d.AddDate(0, 0, 1) {
+		var encrypted, err = EncryptDate(key, tweak, d, min, max)
+		assert.Nil(t, err)
+		assert.False(t, seen[encrypted])
+		seen[encrypted] = true
+	}
+	// 29 days in February 2024 and 31 in March.
+	assert.Equal(t, 60, len(seen))
+}
+
+func TestEncryptDateErrors(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var min, max = date(2020, 1, 1), date(2020, 12, 31)
+
+	// Out of range
+	var _, err = EncryptDate(key, tweak, date(2019, 12, 31), min, max)
+	assert.NotNil(t, err)
+	_, err = DecryptDate(key, tweak, date(2021, 1, 1), min, max)
+	assert.NotNil(t, err)
+
+	// Empty range
+	_, err = EncryptDate(key, tweak, min, max, min)
+	assert.NotNil(t, err)
+
+	// Invalid key
+	_, err = EncryptDate(key[:10], tweak, min, min, max)
+	assert.NotNil(t, err)
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,61 @@
+package fpe
+
+import (
+	"fmt"
+	"strings"
+)
+
+// emailLocalAlphabet holds the characters allowed anywhere in the local part of an email
+// address (the atext of RFC 5322): letters, digits and the printable symbols other than
+// the specials. The dot is not in it, as it may not start or end the local part, nor
+// appear twice in a row, so the dots are left in place instead of being encrypted.
+var emailLocalAlphabet = mustNewAlphabet("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!#$%&'*+-/=?^_`{|}~")
+
+// EncryptEmailLocal encrypts the local part of the email address email, i.e. the part before
+// the @, with FF1 and returns an email address with the same domain. The characters of the
+// local part other than the dots are encrypted together over the letters, digits and symbols
+// allowed by RFC 5322, and the dots are kept at their positions, so the result is also a
+// syntactically valid address. The email must contain exactly one @, and its local part at
+// least 2 characters other than dots. The key must be a valid AES key and the length of
+// tweak must be in [0..maxTweakLenFF1].
+func EncryptEmailLocal(key, tweak []byte, email string) (string, error) {
+	return cryptEmailLocal(key, tweak, email, FF1Encrypt)
+}
+
+// DecryptEmailLocal takes an email address returned by EncryptEmailLocal and returns the
+// original one. The key and tweak must match the ones used to encrypt it.
+func DecryptEmailLocal(key, tweak []byte, email string) (string, error) {
+	return cryptEmailLocal(key, tweak, email, FF1Decrypt)
+}
+
+func cryptEmailLocal(key, tweak []byte, email string, crypt func(key, tweak []byte, radix uint32, input []uint16) ([]uint16, error)) (string, error) {
+	if strings.Count(email, "@") != 1 {
+		return "", fmt.Errorf("fpe: email must contain exactly one @")
+	}
+	var at = strings.Index(email, "@")
+	var parts = strings.Split(email[:at], ".")
+
+	var symbols = strings.Join(parts, "")
+	var numerals, err = emailLocalAlphabet.ToNumerals(symbols)
+	if err != nil {
+		return "", err
+	}
+	if minLen := MinInputLength(emailLocalAlphabet.Radix()); len(numerals) < minLen {
+		return "", fmt.Errorf("fpe: email local part must have at least %d characters other than dots", minLen)
+	}
+
+	if numerals, err = crypt(key, tweak, emailLocalAlphabet.Radix(), numerals); err != nil {
+		return "", err
+	}
+	if symbols, err = emailLocalAlphabet.ToString(numerals); err != nil {
+		return "", err
+	}
+
+	// The symbols are ASCII, so the parts are cut back at the same byte offsets.
+	var j int
+	for i, part := range parts {
+		parts[i] = symbols[j : j+len(part)]
+		j += len(part)
+	}
+	return strings.Join(parts, ".") + email[at:], nil
+}
@@ -0,0 +1,87 @@
+package fpe
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"fmt"
+)
+
+// This example encrypts and decrypts a decimal string with FF1, using the first sample of
+// the NIST test vectors.
+func ExampleNewFF1Encrypter() {
+	var key, _ = hex.DecodeString("2B7E151628AED2A6ABF7158809CF4F3C")
+	var tweak = []byte{}
+	var alphabet, _ = NewAlphabet("0123456789")
+
+	var aesBlock, err = aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	// FF1 requires a CBC mode with a SetIV function, the IV is ignored.
+	var cbcMode = NewCBCWithSetIV(aesBlock, make([]byte, aes.BlockSize))
+	var encrypter = NewFF1Encrypter(aesBlock, cbcMode, tweak, alphabet.Radix())
+	var decrypter = NewFF1Decrypter(aesBlock, cbcMode, tweak, alphabet.Radix())
+
+	// CryptBlocks works on numeral strings, represented as byte strings.
+	var numerals, _ = alphabet.ToNumerals("0123456789")
+	var buf = NumeralStringToBytes(numerals)
+	encrypter.CryptBlocks(buf, buf)
+	var ciphertext, _ = alphabet.ToString(BytesToNumeralString(buf))
+	fmt.Println(ciphertext)
+
+	decrypter.CryptBlocks(buf, buf)
+	var plaintext, _ = alphabet.ToString(BytesToNumeralString(buf))
+	fmt.Println(plaintext)
+	// Output:
+	// 2433477484
+	// 0123456789
+}
+
+// This example encrypts and decrypts a decimal string with FF3, using the first sample of
+// the NIST test vectors.
+func ExampleNewFF3Encrypter() {
+	var key, _ = hex.DecodeString("EF4359D8D580AA4F7F036D6F04FC6A94")
+	var tweak, _ = hex.DecodeString("D8E7920AFA330A73")
+	var alphabet, _ = NewAlphabet("0123456789")
+
+	// The NIST standard requires to reverse the key bytes for FF3.
+	var aesBlock, err = aes.NewCipher(RevB(key))
+	if err != nil {
+		panic(err)
+	}
+	var encrypter = NewFF3Encrypter(aesBlock, tweak, alphabet.Radix())
+	var decrypter = NewFF3Decrypter(aesBlock, tweak, alphabet.Radix())
+
+	var numerals, _ = alphabet.ToNumerals("890121234567890000")
+	var buf = NumeralStringToBytes(numerals)
+	encrypter.CryptBlocks(buf, buf)
+	var ciphertext, _ = alphabet.ToString(BytesToNumeralString(buf))
+	fmt.Println(ciphertext)
+
+	decrypter.CryptBlocks(buf, buf)
+	var plaintext, _ = alphabet.ToString(BytesToNumeralString(buf))
+	fmt.Println(plaintext)
+	// Output:
+	// 750918814058654607
+	// 890121234567890000
+}
+
+// This example encrypts and decrypts a string with FF1Cipher, which builds the AES block
+// and converts the string itself.
+func ExampleFF1Cipher() {
+	var key, _ = hex.DecodeString("2B7E151628AED2A6ABF7158809CF4F3C")
+	var alphabet, _ = Alphabets("decimal")
+
+	var c, err = NewFF1Cipher(key, []byte{}, alphabet)
+	if err != nil {
+		panic(err)
+	}
+
+	var ciphertext, _ = c.EncryptString("0123456789")
+	fmt.Println(ciphertext)
+	var plaintext, _ = c.DecryptString(ciphertext)
+	fmt.Println(plaintext)
+	// Output:
+	// 2433477484
+	// 0123456789
+}
@@ -0,0 +1,148 @@
+package fpe
+
+import (
+	"math/big"
+)
+
+// feistel is the Feistel structure shared by FF1 and FF3. The numeral string X is split
+// into A = X[:u] and B = X[u:], and at each round, one half is replaced by its sum with (or
+// difference from) the output of the round function, modulo radix^m, where m is the length
+// of the half. The modes only differ by their round function, their number of rounds, the
+// value of u, and the order in which the numerals are read (FF3 reverses them).
+type feistel struct {
+	radix  uint32
+	rounds int
+	// reversed is true if the numeral strings are read in reverse order, as in FF3.
+	reversed bool
+	// constantTime is true if the arithmetic must not depend on the values of the numerals,
+	// see WithConstantTime. radix^m must then fit in a uint64 for both halves.
+	constantTime bool
+	// roundFunction takes the round number i and the numeral string x, which is B when
+	// encrypting and A when decrypting. It returns the byte string s, such that y = num(s).
+	roundFunction func(i int, x []uint16) []byte
+}
+
+// encrypt takes a numeral string x and the length u of A. It encrypts x in place.
+func (f *feistel) encrypt(x []uint16, u uint32) {
+	var h = f.newHalves(x, u)
+	var a, b = x[:u], x[u:]
+
+	for i := 0; i < f.rounds; i++ {
+		var m, radixM, fast = h.round(i)
+		f.setC(a, f.roundFunction(i, b), m, radixM, fast, true)
+		a, b = b, a
+	}
+}
+
+// decrypt takes a numeral string x and the length u of A. It decrypts x in place.
+func (f *feistel) decrypt(x []uint16, u uint32) {
+	var h = f.newHalves(x, u)
+	var a, b = x[:u], x[u:]
+	// The rounds are done in place, so with an odd number of rounds the encryption leaves
+	// A in the last numerals.
+	if f.rounds%2 == 1 {
+		a, b = b, a
+	}
+
+	for i := f.rounds - 1; i >= 0; i-- {
+		var m, radixM, fast = h.round(i)
+		f.setC(b, f.roundFunction(i, a), m, radixM, fast, false)
+		a, b = b, a
+	}
+}
+
+// setC takes the numeral string x of length m, the byte string s and radixM = radix^m, which
+// is only used if fast is true. It sets x to str_m(c), where c = (num(x) + num(s)) mod radix^m
+// if add is true, and c = (num(x) - num(s)) mod radix^m otherwise.
+func (f *feistel) setC(x []uint16, s []byte, m uint32, radixM uint64, fast, add bool) {
+	// The numerals are reversed in place, rather than in a copy, and reversed back once x
+	// holds str_m(c). On the uint64 path, c is written to x directly, without allocating.
+	if f.reversed {
+		revInPlace(x)
+	}
+
+	if f.constantTime {
+		copy(x, strMRadixConstantTime(f.radix, m, getCConstantTime(x, s, f.radix, radixM, add)))
+	} else if fast {
+		var c uint64
+		if add {
+			c = getCEncUint64(x, s, f.radix, radixM)
+		} else {
+			c = getCDecUint64(x, s, f.radix, radixM)
+		}
+		strMRadixUint64Into(x, f.radix, c)
+	} else {
+		var y = acquireBigInt().SetBytes(s)
+		var c *big.Int
+		if add {
+			c = getCEnc(x, y, f.radix, m)
+		} else {
+			c = getCDec(x, y, f.radix, m)
+		}
+		copy(x, strMRadix(f.radix, m, c))
+		releaseBigInt(y, c)
+	}
+
+	if f.reversed {
+		revInPlace(x)
+	}
+}
+
+// halves holds the lengths u and v of A and B, radix^u and radix^v, and whether they fit
+// in a uint64.
+type halves struct {
+	u, v           uint32
+	radixU, radixV uint64
+	fastU, fastV   bool
+}
+
+func (f *feistel) newHalves(x []uint16, u uint32) halves {
+	var v = uint32(len(x)) - u
+	var radixU, fastU = radixPowUint64(f.radix, u)
+	var radixV, fastV = radixPowUint64(f.radix, v)
+	return halves{u, v, radixU, radixV, fastU, fastV}
+}
+
+// round takes the round number i. It returns the length m of the half modified by the
+// round, which is u for even rounds and v for odd rounds, radix^m, and whether it fits in
+// a uint64.
+func (h *halves) round(i int) (uint32, uint64, bool) {
+	if i%2 == 0 {
+		return h.u, h.radixU, h.fastU
+	}
+	return h.v, h.radixV, h.fastV
+}
+
+// getCEnc takes a numeral string x, and the integers y, radix and m. It returns
+// c = (numRadix(x, radix) + y) mod radix^m.
+func getCEnc(x []uint16, y *big.Int, radix uint32, m uint32) *big.Int {
+	var c = numRadixInto(acquireBigInt(), x, radix)
+	var radixM = radixPow(radix, m)
+	defer releaseBigInt(radixM)
+	c.Add(c, y)
+	c.Mod(c, radixM)
+	return c
+}
+
+// getCDec takes a numeral string x, and the integers y, radix and m. It returns
+// c = (numRadix(x, radix) - y) mod radix^m.
+func getCDec(x []uint16, y *big.Int, radix uint32, m uint32) *big.Int {
+	var c = numRadixInto(acquireBigInt(), x, radix)
+	var radixM = radixPow(radix, m)
+	defer releaseBigInt(radixM)
+	c.Sub(c, y)
+	c.Mod(c, radixM)
+	return c
+}
+
+// getCEncUint64 is getCEnc for radixM = radix^m fitting in a uint64. It takes the
+// byte string s instead of y = num(s).
+func getCEncUint64(x []uint16, s []byte, radix uint32, radixM uint64) uint64 {
+	return addModUint64(numRadixUint64(x, radix), numModUint64(s, radixM), radixM)
+}
+
+// getCDecUint64 is getCDec for radixM = radix^m fitting in a uint64. It takes the
+// byte string s instead of y = num(s).
+func getCDecUint64(x []uint16, s []byte, radix uint32, radixM uint64) uint64 {
+	return subModUint64(numRadixUint64(x, radix), numModUint64(s, radixM), radixM)
+}
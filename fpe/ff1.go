@@ -4,10 +4,13 @@
 package fpe
 
 import (
+	"crypto/aes"
 	"crypto/cipher"
 	"fmt"
 	"math"
 	"math/big"
+	"math/bits"
+	"sync"
 )
 
 const (
@@ -16,12 +19,15 @@ const (
 	// The tweak length must be in [0..maxTweakLenFF1].
 	minTweakLenFF1 = 0
 	maxTweakLenFF1 = 1 << 16
-	// The radix must be in [2..2^16].
+	// The radix must be in [2..2^16]. The P block has room for a 3-byte radix, but the
+	// NIST standard caps the radix at 2^16.
 	minRadixFF1 = 2
 	maxRadixFF1 = 1 << 16
 	// The numeral string length must be in [2..2^32[.
 	minInputLenFF1 = 2
 	maxInputLenFF1 = (1 << 32) - 1
+	// The domain radix^len must be at least 100.
+	minDomainFF1 = 100
 	// The internal cipher's block size (16 bytes for AES).
 	blockSizeFF1 = 16
 )
@@ -31,27 +37,84 @@ type cbcWithSetIV interface {
 	SetIV([]byte)
 }
 
+// The ff1 struct is never modified by CryptBlocks, which only uses local state, so that
+// a FF1 encrypter or decrypter can be used concurrently by several goroutines. The tweak
+// is guarded by tweakMu, so that it can be rotated with SetTweakAtomic in the meantime.
+// The other setters, SetKey included, must be called between calls of CryptBlocks.
 type ff1 struct {
 	aesBlock cipher.Block
-	cbcMode  cbcWithSetIV
+	tweakMu  sync.RWMutex
 	tweak    []byte
 	radix    uint32
+	rounds   int
+	// roundSchedule is set by the WithFF1RoundSchedule option, it overrides rounds.
+	roundSchedule func(inputLen int) int
+	// constantTime is set by the WithConstantTime option.
+	constantTime bool
+	// minDomain is set by the WithMinDomain option, if nil the minimum domain is 100.
+	minDomain *big.Int
 }
 
-func newFF1(aesBlock cipher.Block, cbcMode cbcWithSetIV, tweak []byte, radix uint32) *ff1 {
+func newFF1(aesBlock cipher.Block, tweak []byte, radix uint32) *ff1 {
 	return &ff1{
 		aesBlock: aesBlock,
-		cbcMode:  cbcMode,
 		tweak:    dup(tweak),
 		radix:    radix,
+		rounds:   roundsFF1,
 	}
 }
 
+// withTweak returns a ff1 with the parameters of x and the given tweak, which is not copied.
+func (x *ff1) withTweak(tweak []byte) *ff1 {
+	return &ff1{
+		aesBlock:      x.aesBlock,
+		tweak:         tweak,
+		radix:         x.radix,
+		rounds:        x.rounds,
+		roundSchedule: x.roundSchedule,
+		constantTime:  x.constantTime,
+		minDomain:     x.minDomain,
+	}
+}
+
+// checkDomain takes an input length n. It returns true if radix^n is at least the minimum
+// domain of x.
+func (x *ff1) checkDomain(n uint64) bool {
+	if x.minDomain == nil {
+		return isDomainLargeEnough(x.radix, n, minDomainFF1)
+	}
+	return isDomainLargeEnoughBig(x.radix, n, x.minDomain)
+}
+
+// minDomainLength returns the smallest input length n >= 2 such that radix^n is at least the
+// minimum domain of x.
+func (x *ff1) minDomainLength() int {
+	var n = minInputLenFF1
+	for !x.checkDomain(uint64(n)) {
+		n++
+	}
+	return n
+}
+
+// getMinDomain returns the minimum domain of x.
+func (x *ff1) getMinDomain() *big.Int {
+	if x.minDomain == nil {
+		return big.NewInt(minDomainFF1)
+	}
+	return x.minDomain
+}
+
 type ff1Encrypter ff1
 
 // NewFF1Encrypter returns a BlockMode which encrypts in FF1 mode, using the given
-// Block and BlockMode. The given block must be AES, the BlockMode must be CBC, the
-// length of tweak must be in [0..maxTweakLenFF1], and the radix must be in [2..2^16].
+// Block and BlockMode. The given block must be AES, the BlockMode must be CBC with a SetIV
+// function (see NewCBCWithSetIV), the length of tweak must be in [0..maxTweakLenFF1], and
+// the radix must be in [2..2^16]. The PRF is computed directly with the block, the
+// BlockMode is only checked for compatibility, so the returned BlockMode is safe for
+// concurrent use. The IV of the BlockMode is ignored: the PRF of FF1 is a CBC-MAC,
+// which always starts from a zero IV. NewFF1EncrypterFromKey and NewFF1DecrypterFromKey
+// do not take a BlockMode at all. The block is only given 16-byte slices to encrypt, and
+// the constructor panics if a self-test shows that it does not behave as a block cipher.
 func NewFF1Encrypter(aesBlock cipher.Block, cbcMode cipher.BlockMode, tweak []byte, radix uint32) cipher.BlockMode {
 	if len(tweak) < minTweakLenFF1 || len(tweak) > maxTweakLenFF1 {
 		panic(fmt.Sprintf("NewFF1Encrypter: tweak must be [%d..%d] bytes.", minTweakLenFF1, maxTweakLenFF1))
@@ -62,64 +125,69 @@ func NewFF1Encrypter(aesBlock cipher.Block, cbcMode cipher.BlockMode, tweak []by
 	if aesBlock.BlockSize() != blockSizeFF1 {
 		panic(fmt.Sprintf("NewFF1Encrypter: block size must be %d bytes.", blockSizeFF1))
 	}
-	var cbcModeWithSetIV, ok = cbcMode.(cbcWithSetIV)
-	if !ok {
+	if !isBlockCipher(aesBlock) {
+		panic("NewFF1Encrypter: block does not behave as a block cipher.")
+	}
+	if _, ok := cbcMode.(cbcWithSetIV); !ok {
 		panic("NewFF1Encrypter: CBC mode must have a SetIV function.")
 	}
-	return (*ff1Encrypter)(newFF1(aesBlock, cbcModeWithSetIV, tweak, radix))
+	return (*ff1Encrypter)(newFF1(aesBlock, tweak, radix))
 }
 
+// CryptBlocks encrypts the numeral string src, represented as a byte string, with FF1 and
+// writes the result to dst. The src is fully read before dst is written, so dst and src
+// may be the same slice for in-place operation, or may overlap in any way. dst is only
+// written once the result is complete, it is left unchanged if CryptBlocks panics.
 func (x *ff1Encrypter) CryptBlocks(dst, src []byte) {
 	var radix = x.radix
-	var tweak = x.tweak
-	var t = uint32(len(tweak))
 
 	// Convert the src byte string to a numeral string. We use this to be compliant with the Go BlockMode interface.
 	var numeralString = BytesToNumeralString(src)
+	// The length is checked before the conversion to uint32, which would truncate it.
+	if len(numeralString) < minInputLenFF1 || uint64(len(numeralString)) > maxInputLenFF1 {
+		panic(fmt.Sprintf("FF1Encrypter/CryptBlocks: src length must be in [%d..%d].", minInputLenFF1, uint64(maxInputLenFF1)))
+	}
 	var n = uint32(len(numeralString))
-
-	if n < minInputLenFF1 || n > maxInputLenFF1 {
-		panic(fmt.Sprintf("FF1Encrypter/CryptBlocks: src length must be in [%d..%d].", minInputLenFF1, maxInputLenFF1))
+	if !(*ff1)(x).checkDomain(uint64(n)) {
+		panic(fmt.Sprintf("FF1Encrypter/CryptBlocks: radix^len < %v.", (*ff1)(x).getMinDomain()))
 	}
-	if math.Pow(float64(radix), float64(n)) < 100 {
-		panic("FF1Encrypter/CryptBlocks: radix^len < 100.")
+	if x.constantTime && int(n) > MaxConstantTimeLength(radix) {
+		panic(fmt.Sprintf("FF1Encrypter/CryptBlocks: src length must be at most %d in constant-time mode.", MaxConstantTimeLength(radix)))
 	}
 	if len(dst) != len(src) {
 		panic("FF1Encrypter/CryptBlocks: src and dst size must be equal.")
 	}
-	if !isNumeralStringValid(numeralString, radix) {
-		panic("FF1Encrypter/CryptBlocks: numeral string not valid.")
+	if i := FirstInvalidNumeral(numeralString, radix); i != -1 {
+		panic(fmt.Sprintf("FF1Encrypter/CryptBlocks: numeral %d (value %d) exceeds radix %d.", i, numeralString[i], radix))
 	}
 
-	var u = uint32(math.Floor(float64(n) / 2))
-	var v = uint32(n) - u
-	var a = numeralString[:u]
-	var b = numeralString[u:]
-	var beta = getFF1B(v, radix)
-	var d = getFF1D(beta)
-	var p = getFF1P(radix, u, n, t)
-
-	for i := 0; i < roundsFF1; i++ {
-		var q = getFF1Q(tweak, radix, beta, i, b)
-		var r = prf(x.cbcMode, append(p, q...))
-		var s = getFF1S(x.aesBlock, r, d)
-		var y = num(s)
-
-		var m uint32
-		if i%2 == 0 {
-			m = u
-		} else {
-			m = v
-		}
+	x.cryptNumerals(numeralString)
 
-		var c = getFF1CEnc(a, y, radix, m)
-		copy(a, strMRadix(radix, m, c))
-		a, b = b, a
-	}
 	// Convert the numeral string to a byte string. We use this to be compliant with the Go BlockMode interface.
 	copy(dst, NumeralStringToBytes(numeralString))
 }
 
+// cryptNumerals encrypts the numeral string numeralString in place. It must be a valid input,
+// as checked by CryptBlocks.
+func (x *ff1Encrypter) cryptNumerals(numeralString []uint16) {
+	var n = uint32(len(numeralString))
+	var u = uint32(math.Floor(float64(n) / 2))
+	var rounds = getFF1Rounds(x.rounds, x.roundSchedule, int(n))
+	var f = newFF1Feistel(x.aesBlock, x.getTweakAtomic(), x.radix, rounds, u, n)
+	f.constantTime = x.constantTime
+	f.encrypt(numeralString, u)
+}
+
+// CryptBlocksWithTweak is CryptBlocks, but it uses tweak instead of the tweak of x for this
+// call only. The tweak of x is not modified, so that concurrent calls may use different
+// tweaks. The length of tweak must be in [0..maxTweakLenFF1].
+func (x *ff1Encrypter) CryptBlocksWithTweak(dst, src, tweak []byte) {
+	if len(tweak) < minTweakLenFF1 || len(tweak) > maxTweakLenFF1 {
+		panic(fmt.Sprintf("FF1Encrypter/CryptBlocksWithTweak: tweak must be [%d..%d] bytes.", minTweakLenFF1, maxTweakLenFF1))
+	}
+	(*ff1Encrypter)((*ff1)(x).withTweak(tweak)).CryptBlocks(dst, src)
+}
+
 func (x *ff1Encrypter) BlockSize() int {
 	return blockSizeFF1
 }
@@ -128,7 +196,27 @@ func (x *ff1Encrypter) SetTweak(tweak []byte) {
 	if len(tweak) < minTweakLenFF1 || len(tweak) > maxTweakLenFF1 {
 		panic(fmt.Sprintf("FF1Encrypter/SetTweak: tweak must be [%d..%d] bytes.", minTweakLenFF1, maxTweakLenFF1))
 	}
-	copy(x.tweak, tweak)
+	// The FF1 tweak length is variable, so the tweak is replaced rather than overwritten.
+	x.tweak = dup(tweak)
+}
+
+// SetTweakAtomic replaces the tweak as SetTweak does, but it is safe to call while other
+// goroutines run CryptBlocks: each call of CryptBlocks uses either the old or the new
+// tweak, never a partially updated one.
+func (x *ff1Encrypter) SetTweakAtomic(tweak []byte) {
+	if len(tweak) < minTweakLenFF1 || len(tweak) > maxTweakLenFF1 {
+		panic(fmt.Sprintf("FF1Encrypter/SetTweakAtomic: tweak must be [%d..%d] bytes.", minTweakLenFF1, maxTweakLenFF1))
+	}
+	var t = dup(tweak)
+	x.tweakMu.Lock()
+	x.tweak = t
+	x.tweakMu.Unlock()
+}
+
+func (x *ff1Encrypter) getTweakAtomic() []byte {
+	x.tweakMu.RLock()
+	defer x.tweakMu.RUnlock()
+	return x.tweak
 }
 
 func (x *ff1Encrypter) SetRadix(radix uint32) {
@@ -138,11 +226,54 @@ func (x *ff1Encrypter) SetRadix(radix uint32) {
 	x.radix = radix
 }
 
+// SetKey replaces the AES block with a new one built from key, which must be 16, 24 or
+// 32 bytes. The CBC mode given to the constructor is not used to compute the PRF, so it
+// does not need to be rebuilt.
+func (x *ff1Encrypter) SetKey(key []byte) error {
+	if err := validateKeyLen(len(key)); err != nil {
+		return err
+	}
+	var aesBlock, err = aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	x.aesBlock = aesBlock
+	return nil
+}
+
+func (x *ff1Encrypter) GetTweak() []byte {
+	return dup(x.getTweakAtomic())
+}
+
+func (x *ff1Encrypter) GetRadix() uint32 {
+	return x.radix
+}
+
+// NumRounds takes the length of an input numeral string. It returns the number of Feistel
+// rounds x uses for it: 10 by default, or the number set with WithRounds, or the one returned
+// by the WithFF1RoundSchedule schedule. It panics, as CryptBlocks would, if the schedule
+// returns a number of rounds out of [1..256].
+func (x *ff1Encrypter) NumRounds(inputLen int) int {
+	return getFF1Rounds(x.rounds, x.roundSchedule, inputLen)
+}
+
+// Reset zeroes the tweak. It does not clear the key schedule held by the AES block,
+// nor the radix. The scratch buffers used by CryptBlocks are local to each call and
+// are not retained.
+func (x *ff1Encrypter) Reset() {
+	zero(x.tweak)
+}
+
 type ff1Decrypter ff1
 
 // NewFF1Decrypter returns a BlockMode which decrypts in FF1 mode, using the given
-// Block and BlockMode. The given block must be AES, the BlockMode must be CBC, the
-// tweak must match the tweak used to encrypt the data, and the radix must be in [2..2^16].
+// Block and BlockMode. The given block must be AES, the BlockMode must be CBC with a SetIV
+// function (see NewCBCWithSetIV), the tweak must match the tweak used to encrypt the data,
+// and the radix must be in [2..2^16]. The PRF is computed directly with the block, the
+// BlockMode is only checked for compatibility, so the returned BlockMode is safe for
+// concurrent use. The IV of the BlockMode is ignored: the PRF of FF1 is a CBC-MAC,
+// which always starts from a zero IV. NewFF1EncrypterFromKey and NewFF1DecrypterFromKey
+// do not take a BlockMode at all.
 func NewFF1Decrypter(aesBlock cipher.Block, cbcMode cipher.BlockMode, tweak []byte, radix uint32) cipher.BlockMode {
 	if len(tweak) < minTweakLenFF1 || len(tweak) > maxTweakLenFF1 {
 		panic(fmt.Sprintf("NewFF1Decrypter: tweak must be [%d..%d] bytes.", minTweakLenFF1, maxTweakLenFF1))
@@ -153,64 +284,69 @@ func NewFF1Decrypter(aesBlock cipher.Block, cbcMode cipher.BlockMode, tweak []by
 	if aesBlock.BlockSize() != blockSizeFF1 {
 		panic(fmt.Sprintf("NewFF1Decrypter: block size must be %d bytes.", blockSizeFF1))
 	}
-	var cbcModeWithSetIV, ok = cbcMode.(cbcWithSetIV)
-	if !ok {
+	if !isBlockCipher(aesBlock) {
+		panic("NewFF1Decrypter: block does not behave as a block cipher.")
+	}
+	if _, ok := cbcMode.(cbcWithSetIV); !ok {
 		panic("NewFF1Decrypter: CBC mode must have a SetIV function.")
 	}
-	return (*ff1Decrypter)(newFF1(aesBlock, cbcModeWithSetIV, tweak, radix))
+	return (*ff1Decrypter)(newFF1(aesBlock, tweak, radix))
 }
 
+// CryptBlocks decrypts the numeral string src, represented as a byte string, with FF1 and
+// writes the result to dst. The src is fully read before dst is written, so dst and src
+// may be the same slice for in-place operation, or may overlap in any way. dst is only
+// written once the result is complete, it is left unchanged if CryptBlocks panics.
 func (x *ff1Decrypter) CryptBlocks(dst, src []byte) {
 	var radix = x.radix
-	var tweak = x.tweak
-	var t = uint32(len(tweak))
 
 	// Convert the src byte string to a numeral string. We use this to be compliant with the Go BlockMode interface.
 	var numeralString = BytesToNumeralString(src)
+	// The length is checked before the conversion to uint32, which would truncate it.
+	if len(numeralString) < minInputLenFF1 || uint64(len(numeralString)) > maxInputLenFF1 {
+		panic(fmt.Sprintf("FF1Decrypter/CryptBlocks: src length must be in [%d..%d].", minInputLenFF1, uint64(maxInputLenFF1)))
+	}
 	var n = uint32(len(numeralString))
-
-	if n < minInputLenFF1 || n > maxInputLenFF1 {
-		panic(fmt.Sprintf("FF1Decrypter/CryptBlocks: src length must be in [%d..%d].", minInputLenFF1, maxInputLenFF1))
+	if !(*ff1)(x).checkDomain(uint64(n)) {
+		panic(fmt.Sprintf("FF1Decrypter/CryptBlocks: radix^len < %v.", (*ff1)(x).getMinDomain()))
 	}
-	if math.Pow(float64(radix), float64(n)) < 100 {
-		panic("FF1Decrypter/CryptBlocks: radix^len < 100.")
+	if x.constantTime && int(n) > MaxConstantTimeLength(radix) {
+		panic(fmt.Sprintf("FF1Decrypter/CryptBlocks: src length must be at most %d in constant-time mode.", MaxConstantTimeLength(radix)))
 	}
 	if len(dst) != len(src) {
 		panic("FF1Decrypter/CryptBlocks: src and dst size must be equal.")
 	}
-	if !isNumeralStringValid(numeralString, radix) {
-		panic("FF1Decrypter/CryptBlocks: numeral string not valid.")
+	if i := FirstInvalidNumeral(numeralString, radix); i != -1 {
+		panic(fmt.Sprintf("FF1Decrypter/CryptBlocks: numeral %d (value %d) exceeds radix %d.", i, numeralString[i], radix))
 	}
 
-	var u = uint32(math.Floor(float64(n) / 2))
-	var v = uint32(n) - u
-	var a = numeralString[:u]
-	var b = numeralString[u:]
-	var beta = getFF1B(v, radix)
-	var d = getFF1D(beta)
-	var p = getFF1P(radix, u, n, t)
-
-	for i := roundsFF1 - 1; i >= 0; i-- {
-		var q = getFF1Q(tweak, radix, beta, i, a)
-		var r = prf(x.cbcMode, append(p, q...))
-		var s = getFF1S(x.aesBlock, r, d)
-		var y = num(s)
-
-		var m uint32
-		if i%2 == 0 {
-			m = u
-		} else {
-			m = v
-		}
+	x.cryptNumerals(numeralString)
 
-		var c = getFF1CDec(b, y, radix, m)
-		copy(b, strMRadix(radix, m, c))
-		a, b = b, a
-	}
 	// Convert the numeral string to a byte string. We use this to be compliant with the Go BlockMode interface.
 	copy(dst, NumeralStringToBytes(numeralString))
 }
 
+// cryptNumerals decrypts the numeral string numeralString in place. It must be a valid input,
+// as checked by CryptBlocks.
+func (x *ff1Decrypter) cryptNumerals(numeralString []uint16) {
+	var n = uint32(len(numeralString))
+	var u = uint32(math.Floor(float64(n) / 2))
+	var rounds = getFF1Rounds(x.rounds, x.roundSchedule, int(n))
+	var f = newFF1Feistel(x.aesBlock, x.getTweakAtomic(), x.radix, rounds, u, n)
+	f.constantTime = x.constantTime
+	f.decrypt(numeralString, u)
+}
+
+// CryptBlocksWithTweak is CryptBlocks, but it uses tweak instead of the tweak of x for this
+// call only. The tweak of x is not modified, so that concurrent calls may use different
+// tweaks. The length of tweak must be in [0..maxTweakLenFF1].
+func (x *ff1Decrypter) CryptBlocksWithTweak(dst, src, tweak []byte) {
+	if len(tweak) < minTweakLenFF1 || len(tweak) > maxTweakLenFF1 {
+		panic(fmt.Sprintf("FF1Decrypter/CryptBlocksWithTweak: tweak must be [%d..%d] bytes.", minTweakLenFF1, maxTweakLenFF1))
+	}
+	(*ff1Decrypter)((*ff1)(x).withTweak(tweak)).CryptBlocks(dst, src)
+}
+
 func (x *ff1Decrypter) BlockSize() int {
 	return blockSizeFF1
 }
@@ -219,7 +355,27 @@ func (x *ff1Decrypter) SetTweak(tweak []byte) {
 	if len(tweak) < minTweakLenFF1 || len(tweak) > maxTweakLenFF1 {
 		panic(fmt.Sprintf("FF1Decrypter/SetTweak: tweak must be [%d..%d] bytes.", minTweakLenFF1, maxTweakLenFF1))
 	}
-	copy(x.tweak, tweak)
+	// The FF1 tweak length is variable, so the tweak is replaced rather than overwritten.
+	x.tweak = dup(tweak)
+}
+
+// SetTweakAtomic replaces the tweak as SetTweak does, but it is safe to call while other
+// goroutines run CryptBlocks: each call of CryptBlocks uses either the old or the new
+// tweak, never a partially updated one.
+func (x *ff1Decrypter) SetTweakAtomic(tweak []byte) {
+	if len(tweak) < minTweakLenFF1 || len(tweak) > maxTweakLenFF1 {
+		panic(fmt.Sprintf("FF1Decrypter/SetTweakAtomic: tweak must be [%d..%d] bytes.", minTweakLenFF1, maxTweakLenFF1))
+	}
+	var t = dup(tweak)
+	x.tweakMu.Lock()
+	x.tweak = t
+	x.tweakMu.Unlock()
+}
+
+func (x *ff1Decrypter) getTweakAtomic() []byte {
+	x.tweakMu.RLock()
+	defer x.tweakMu.RUnlock()
+	return x.tweak
 }
 
 func (x *ff1Decrypter) SetRadix(radix uint32) {
@@ -229,20 +385,170 @@ func (x *ff1Decrypter) SetRadix(radix uint32) {
 	x.radix = radix
 }
 
+// SetKey replaces the AES block with a new one built from key, which must be 16, 24 or
+// 32 bytes. The CBC mode given to the constructor is not used to compute the PRF, so it
+// does not need to be rebuilt.
+func (x *ff1Decrypter) SetKey(key []byte) error {
+	if err := validateKeyLen(len(key)); err != nil {
+		return err
+	}
+	var aesBlock, err = aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	x.aesBlock = aesBlock
+	return nil
+}
+
+func (x *ff1Decrypter) GetTweak() []byte {
+	return dup(x.getTweakAtomic())
+}
+
+func (x *ff1Decrypter) GetRadix() uint32 {
+	return x.radix
+}
+
+// NumRounds takes the length of an input numeral string. It returns the number of Feistel
+// rounds x uses for it: 10 by default, or the number set with WithRounds, or the one returned
+// by the WithFF1RoundSchedule schedule. It panics, as CryptBlocks would, if the schedule
+// returns a number of rounds out of [1..256].
+func (x *ff1Decrypter) NumRounds(inputLen int) int {
+	return getFF1Rounds(x.rounds, x.roundSchedule, inputLen)
+}
+
+// Reset zeroes the tweak. It does not clear the key schedule held by the AES block,
+// nor the radix. The scratch buffers used by CryptBlocks are local to each call and
+// are not retained.
+func (x *ff1Decrypter) Reset() {
+	zero(x.tweak)
+}
+
+// NumRoundsFF1 takes the length of an input numeral string. It returns the number of Feistel
+// rounds of the NIST standard for it, which is 10 for every length. The block modes built
+// with the WithRounds or WithFF1RoundSchedule options may use another number of rounds, which
+// the NumRounds method of the FF1 encrypters and decrypters returns.
+func NumRoundsFF1(inputLen int) int {
+	return roundsFF1
+}
+
+// MaxInputLengthFF1 returns the maximum length of a numeral string that FF1 accepts. It
+// does not depend on the radix.
+func MaxInputLengthFF1() uint64 {
+	return maxInputLenFF1
+}
+
+// newFF1Feistel takes an AES block, a byte string tweak, the integers radix, rounds, u and n.
+// It returns the Feistel structure of FF1 for inputs of length n, split at u. The round
+// function allocates the PRF input p || q and its buffers once, only the round number and
+// the numeral string change in q from a round to another.
+func newFF1Feistel(aesBlock cipher.Block, tweak []byte, radix uint32, rounds int, u, n uint32) *feistel {
+	var rf = newFF1RoundFunction(tweak, radix, u, n)
+	rf.setKey(aesBlock, tweak)
+
+	return &feistel{
+		radix:         radix,
+		rounds:        rounds,
+		roundFunction: rf.round,
+	}
+}
+
+// ff1RoundFunction holds the PRF input p || q of the FF1 round function for inputs of a given
+// length and tweak length, and the buffers of the round outputs. Only the last 1 + beta bytes
+// of q change between rounds. The blocks before them hold the tweak and the padding, so the
+// CBC-MAC of p and of these blocks is computed once by setKey, and each round only chains the
+// remaining blocks of q.
+type ff1RoundFunction struct {
+	aesBlock cipher.Block
+	radix    uint32
+	beta, d  uint64
+	fixedLen uint64
+	p, q     []byte
+	fixedMAC []byte
+	r, sBuf  []byte
+}
+
+// newFF1RoundFunction takes a byte string tweak and the integers radix, u and n. It returns
+// the round function of FF1 for inputs of length n, split at u, and tweaks of the length of
+// tweak. setKey must be called before round.
+func newFF1RoundFunction(tweak []byte, radix uint32, u, n uint32) *ff1RoundFunction {
+	var beta = getFF1B(n-u, radix)
+	var d = getFF1D(beta)
+	var q = getFF1Q(tweak, radix, beta, 0, nil)
+
+	return &ff1RoundFunction{
+		radix:    radix,
+		beta:     beta,
+		d:        d,
+		fixedLen: (uint64(len(q)) - beta - 1) / blockSizeFF1 * blockSizeFF1,
+		p:        getFF1P(radix, u, n, uint32(len(tweak))),
+		q:        q,
+		fixedMAC: make([]byte, blockSizeFF1),
+		r:        make([]byte, blockSizeFF1),
+		sBuf:     make([]byte, getFF1SLen(d)),
+	}
+}
+
+// setKey takes an AES block and a byte string tweak, of the length given to newFF1RoundFunction.
+// It copies the tweak in q and computes the CBC-MAC of its fixed blocks, without allocating.
+func (rf *ff1RoundFunction) setKey(aesBlock cipher.Block, tweak []byte) {
+	rf.aesBlock = aesBlock
+	copy(rf.q, tweak)
+	zero(rf.fixedMAC)
+	cbcMACUpdate(aesBlock, rf.fixedMAC, rf.p)
+	cbcMACUpdate(aesBlock, rf.fixedMAC, rf.q[:rf.fixedLen])
+}
+
+// round takes the round number i and the numeral string x. It returns the byte string s of
+// the round, which is only valid until the next call.
+func (rf *ff1RoundFunction) round(i int, x []uint16) []byte {
+	setFF1Q(rf.q, rf.radix, rf.beta, i, x)
+	copy(rf.r, rf.fixedMAC)
+	cbcMACUpdate(rf.aesBlock, rf.r, rf.q[rf.fixedLen:])
+	return getFF1SWithBuffer(rf.aesBlock, rf.sBuf, rf.r, rf.d)
+}
+
 // getFF1B takes an integer v and an integer radix. It returns b = ceil(ceil(v * log2(radix)) / 8).
 func getFF1B(v, radix uint32) uint64 {
-	return uint64(math.Ceil(math.Ceil(float64(v)*math.Log2(float64(radix))) / 8))
+	return (ceilLog2Pow(radix, v) + 7) / 8
+}
+
+// ceilLog2Pow takes the integers radix and v. It returns ceil(v * log2(radix)), the bit length
+// of radix^v - 1, computed exactly. For large v, v * log2(radix) may be so close to an integer
+// that the float64 rounding errors change its ceiling, so the float64 result is only used if
+// it is far enough from an integer, and radix^v is computed otherwise.
+func ceilLog2Pow(radix, v uint32) uint64 {
+	if k, ok := log2Radix(radix); ok {
+		return uint64(v) * uint64(k)
+	}
+	if radixV, fits := radixPowUint64(radix, v); fits {
+		return uint64(bits.Len64(radixV - 1))
+	}
+
+	// The relative error of the product is a few ulps, i.e. about 2^-52.
+	var f = float64(v) * math.Log2(float64(radix))
+	if math.Abs(f-math.Round(f)) > f/(1<<40) {
+		return uint64(math.Ceil(f))
+	}
+
+	var radixV = radixPow(radix, v)
+	defer releaseBigInt(radixV)
+	return uint64(radixV.Sub(radixV, big.NewInt(1)).BitLen())
 }
 
 // getFF1D takes an integer beta. It returns d = 4 * ceil(beta / 4) + 4.
 func getFF1D(beta uint64) uint64 {
-	return uint64(4*math.Ceil(float64(beta)/4) + 4)
+	return 4*((beta+3)/4) + 4
 }
 
 // getFF1P takes the integers radix, u, n, and t. It returns the byte string
 // p = [1]1 || [2]1 || [1]1 || [radix]3 || [10]1 || [u mod 256]1 || [n]4 || [t]4,
-// where [x]y means x represented as a string of s bytes.
+// where [x]y means x represented as a string of s bytes. The radix must fit in 3 bytes, n
+// and t fit in 4 bytes by their type, and only u mod 256 is encoded, as in the standard.
 func getFF1P(radix, u, n, t uint32) []byte {
+	if radix >= 1<<24 {
+		panic("getFF1P: radix must fit in 3 bytes.")
+	}
+
 	var p = make([]byte, blockSizeFF1)
 
 	p[0], p[1], p[2] = 1, 2, 1
@@ -267,21 +573,55 @@ func getFF1Q(tweak []byte, radix uint32, b uint64, i int, x []uint16) []byte {
 	var lenQ = t + z + 1 + b
 	var q = make([]byte, lenQ)
 	copy(q, tweak)
-	q[t+z] = byte(i)
-	copy(q[t+z+1:], getAsBBytes(numRadix(x, radix), b))
+	setFF1Q(q, radix, b, i, x)
 	return q
 }
 
-// prf takes a CBC mode and a byte string x. It encipher x with CBC and returns the final block of the ciphertext.
-func prf(cbcMode cbcWithSetIV, x []byte) []byte {
-	var l = len(x)
-	var ciphertext = make([]byte, l)
-	cbcMode.SetIV(make([]byte, blockSizeFF1))
+// setFF1Q takes a byte string q = tweak || [0](-t-b-1) mod 16 || [.]1 || [.]b, the integers radix,
+// beta, i, and the numeral string x. It sets the last 1 + b bytes of q to [i]1 || [numRadix(x, radix)]b.
+// This lets the Feistel rounds reuse the same q, as the tweak part does not change between rounds.
+func setFF1Q(q []byte, radix uint32, b uint64, i int, x []uint16) {
+	var l = uint64(len(q))
+	q[l-b-1] = byte(i)
+
+	var numBytes = q[l-b:]
+	if _, fits := radixPowUint64(radix, uint32(len(x))); fits {
+		var c = numRadixUint64(x, radix)
+		for j := len(numBytes) - 1; j >= 0; j-- {
+			numBytes[j] = byte(c)
+			c >>= 8
+		}
+	} else {
+		var y = numRadixInto(acquireBigInt(), x, radix)
+		copy(numBytes, getAsBBytes(y, b))
+		releaseBigInt(y)
+	}
+}
 
-	cbcMode.CryptBlocks(ciphertext, x)
+// prf takes an AES block and the byte strings xs, whose lengths are multiples of the block
+// size. It returns the final block of the encryption of the concatenation of xs with CBC and
+// a zero IV (i.e. CBC-MAC). The byte strings are consumed in turn, without concatenating them.
+func prf(aesBlock cipher.Block, xs ...[]byte) []byte {
+	var out = make([]byte, blockSizeFF1)
+	for _, x := range xs {
+		cbcMACUpdate(aesBlock, out, x)
+	}
+	return out
+}
 
-	// return last block
-	return ciphertext[l-blockSizeFF1:]
+// cbcMACUpdate takes an AES block, the block-sized chaining value buf of a CBC-MAC and a byte
+// string x, whose length is a multiple of the block size. It sets buf to the chaining value
+// after the blocks of x. The chaining is done in buf rather than in a shared CBC mode, so that
+// concurrent calls do not interfere. As everywhere in this package, the slice given to
+// Encrypt has a capacity of exactly one block, so that the block cannot write past it.
+func cbcMACUpdate(aesBlock cipher.Block, buf, x []byte) {
+	buf = buf[:blockSizeFF1:blockSizeFF1]
+	for i := 0; i < len(x); i += blockSizeFF1 {
+		for j := 0; j < blockSizeFF1; j++ {
+			buf[j] ^= x[i+j]
+		}
+		aesBlock.Encrypt(buf, buf)
+	}
 }
 
 // getFF1S takes an AES Block, a byte string r and an integer d. It returns the first d bytes of
@@ -289,37 +629,30 @@ func prf(cbcMode cbcWithSetIV, x []byte) []byte {
 // r || aes.Encrypt(r xor [1]16) || aes.Encrypt(r xor [2]16) || ... || aes.Encrypt(r xor [ceil(d / 16) - 1]16),
 // where [x]y means x represented as a string of s bytes.
 func getFF1S(aesBlock cipher.Block, r []byte, d uint64) []byte {
-	var nbrBlocks = uint64(math.Ceil(float64(d) / blockSizeFF1))
-	var s = make([]byte, blockSizeFF1*nbrBlocks)
+	return getFF1SWithBuffer(aesBlock, make([]byte, getFF1SLen(d)), r, d)
+}
 
-	copy(s, r)
+// getFF1SLen takes an integer d. It returns the length of the buffer needed by getFF1SWithBuffer,
+// that is 16 * ceil(d / 16).
+func getFF1SLen(d uint64) uint64 {
+	return blockSizeFF1 * uint64(math.Ceil(float64(d)/blockSizeFF1))
+}
+
+// getFF1SWithBuffer is getFF1S, using buf, of length getFF1SLen(d), to store s. The byte
+// string r must not overlap buf.
+func getFF1SWithBuffer(aesBlock cipher.Block, buf, r []byte, d uint64) []byte {
+	var nbrBlocks = uint64(len(buf)) / blockSizeFF1
+
+	copy(buf, r)
 	for i := uint64(1); i < nbrBlocks; i++ {
-		var enc = make([]byte, blockSizeFF1)
+		var enc = buf[blockSizeFF1*i : blockSizeFF1*(i+1) : blockSizeFF1*(i+1)]
+		for j := range enc {
+			enc[j] = 0
+		}
 		enc[0], enc[1], enc[2], enc[3] = byte(i), byte(i>>8), byte(i>>16), byte(i>>24)
 		xorBytes(enc, enc, r)
 		aesBlock.Encrypt(enc, enc)
-		copy(s[blockSizeFF1*i:], enc)
 	}
 
-	return s[:d]
-}
-
-// getFF1CEnc takes a numeral string x, and the integers y, radix and m. It returns
-// c = (numRadix(x, radix) + y) mod radix^m.
-func getFF1CEnc(x []uint16, y *big.Int, radix uint32, m uint32) *big.Int {
-	var c = numRadix(x, radix)
-	var radixM = big.NewInt(0).Exp(big.NewInt(int64(radix)), big.NewInt(int64(m)), nil)
-	c.Add(c, y)
-	c.Mod(c, radixM)
-	return c
-}
-
-// getFF1CDec takes a numeral string x, and the integers y, radix and m. It returns
-// c = (numRadix(x, radix) - y) mod radix^m.
-func getFF1CDec(x []uint16, y *big.Int, radix uint32, m uint32) *big.Int {
-	var c = numRadix(x, radix)
-	var radixM = big.NewInt(0).Exp(big.NewInt(int64(radix)), big.NewInt(int64(m)), nil)
-	c.Sub(c, y)
-	c.Mod(c, radixM)
-	return c
+	return buf[:d]
 }
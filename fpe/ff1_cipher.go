@@ -0,0 +1,241 @@
+package fpe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+)
+
+// FF1Cipher encrypts and decrypts strings over an alphabet with FF1. It builds
+// the AES block and the CBC mode internally, so the caller only provides the key.
+type FF1Cipher struct {
+	encrypter cipher.BlockMode
+	decrypter cipher.BlockMode
+	alphabet  *Alphabet
+}
+
+// NewFF1Cipher returns a FF1Cipher using the given key, tweak and alphabet. The key
+// must be a valid AES key, the length of tweak must be in [0..maxTweakLenFF1], and
+// the radix of the alphabet must be in [2..2^16].
+func NewFF1Cipher(key, tweak []byte, alphabet *Alphabet) (*FF1Cipher, error) {
+	if err := checkAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	var encrypter, decrypter, err = newFF1BlockModes(key, tweak, alphabet.Radix())
+	if err != nil {
+		return nil, err
+	}
+
+	var c = &FF1Cipher{
+		encrypter: encrypter,
+		decrypter: decrypter,
+		alphabet:  alphabet,
+	}
+	if err = c.CheckAlphabet(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// CheckAlphabet returns an error if the radix of the cipher does not match the number of
+// symbols of its alphabet. It is run by the constructors.
+func (c *FF1Cipher) CheckAlphabet() error {
+	return checkAlphabet(c.alphabet, c.encrypter, c.decrypter)
+}
+
+// EncryptString takes a plaintext made of symbols of the alphabet and returns the
+// corresponding ciphertext, made of symbols of the same alphabet. The ciphertext always has
+// as many symbols as the plaintext: the leading zeros, i.e. the first symbol of the alphabet,
+// are numerals like the others, they are neither dropped nor added.
+func (c *FF1Cipher) EncryptString(plaintext string) (string, error) {
+	return c.cryptString(c.encrypter, plaintext)
+}
+
+// DecryptString takes a ciphertext made of symbols of the alphabet and returns the
+// corresponding plaintext, made of symbols of the same alphabet.
+func (c *FF1Cipher) DecryptString(ciphertext string) (string, error) {
+	return c.cryptString(c.decrypter, ciphertext)
+}
+
+func (c *FF1Cipher) cryptString(mode cipher.BlockMode, s string) (string, error) {
+	var numeralString, err = c.alphabet.ToNumerals(s)
+	if err != nil {
+		return "", err
+	}
+
+	numeralString, err = cryptModeNumerals(mode, numeralString)
+	if err != nil {
+		return "", err
+	}
+
+	return c.alphabet.ToString(numeralString)
+}
+
+// SetKey replaces the key of the cipher. The key must be a valid AES key. It must
+// not be called concurrently with the other methods.
+func (c *FF1Cipher) SetKey(key []byte) error {
+	if err := c.encrypter.(keySetter).SetKey(key); err != nil {
+		return err
+	}
+	return c.decrypter.(keySetter).SetKey(key)
+}
+
+// EncryptNumerals encrypts the numeral string in, whose numerals must be lower than the
+// radix of the alphabet. It works on the numerals directly, without the byte conversions
+// of CryptBlocks. The input is not modified.
+func (c *FF1Cipher) EncryptNumerals(in []uint16) ([]uint16, error) {
+	return cryptModeNumerals(c.encrypter, in)
+}
+
+// DecryptNumerals decrypts the numeral string in, as EncryptNumerals does.
+func (c *FF1Cipher) DecryptNumerals(in []uint16) ([]uint16, error) {
+	return cryptModeNumerals(c.decrypter, in)
+}
+
+// EncryptInPlaceNumerals is EncryptNumerals, but it overwrites x with the ciphertext instead
+// of allocating it. x is validated first, it is left unchanged if an error is returned.
+func (c *FF1Cipher) EncryptInPlaceNumerals(x []uint16) error {
+	return cryptModeNumeralsInPlace(c.encrypter, x)
+}
+
+// DecryptInPlaceNumerals is DecryptNumerals, but it overwrites x with the plaintext, as
+// EncryptInPlaceNumerals does.
+func (c *FF1Cipher) DecryptInPlaceNumerals(x []uint16) error {
+	return cryptModeNumeralsInPlace(c.decrypter, x)
+}
+
+// EncryptInto encrypts the numeral string src, as EncryptNumerals does, and writes the
+// ciphertext to dst, which must have the length of src and may be src itself. It uses the
+// buffers of scratch instead of allocating its own, so that the repeated encryptions of
+// inputs of the same length do not allocate, see Scratch. If scratch is nil, a temporary
+// one is used. dst is left unchanged if an error is returned.
+func (c *FF1Cipher) EncryptInto(dst, src []uint16, scratch *Scratch) error {
+	return cryptModeNumeralsInto(c.encrypter, dst, src, scratch)
+}
+
+// DecryptInto decrypts the numeral string src and writes the plaintext to dst, as
+// EncryptInto does.
+func (c *FF1Cipher) DecryptInto(dst, src []uint16, scratch *Scratch) error {
+	return cryptModeNumeralsInto(c.decrypter, dst, src, scratch)
+}
+
+// FF1Encrypt encrypts the numeral string input with FF1, using the given key, tweak and
+// radix. The key must be a valid AES key, the length of tweak must be in [0..maxTweakLenFF1],
+// and the radix must be in [2..2^16]. The input is not modified.
+func FF1Encrypt(key, tweak []byte, radix uint32, input []uint16) ([]uint16, error) {
+	var encrypter, _, err = newFF1BlockModes(key, tweak, radix)
+	if err != nil {
+		return nil, err
+	}
+	return cryptModeNumerals(encrypter, input)
+}
+
+// FF1Decrypt decrypts the numeral string input with FF1, using the given key, tweak and
+// radix. The key, tweak and radix must match the ones used to encrypt the data. The input
+// is not modified.
+func FF1Decrypt(key, tweak []byte, radix uint32, input []uint16) ([]uint16, error) {
+	var _, decrypter, err = newFF1BlockModes(key, tweak, radix)
+	if err != nil {
+		return nil, err
+	}
+	return cryptModeNumerals(decrypter, input)
+}
+
+// EncryptDecimal encrypts the string of decimal digits digits with FF1 in radix 10, using
+// the given key and tweak, and returns a string of as many digits, the leading zeros
+// included. It returns an error if digits contains a character other than '0'-'9', or has
+// less than 2 digits. The key must be a valid AES key and the length of tweak must be in
+// [0..maxTweakLenFF1].
+func EncryptDecimal(key, tweak []byte, digits string) (string, error) {
+	return cryptDecimal(key, tweak, digits, FF1Encrypt)
+}
+
+// DecryptDecimal takes a string returned by EncryptDecimal and returns the original one.
+// The key and tweak must match the ones used to encrypt it.
+func DecryptDecimal(key, tweak []byte, digits string) (string, error) {
+	return cryptDecimal(key, tweak, digits, FF1Decrypt)
+}
+
+func cryptDecimal(key, tweak []byte, digits string, crypt func(key, tweak []byte, radix uint32, input []uint16) ([]uint16, error)) (string, error) {
+	var numerals = make([]uint16, len(digits))
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return "", fmt.Errorf("fpe: character %q at byte %d is not a decimal digit", digits[i], i)
+		}
+		numerals[i] = uint16(digits[i] - '0')
+	}
+	if minLen := MinInputLength(decimalAlphabet.Radix()); len(numerals) < minLen {
+		return "", fmt.Errorf("fpe: digits must have at least %d digits, got %d", minLen, len(numerals))
+	}
+
+	var out, err = crypt(key, tweak, decimalAlphabet.Radix(), numerals)
+	if err != nil {
+		return "", err
+	}
+	return decimalAlphabet.ToString(out)
+}
+
+// NewFF1EncrypterFromKey returns a BlockMode which encrypts in FF1 mode, using the given
+// key, tweak and radix. The key must be 16, 24 or 32 bytes (AES-128, AES-192 or AES-256).
+// Unlike NewFF1Encrypter, it builds the AES block itself and returns an error instead of
+// panicking if the key, the tweak or the radix are not valid.
+func NewFF1EncrypterFromKey(key, tweak []byte, radix uint32) (cipher.BlockMode, error) {
+	var encrypter, _, err = newFF1BlockModes(key, tweak, radix)
+	return encrypter, err
+}
+
+// NewFF1DecrypterFromKey returns a BlockMode which decrypts in FF1 mode, using the given
+// key, tweak and radix. Unlike NewFF1Decrypter, it builds the AES block itself and returns
+// an error instead of panicking if the key, the tweak or the radix are not valid.
+func NewFF1DecrypterFromKey(key, tweak []byte, radix uint32) (cipher.BlockMode, error) {
+	var _, decrypter, err = newFF1BlockModes(key, tweak, radix)
+	return decrypter, err
+}
+
+// newFF1BlockModes returns the FF1 encrypter and decrypter for the given key, tweak and radix.
+// It returns an error in the cases where the FF1 constructors would panic.
+func newFF1BlockModes(key, tweak []byte, radix uint32) (cipher.BlockMode, cipher.BlockMode, error) {
+	if err := validateKeyLen(len(key)); err != nil {
+		return nil, nil, err
+	}
+	if err := validateFF1Tweak(len(tweak)); err != nil {
+		return nil, nil, err
+	}
+	if err := validateFF1Radix(radix); err != nil {
+		return nil, nil, err
+	}
+
+	var aesBlock, err = aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The CBC mode is only checked by the constructors, FF1 computes its PRF with the AES block.
+	var cbcMode = NewCBCWithSetIV(aesBlock, make([]byte, blockSizeFF1))
+
+	return NewFF1Encrypter(aesBlock, cbcMode, tweak, radix), NewFF1Decrypter(aesBlock, cbcMode, tweak, radix), nil
+}
+
+// checkFF1ModeInput is checkFF1Input for a FF1 block mode, which may have been built with
+// WithConstantTime or WithMinDomain.
+func checkFF1ModeInput(x []uint16, m *ff1) error {
+	if err := checkFF1Input(x, m.radix); err != nil {
+		return err
+	}
+	if !m.checkDomain(uint64(len(x))) {
+		return &ParamError{FieldInputLen, int64(len(x)), int64(m.minDomainLength()), maxInputLenFF1, fmt.Sprintf("radix^len < %v", m.getMinDomain())}
+	}
+	if m.constantTime {
+		return validateConstantTimeLen(m.radix, len(x))
+	}
+	return nil
+}
+
+// checkFF1Input takes a numeral string x and an integer radix. It returns an error if x
+// cannot be processed by FF1, i.e. in the cases where CryptBlocks would panic.
+func checkFF1Input(x []uint16, radix uint32) error {
+	if err := validateFF1InputLen(radix, len(x)); err != nil {
+		return err
+	}
+	return validateNumerals(x, radix)
+}
@@ -0,0 +1,425 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func TestNewFF1Cipher(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, blockSizeFF1)
+	var alphabet = mustNewAlphabet("0123456789")
+
+	var c, err = NewFF1Cipher(key, tweak, alphabet)
+	assert.Nil(t, err)
+	assert.NotNil(t, c)
+
+	// Invalid key length
+	c, err = NewFF1Cipher(key[:10], tweak, alphabet)
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+
+	// Invalid tweak length
+	c, err = NewFF1Cipher(key, make([]byte, maxTweakLenFF1+1), alphabet)
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+
+	// Invalid radix
+	c, err = NewFF1Cipher(key, tweak, generateAlphabet(maxRadixFF1+1))
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+
+	// No alphabet
+	c, err = NewFF1Cipher(key, tweak, nil)
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+}
+
+// A cipher whose radix does not match its alphabet must be reported by CheckAlphabet.
+func TestFF1CipherCheckAlphabet(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var alphabet, _ = Alphabets("decimal")
+	var c, err = NewFF1Cipher(key, tweak, alphabet)
+	assert.Nil(t, err)
+	assert.Nil(t, c.CheckAlphabet())
+
+	var encrypter, decrypter, _ = newFF1BlockModes(key, tweak, 10)
+	c = &FF1Cipher{encrypter: encrypter, decrypter: decrypter, alphabet: mustNewAlphabet("abcdefghijklmnopqrstuvwxyz")}
+	err = c.CheckAlphabet()
+	assert.NotNil(t, err)
+	assert.Equal(t, "fpe: radix 10 does not match the 26 symbols of the alphabet", err.Error())
+	var paramErr, ok = err.(*ParamError)
+	assert.True(t, ok)
+	assert.Equal(t, FieldRadix, paramErr.Field)
+}
+
+// This test uses the NIST test vectors with radix 10 and 36 to validate EncryptString and DecryptString.
+func TestFF1CipherNIST(t *testing.T) {
+	var alphabets = map[uint32]*Alphabet{
+		10: mustNewAlphabet("0123456789"),
+		36: mustNewAlphabet("0123456789abcdefghijklmnopqrstuvwxyz"),
+	}
+
+	for _, test := range ff1Tests {
+		var c, err = NewFF1Cipher(test.key, test.tweak, alphabets[test.radix])
+		assert.Nil(t, err)
+
+		var plaintext, ciphertext string
+		plaintext, err = alphabets[test.radix].ToString(test.in)
+		assert.Nil(t, err)
+		ciphertext, err = alphabets[test.radix].ToString(test.out)
+		assert.Nil(t, err)
+
+		var result string
+		result, err = c.EncryptString(plaintext)
+		assert.Nil(t, err)
+		assert.Equal(t, ciphertext, result)
+
+		result, err = c.DecryptString(ciphertext)
+		assert.Nil(t, err)
+		assert.Equal(t, plaintext, result)
+	}
+}
+
+func TestFF1CipherEncryptionDecryption(t *testing.T) {
+	var alphabet = mustNewAlphabet("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz")
+
+	for i := 0; i < nbrTests; i++ {
+		var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, blockSizeFF1)
+		var c, err = NewFF1Cipher(key, tweak, alphabet)
+		assert.Nil(t, err)
+
+		var plaintext string
+		plaintext, err = alphabet.ToString(generateRandomNumeralString(alphabet.Radix(), rand.Intn(50)+2))
+		assert.Nil(t, err)
+
+		var ciphertext, decrypted string
+		ciphertext, err = c.EncryptString(plaintext)
+		assert.Nil(t, err)
+		decrypted, err = c.DecryptString(ciphertext)
+		assert.Nil(t, err)
+
+		assert.Equal(t, plaintext, decrypted)
+	}
+}
+
+// EncryptNumerals and DecryptNumerals must match CryptBlocks on the byte representation.
+func TestFF1CipherNumerals(t *testing.T) {
+	var alphabet, _ = Alphabets("alphanumeric")
+
+	for i := 0; i < nbrTests; i++ {
+		var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, blockSizeFF1)
+		var c, err = NewFF1Cipher(key, tweak, alphabet)
+		assert.Nil(t, err)
+
+		var plaintext = generateRandomNumeralString(alphabet.Radix(), rand.Intn(50)+2)
+		var input = dupNumeralString(plaintext)
+		var ciphertext []uint16
+		ciphertext, err = c.EncryptNumerals(input)
+		assert.Nil(t, err)
+		// The input must not be modified
+		assert.Equal(t, plaintext, input)
+
+		var buf = NumeralStringToBytes(plaintext)
+		c.encrypter.CryptBlocks(buf, buf)
+		assert.Equal(t, BytesToNumeralString(buf), ciphertext)
+
+		var decrypted []uint16
+		decrypted, err = c.DecryptNumerals(ciphertext)
+		assert.Nil(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	}
+
+	// Invalid numeral, too short
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, blockSizeFF1)
+	var c, _ = NewFF1Cipher(key, tweak, alphabet)
+	for _, input := range [][]uint16{{1, 2, 36}, {1}} {
+		var _, err = c.EncryptNumerals(input)
+		assert.NotNil(t, err)
+		_, err = c.DecryptNumerals(input)
+		assert.NotNil(t, err)
+	}
+}
+
+// The in-place methods must match EncryptNumerals and DecryptNumerals, and leave an invalid
+// input untouched.
+func TestFF1CipherInPlaceNumerals(t *testing.T) {
+	var alphabet, _ = Alphabets("alphanumeric")
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var c, err = NewFF1Cipher(key, tweak, alphabet)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		var plaintext = generateRandomNumeralString(alphabet.Radix(), rand.Intn(50)+2)
+		var expected, _ = c.EncryptNumerals(plaintext)
+
+		var x = dupNumeralString(plaintext)
+		assert.Nil(t, c.EncryptInPlaceNumerals(x))
+		assert.Equal(t, expected, x)
+		assert.Nil(t, c.DecryptInPlaceNumerals(x))
+		assert.Equal(t, plaintext, x)
+	}
+
+	for _, input := range [][]uint16{{1, 2, 3, 36}, {1}} {
+		var x = dupNumeralString(input)
+		assert.NotNil(t, c.EncryptInPlaceNumerals(x))
+		assert.Equal(t, input, x)
+		assert.NotNil(t, c.DecryptInPlaceNumerals(x))
+		assert.Equal(t, input, x)
+	}
+}
+
+func TestFF1CipherSetKey(t *testing.T) {
+	var keyA, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var keyB, _, _ []byte = getRandomParameters(ff1DefaultKeySize, 0, 0)
+	var alphabet, _ = Alphabets("decimal")
+	var c, _ = NewFF1Cipher(keyA, tweak, alphabet)
+	var expected, _ = NewFF1Cipher(keyB, tweak, alphabet)
+
+	assert.Nil(t, c.SetKey(keyB))
+	var ciphertext, err = c.EncryptString("0123456789")
+	assert.Nil(t, err)
+	var want string
+	want, err = expected.EncryptString("0123456789")
+	assert.Nil(t, err)
+	assert.Equal(t, want, ciphertext)
+
+	var plaintext string
+	plaintext, err = c.DecryptString(ciphertext)
+	assert.Nil(t, err)
+	assert.Equal(t, "0123456789", plaintext)
+
+	assert.NotNil(t, c.SetKey(keyB[:15]))
+}
+
+// The leading zeros must be kept, both in the plaintexts and in the ciphertexts.
+func TestFF1CipherLeadingZeros(t *testing.T) {
+	var alphabet, _ = Alphabets("decimal")
+
+	for i := 0; i < 100; i++ {
+		var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+		var c, _ = NewFF1Cipher(key, tweak, alphabet)
+
+		for _, plaintext := range []string{"0000000001", "0000000000", "007"} {
+			var ciphertext, err = c.EncryptString(plaintext)
+			assert.Nil(t, err)
+			assert.Equal(t, len(plaintext), len(ciphertext))
+
+			var decrypted string
+			decrypted, err = c.DecryptString(ciphertext)
+			assert.Nil(t, err)
+			assert.Equal(t, plaintext, decrypted)
+		}
+	}
+
+	// A ciphertext with leading zeros must decrypt to a plaintext of the same length. The
+	// plaintext is found by decrypting a ciphertext chosen with leading zeros.
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var c, _ = NewFF1Cipher(key, tweak, alphabet)
+	var plaintext, err = c.DecryptString("0000000001")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(plaintext))
+	var ciphertext string
+	ciphertext, err = c.EncryptString(plaintext)
+	assert.Nil(t, err)
+	assert.Equal(t, "0000000001", ciphertext)
+}
+
+// Invalid inputs must return an error instead of panicking.
+func TestFF1CipherInvalidInput(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, blockSizeFF1)
+	var c, err = NewFF1Cipher(key, tweak, mustNewAlphabet("0123456789"))
+	assert.Nil(t, err)
+
+	var inputs = []string{
+		// Symbol not in the alphabet
+		"0123456789A",
+		// Inputs shorter than minInputLenFF1
+		"1",
+		"",
+	}
+
+	for _, input := range inputs {
+		var f = func() {
+			_, err = c.EncryptString(input)
+			assert.NotNil(t, err)
+			_, err = c.DecryptString(input)
+			assert.NotNil(t, err)
+		}
+		assert.NotPanics(t, f)
+	}
+
+	// radix^len < 100 with a valid length
+	c, err = NewFF1Cipher(key, tweak, mustNewAlphabet("01"))
+	assert.Nil(t, err)
+	_, err = c.EncryptString("010101")
+	assert.NotNil(t, err)
+	_, err = c.EncryptString("0101010")
+	assert.Nil(t, err)
+}
+
+// This test uses the NIST test vectors to validate FF1Encrypt and FF1Decrypt.
+func TestFF1EncryptDecrypt(t *testing.T) {
+	for _, test := range ff1Tests {
+		var input = dupNumeralString(test.in)
+		var result, err = FF1Encrypt(test.key, test.tweak, test.radix, input)
+		assert.Nil(t, err)
+		assert.Equal(t, test.out, result)
+		// The input must not be modified
+		assert.Equal(t, test.in, input)
+
+		result, err = FF1Decrypt(test.key, test.tweak, test.radix, test.out)
+		assert.Nil(t, err)
+		assert.Equal(t, test.in, result)
+	}
+}
+
+// Invalid parameters and inputs must return an error instead of panicking.
+func TestFF1EncryptDecryptErrors(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, blockSizeFF1)
+	var radix = uint32(ff1DefaultRadix)
+
+	var tests = []struct {
+		key   []byte
+		tweak []byte
+		radix uint32
+		input []uint16
+	}{
+		// Invalid key length
+		{key[:10], tweak, radix, ff1CommonInput1},
+		// Invalid tweak length
+		{key, make([]byte, maxTweakLenFF1+1), radix, ff1CommonInput1},
+		// Invalid radix
+		{key, tweak, maxRadixFF1 + 1, ff1CommonInput1},
+		// Invalid input length
+		{key, tweak, radix, []uint16{1}},
+		// radix^len < 100
+		{key, tweak, 2, []uint16{0, 1, 0, 1, 0, 1}},
+		// Invalid numeral string
+		{key, tweak, radix, ff1CommonInput2},
+	}
+
+	for _, test := range tests {
+		var f = func() {
+			var result, err = FF1Encrypt(test.key, test.tweak, test.radix, test.input)
+			assert.NotNil(t, err)
+			assert.Nil(t, result)
+			result, err = FF1Decrypt(test.key, test.tweak, test.radix, test.input)
+			assert.NotNil(t, err)
+			assert.Nil(t, result)
+		}
+		assert.NotPanics(t, f)
+	}
+}
+
+// The numerals are checked by the mode itself, so the options of NewFF1 apply.
+func TestFF1CipherModeOptions(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var encrypter, decrypter, err = NewFF1(key, WithTweak(tweak), WithMinDomain(big.NewInt(1000)))
+	assert.Nil(t, err)
+	var c = &FF1Cipher{encrypter: encrypter, decrypter: decrypter, alphabet: decimalAlphabet}
+
+	var result []uint16
+	result, err = c.EncryptNumerals([]uint16{1, 2})
+	assert.NotNil(t, err)
+	assert.Nil(t, result)
+	_, err = c.DecryptString("12")
+	assert.NotNil(t, err)
+
+	result, err = c.EncryptNumerals([]uint16{1, 2, 3})
+	assert.Nil(t, err)
+	result, err = c.DecryptNumerals(result)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{1, 2, 3}, result)
+}
+
+func TestEncryptDecryptDecimal(t *testing.T) {
+	// The NIST vectors in radix 10.
+	for _, test := range ff1Tests {
+		if test.radix != 10 {
+			continue
+		}
+		var plaintext, _ = decimalAlphabet.ToString(test.in)
+		var ciphertext, _ = decimalAlphabet.ToString(test.out)
+
+		var result, err = EncryptDecimal(test.key, test.tweak, plaintext)
+		assert.Nil(t, err)
+		assert.Equal(t, ciphertext, result)
+
+		result, err = DecryptDecimal(test.key, test.tweak, ciphertext)
+		assert.Nil(t, err)
+		assert.Equal(t, plaintext, result)
+	}
+
+	// The leading zeros are kept.
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	for _, plaintext := range []string{"00", "0000000000", "0000012345"} {
+		var ciphertext, err = EncryptDecimal(key, tweak, plaintext)
+		assert.Nil(t, err)
+		assert.Len(t, ciphertext, len(plaintext))
+		var decrypted string
+		decrypted, err = DecryptDecimal(key, tweak, ciphertext)
+		assert.Nil(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	}
+
+	// Invalid inputs and parameters.
+	for _, test := range []struct {
+		key, tweak []byte
+		digits     string
+	}{
+		{key, tweak, ""},
+		{key, tweak, "1"},
+		{key, tweak, "12a4"},
+		{key, tweak, "12 34"},
+		{key, tweak, "-1234"},
+		{key, tweak, "１２３４"},
+		{key[:10], tweak, "1234"},
+	} {
+		var result, err = EncryptDecimal(test.key, test.tweak, test.digits)
+		assert.NotNil(t, err)
+		assert.Equal(t, "", result)
+		result, err = DecryptDecimal(test.key, test.tweak, test.digits)
+		assert.NotNil(t, err)
+		assert.Equal(t, "", result)
+	}
+}
+
+func dupNumeralString(x []uint16) []uint16 {
+	var out = make([]uint16, len(x))
+	copy(out, x)
+	return out
+}
+
+func TestNewFF1FromKey(t *testing.T) {
+	for _, test := range ff1Tests {
+		var encrypter, err = NewFF1EncrypterFromKey(test.key, test.tweak, test.radix)
+		assert.Nil(t, err)
+		var result = make([]byte, 2*len(test.in))
+		encrypter.CryptBlocks(result, NumeralStringToBytes(test.in))
+		assert.Equal(t, test.out, BytesToNumeralString(result))
+
+		var decrypter cipher.BlockMode
+		decrypter, err = NewFF1DecrypterFromKey(test.key, test.tweak, test.radix)
+		assert.Nil(t, err)
+		decrypter.CryptBlocks(result, NumeralStringToBytes(test.out))
+		assert.Equal(t, test.in, BytesToNumeralString(result))
+	}
+
+	// Invalid parameters return an error.
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, blockSizeFF1)
+	var radix = uint32(ff1DefaultRadix)
+	var invalidModes = []func() (cipher.BlockMode, error){
+		func() (cipher.BlockMode, error) { return NewFF1EncrypterFromKey(key[:10], tweak, radix) },
+		func() (cipher.BlockMode, error) { return NewFF1DecrypterFromKey(key[:10], tweak, radix) },
+		func() (cipher.BlockMode, error) { return NewFF1EncrypterFromKey(key, tweak, maxRadixFF1+1) },
+		func() (cipher.BlockMode, error) { return NewFF1DecrypterFromKey(key, tweak, maxRadixFF1+1) },
+	}
+	for _, newMode := range invalidModes {
+		var mode, err = newMode()
+		assert.NotNil(t, err)
+		assert.Nil(t, mode)
+	}
+}
@@ -0,0 +1,152 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// The radix used by NewFF1 when WithRadix is not given.
+	defaultRadixFF1 = 10
+	// The round number is encoded on a single byte in the Q block.
+	maxRoundsFF1 = 1 << 8
+)
+
+// FF1Option configures the FF1 encrypter and decrypter returned by NewFF1.
+type FF1Option func(*ff1Options) error
+
+type ff1Options struct {
+	tweak         []byte
+	radix         uint32
+	rounds        int
+	roundSchedule func(inputLen int) int
+	constantTime  bool
+	minDomain     *big.Int
+}
+
+// WithTweak sets the tweak. Its length must be in [0..maxTweakLenFF1]. By default, the
+// tweak is empty.
+func WithTweak(tweak []byte) FF1Option {
+	return func(o *ff1Options) error {
+		if err := validateFF1Tweak(len(tweak)); err != nil {
+			return err
+		}
+		o.tweak = dup(tweak)
+		return nil
+	}
+}
+
+// WithRadix sets the radix. It must be in [2..2^16]. By default, the radix is 10.
+func WithRadix(radix uint32) FF1Option {
+	return func(o *ff1Options) error {
+		if err := validateFF1Radix(radix); err != nil {
+			return err
+		}
+		o.radix = radix
+		return nil
+	}
+}
+
+// WithRounds sets the number of Feistel rounds, it must be in [1..256]. By default, the 10
+// rounds of the NIST standard are used. Any other value does not comply with the standard,
+// this option is intended for experimentation only.
+func WithRounds(rounds int) FF1Option {
+	return func(o *ff1Options) error {
+		if rounds < 1 || rounds > maxRoundsFF1 {
+			return fmt.Errorf("fpe: rounds must be in [1..%d]", maxRoundsFF1)
+		}
+		o.rounds = rounds
+		return nil
+	}
+}
+
+// WithFF1RoundSchedule sets a function returning the number of Feistel rounds for an input
+// of inputLen numerals, which must be in [1..256]. It overrides WithRounds. By default, the
+// 10 rounds of the NIST standard are used for every length, which is what NumRoundsFF1
+// returns. This option is intended for interoperability with other implementations that
+// use their own schedule. The number of rounds is part of the security margin of FF1: a
+// schedule with less than 10 rounds makes the known attacks on the Feistel structure
+// cheaper, for short inputs in particular, and ciphertexts produced with any other schedule
+// can only be decrypted with the same schedule. Do not use it for new data.
+func WithFF1RoundSchedule(schedule func(inputLen int) int) FF1Option {
+	return func(o *ff1Options) error {
+		if schedule == nil {
+			return fmt.Errorf("fpe: round schedule must not be nil")
+		}
+		o.roundSchedule = schedule
+		return nil
+	}
+}
+
+// getFF1Rounds takes the number of rounds and the round schedule of a FF1 block mode, and
+// the length n of an input. It returns the number of rounds for the input. It panics if the
+// schedule returns a number of rounds out of [1..maxRoundsFF1].
+func getFF1Rounds(rounds int, schedule func(inputLen int) int, n int) int {
+	if schedule == nil {
+		return rounds
+	}
+	if rounds = schedule(n); rounds < 1 || rounds > maxRoundsFF1 {
+		panic(fmt.Sprintf("getFF1Rounds: the round schedule must return a number in [1..%d], got %d.", maxRoundsFF1, rounds))
+	}
+	return rounds
+}
+
+// WithConstantTime makes the conversions between numeral strings and integers run in a time
+// which does not depend on the values of the numerals, instead of using big.Int. It is only
+// available for inputs whose halves fit in a uint64: the length of the inputs must be at
+// most MaxConstantTimeLength(radix), CryptBlocks panics otherwise. The results are the same
+// as without the option, only slower for small radices. The AES block must be constant-time
+// as well, which is the case of crypto/aes on the platforms with AES instructions.
+func WithConstantTime() FF1Option {
+	return func(o *ff1Options) error {
+		o.constantTime = true
+		return nil
+	}
+}
+
+// WithMinDomain raises the minimum domain size radix^len of the inputs to min, e.g. for
+// security policies which require a larger margin than the NIST standard. CryptBlocks panics
+// on the inputs with radix^len < min. The comparison is exact. By default, the minimum
+// domain is the 100 of the NIST standard, and min must not be lower.
+func WithMinDomain(min *big.Int) FF1Option {
+	return func(o *ff1Options) error {
+		if min == nil || min.Cmp(big.NewInt(minDomainFF1)) < 0 {
+			return fmt.Errorf("fpe: minimum domain must be at least %d", minDomainFF1)
+		}
+		o.minDomain = new(big.Int).Set(min)
+		return nil
+	}
+}
+
+// NewFF1 returns a FF1 encrypter and decrypter using the given key, which must be a valid
+// AES key, and the options. Without options, the tweak is empty, the radix is 10 and the
+// NIST round schedule is used. Both are returned, as NewFromConfig does, because a FF1
+// BlockMode either encrypts or decrypts: a single BlockMode would need an option for the
+// direction, and two calls with the same options to get both.
+func NewFF1(key []byte, opts ...FF1Option) (cipher.BlockMode, cipher.BlockMode, error) {
+	var o = ff1Options{
+		radix:  defaultRadixFF1,
+		rounds: roundsFF1,
+	}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var encrypter, decrypter, err = newFF1BlockModes(key, o.tweak, o.radix)
+	if err != nil {
+		return nil, nil, err
+	}
+	encrypter.(*ff1Encrypter).rounds = o.rounds
+	decrypter.(*ff1Decrypter).rounds = o.rounds
+	encrypter.(*ff1Encrypter).roundSchedule = o.roundSchedule
+	decrypter.(*ff1Decrypter).roundSchedule = o.roundSchedule
+	encrypter.(*ff1Encrypter).constantTime = o.constantTime
+	decrypter.(*ff1Decrypter).constantTime = o.constantTime
+	encrypter.(*ff1Encrypter).minDomain = o.minDomain
+	decrypter.(*ff1Decrypter).minDomain = o.minDomain
+
+	return encrypter, decrypter, nil
+}
@@ -0,0 +1,239 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+func TestNewFF1(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var radix uint32 = 36
+	var plaintext = NumeralStringToBytes(generateRandomNumeralString(radix, 20))
+
+	var expectedEncrypter, _, err = newFF1BlockModes(key, tweak, radix)
+	assert.Nil(t, err)
+	var expected = make([]byte, len(plaintext))
+	expectedEncrypter.CryptBlocks(expected, plaintext)
+
+	var encrypter, decrypter cipher.BlockMode
+	encrypter, decrypter, err = NewFF1(key, WithTweak(tweak), WithRadix(radix))
+	assert.Nil(t, err)
+
+	var ciphertext = make([]byte, len(plaintext))
+	encrypter.CryptBlocks(ciphertext, plaintext)
+	assert.Equal(t, expected, ciphertext)
+
+	var decrypted = make([]byte, len(plaintext))
+	decrypter.CryptBlocks(decrypted, ciphertext)
+	assert.Equal(t, plaintext, decrypted)
+}
+
+func TestNewFF1Defaults(t *testing.T) {
+	var key, _, _ []byte = getRandomParameters(ff1DefaultKeySize, 0, 0)
+	var plaintext = NumeralStringToBytes(generateRandomNumeralString(defaultRadixFF1, 20))
+
+	var expectedEncrypter, _, err = newFF1BlockModes(key, []byte{}, defaultRadixFF1)
+	assert.Nil(t, err)
+	var expected = make([]byte, len(plaintext))
+	expectedEncrypter.CryptBlocks(expected, plaintext)
+
+	var encrypter cipher.BlockMode
+	encrypter, _, err = NewFF1(key)
+	assert.Nil(t, err)
+
+	var ciphertext = make([]byte, len(plaintext))
+	encrypter.CryptBlocks(ciphertext, plaintext)
+	assert.Equal(t, expected, ciphertext)
+}
+
+func TestNewFF1WithRounds(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+
+	// Odd and even lengths, with odd and even numbers of rounds.
+	for _, l := range []int{20, 21} {
+		var plaintext = NumeralStringToBytes(generateRandomNumeralString(defaultRadixFF1, l))
+
+		var nistEncrypter, _, err = NewFF1(key, WithTweak(tweak), WithRounds(roundsFF1))
+		assert.Nil(t, err)
+		var nistCiphertext = make([]byte, len(plaintext))
+		nistEncrypter.CryptBlocks(nistCiphertext, plaintext)
+
+		for _, rounds := range []int{1, 7, 11, 24, maxRoundsFF1} {
+			var encrypter, decrypter cipher.BlockMode
+			encrypter, decrypter, err = NewFF1(key, WithTweak(tweak), WithRounds(rounds))
+			assert.Nil(t, err)
+
+			var ciphertext = make([]byte, len(plaintext))
+			encrypter.CryptBlocks(ciphertext, plaintext)
+			assert.NotEqual(t, nistCiphertext, ciphertext)
+
+			var decrypted = make([]byte, len(plaintext))
+			decrypter.CryptBlocks(decrypted, ciphertext)
+			assert.Equal(t, plaintext, decrypted)
+		}
+	}
+}
+
+func TestNewFF1WithRoundSchedule(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var legacy = func(inputLen int) int { return roundsFF1 }
+	var custom = func(inputLen int) int {
+		if inputLen < 16 {
+			return 18
+		}
+		return 12
+	}
+
+	var nistEncrypter, _, err = NewFF1(key, WithTweak(tweak))
+	assert.Nil(t, err)
+	var legacyEncrypter, legacyDecrypter cipher.BlockMode
+	legacyEncrypter, legacyDecrypter, err = NewFF1(key, WithTweak(tweak), WithFF1RoundSchedule(legacy))
+	assert.Nil(t, err)
+	var customEncrypter, customDecrypter cipher.BlockMode
+	// The schedule overrides WithRounds.
+	customEncrypter, customDecrypter, err = NewFF1(key, WithTweak(tweak), WithRounds(3), WithFF1RoundSchedule(custom))
+	assert.Nil(t, err)
+	var customRounds []cipher.BlockMode
+	for _, rounds := range []int{18, 12} {
+		var encrypter cipher.BlockMode
+		encrypter, _, err = NewFF1(key, WithTweak(tweak), WithRounds(rounds))
+		assert.Nil(t, err)
+		customRounds = append(customRounds, encrypter)
+	}
+
+	for i, l := range []int{10, 20} {
+		var plaintext = NumeralStringToBytes(generateRandomNumeralString(defaultRadixFF1, l))
+		var expected, ciphertext = make([]byte, len(plaintext)), make([]byte, len(plaintext))
+		var decrypted = make([]byte, len(plaintext))
+
+		// The legacy schedule is the NIST one.
+		nistEncrypter.CryptBlocks(expected, plaintext)
+		legacyEncrypter.CryptBlocks(ciphertext, plaintext)
+		assert.Equal(t, expected, ciphertext)
+		legacyDecrypter.CryptBlocks(decrypted, ciphertext)
+		assert.Equal(t, plaintext, decrypted)
+
+		customRounds[i].CryptBlocks(expected, plaintext)
+		customEncrypter.CryptBlocks(ciphertext, plaintext)
+		assert.Equal(t, expected, ciphertext)
+		customDecrypter.CryptBlocks(decrypted, ciphertext)
+		assert.Equal(t, plaintext, decrypted)
+	}
+
+	// The number of rounds returned by the schedule is checked.
+	var encrypter cipher.BlockMode
+	encrypter, _, err = NewFF1(key, WithFF1RoundSchedule(func(int) int { return 0 }))
+	assert.Nil(t, err)
+	var plaintext = NumeralStringToBytes(generateRandomNumeralString(defaultRadixFF1, 10))
+	assert.Panics(t, func() { encrypter.CryptBlocks(plaintext, plaintext) })
+	assert.Panics(t, func() { encrypter.(roundCounter).NumRounds(10) })
+}
+
+type roundCounter interface {
+	NumRounds(inputLen int) int
+}
+
+// NumRounds must return the number of rounds the mode uses for an input length, with the
+// default rounds, WithRounds and WithFF1RoundSchedule.
+func TestFF1NumRounds(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var custom = func(inputLen int) int {
+		if inputLen < 16 {
+			return 18
+		}
+		return 12
+	}
+
+	for _, test := range []struct {
+		opts     []FF1Option
+		expected func(inputLen int) int
+	}{
+		{nil, NumRoundsFF1},
+		{[]FF1Option{WithRounds(7)}, func(int) int { return 7 }},
+		{[]FF1Option{WithRounds(3), WithFF1RoundSchedule(custom)}, custom},
+	} {
+		var encrypter, decrypter, err = NewFF1(key, append(test.opts, WithTweak(tweak))...)
+		assert.Nil(t, err)
+		for _, l := range []int{minInputLenFF1, 10, 15, 16, 100} {
+			assert.Equal(t, test.expected(l), encrypter.(roundCounter).NumRounds(l))
+			assert.Equal(t, test.expected(l), decrypter.(roundCounter).NumRounds(l))
+		}
+	}
+}
+
+func TestNewFF1WithMinDomain(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+
+	for _, test := range []struct {
+		min    *big.Int
+		minLen int
+	}{
+		// The default of the NIST standard, radix^len == 100 is accepted.
+		{big.NewInt(minDomainFF1), 2},
+		// radix^len == min is accepted.
+		{big.NewInt(1000), 3},
+		{big.NewInt(1001), 4},
+		// min does not fit in an int64.
+		{new(big.Int).Exp(big.NewInt(10), big.NewInt(30), nil), 30},
+		{new(big.Int).Add(new(big.Int).Exp(big.NewInt(10), big.NewInt(30), nil), big.NewInt(1)), 31},
+	} {
+		var encrypter, decrypter, err = NewFF1(key, WithTweak(tweak), WithMinDomain(test.min))
+		assert.Nil(t, err)
+
+		var short = NumeralStringToBytes(generateRandomNumeralString(defaultRadixFF1, test.minLen-1))
+		if test.minLen-1 >= minInputLenFF1 {
+			assert.Panics(t, func() { encrypter.CryptBlocks(short, short) })
+			assert.Panics(t, func() { decrypter.CryptBlocks(short, short) })
+			var err = checkModeInput(encrypter, BytesToNumeralString(short))
+			assert.NotNil(t, err)
+			assert.Equal(t, int64(test.minLen), err.(*ParamError).Min)
+		}
+
+		var plaintext = NumeralStringToBytes(generateRandomNumeralString(defaultRadixFF1, test.minLen))
+		var ciphertext = make([]byte, len(plaintext))
+		encrypter.CryptBlocks(ciphertext, plaintext)
+		var decrypted = make([]byte, len(plaintext))
+		decrypter.CryptBlocks(decrypted, ciphertext)
+		assert.Equal(t, plaintext, decrypted)
+		assert.Nil(t, checkModeInput(encrypter, BytesToNumeralString(plaintext)))
+
+		// The tweak given to CryptBlocksWithTweak does not change the minimum domain.
+		if test.minLen-1 >= minInputLenFF1 {
+			assert.Panics(t, func() { encrypter.(TweakCrypter).CryptBlocksWithTweak(short, short, tweak) })
+		}
+	}
+
+	// The option copies min.
+	var min = big.NewInt(1000)
+	var encrypter, _, err = NewFF1(key, WithMinDomain(min))
+	assert.Nil(t, err)
+	min.SetInt64(100)
+	var short = NumeralStringToBytes(generateRandomNumeralString(defaultRadixFF1, 2))
+	assert.Panics(t, func() { encrypter.CryptBlocks(short, short) })
+}
+
+func TestNewFF1InvalidOptions(t *testing.T) {
+	var key, _, _ []byte = getRandomParameters(ff1DefaultKeySize, 0, 0)
+
+	var invalidOptions = []FF1Option{
+		WithTweak(make([]byte, maxTweakLenFF1+1)),
+		WithRadix(minRadixFF1 - 1),
+		WithRadix(maxRadixFF1 + 1),
+		WithRounds(0),
+		WithRounds(maxRoundsFF1 + 1),
+		WithFF1RoundSchedule(nil),
+		WithMinDomain(nil),
+		WithMinDomain(big.NewInt(minDomainFF1 - 1)),
+	}
+
+	for _, opt := range invalidOptions {
+		var _, _, err = NewFF1(key, opt)
+		assert.NotNil(t, err)
+	}
+
+	// Invalid key
+	var _, _, err = NewFF1(key[:10])
+	assert.NotNil(t, err)
+}
@@ -10,8 +10,10 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"github.com/stretchr/testify/assert"
+	"math"
 	"math/big"
 	"math/rand"
+	"sync"
 	"testing"
 )
 
@@ -2322,6 +2324,33 @@ func TestNewFF1Decrypter(t *testing.T) {
 	assert.Panics(t, f)
 }
 
+// This test checks that the IV of the CBC mode given to NewFF1Encrypter and NewFF1Decrypter
+// is ignored: the PRF always uses a zero IV.
+func TestFF1IgnoresCBCIV(t *testing.T) {
+	var key, tweak, iv []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, blockSizeFF1)
+	var radix = uint32(ff1DefaultRadix)
+	var aesBlock, err = aes.NewCipher(key)
+	assert.Nil(t, err)
+
+	var zeroIVEncrypter = NewFF1Encrypter(aesBlock, NewCBCWithSetIV(aesBlock, make([]byte, blockSizeFF1)), tweak, radix)
+	var encrypter = NewFF1Encrypter(aesBlock, NewCBCWithSetIV(aesBlock, iv), tweak, radix)
+	var decrypter = NewFF1Decrypter(aesBlock, NewCBCWithSetIV(aesBlock, iv), tweak, radix)
+
+	for l := 2; l < 50; l++ {
+		var plaintext = NumeralStringToBytes(generateRandomNumeralString(radix, l))
+		var expected = make([]byte, len(plaintext))
+		zeroIVEncrypter.CryptBlocks(expected, plaintext)
+
+		var ciphertext = make([]byte, len(plaintext))
+		encrypter.CryptBlocks(ciphertext, plaintext)
+		assert.Equal(t, expected, ciphertext)
+
+		var decrypted = make([]byte, len(plaintext))
+		decrypter.CryptBlocks(decrypted, ciphertext)
+		assert.Equal(t, plaintext, decrypted)
+	}
+}
+
 // Test input validation of Crypt method for FF1 encrypter and decrypter
 func TestFF1CryptBlocks(t *testing.T) {
 	var key, tweak, iv []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, blockSizeFF1)
@@ -2357,6 +2386,18 @@ func TestFF1CryptBlocks(t *testing.T) {
 		}
 		assert.Panics(t, f)
 
+		// Test radix^len just below and above 100 (2^6 = 64, 2^7 = 128)
+		f = func() {
+			var b = NumeralStringToBytes(make([]uint16, 6))
+			ff1.CryptBlocks(b, b)
+		}
+		assert.Panics(t, f)
+		f = func() {
+			var b = NumeralStringToBytes(make([]uint16, 7))
+			ff1.CryptBlocks(b, b)
+		}
+		assert.NotPanics(t, f)
+
 		// Test len(dst) != len(src)
 		f = func() {
 			// minInputLenFF1 < 10 and radix^len > 100
@@ -2512,6 +2553,106 @@ func TestSetFF1Tweak(t *testing.T) {
 	assert.Panics(t, f)
 }
 
+// This test check that SetTweak fully replaces the tweak when the tweak length changes.
+func TestSetFF1TweakLength(t *testing.T) {
+	var key, longTweak, _ []byte = getRandomParameters(ff1DefaultKeySize, 16, blockSizeFF1)
+	var _, shortTweak, _ []byte = getRandomParameters(ff1DefaultKeySize, 4, blockSizeFF1)
+	var _, initialTweak, _ []byte = getRandomParameters(ff1DefaultKeySize, 8, blockSizeFF1)
+	var radix = uint32(ff1DefaultRadix)
+	var plaintext = NumeralStringToBytes(ff1CommonInput1)
+
+	type fpeWithSetTweak interface {
+		cipher.BlockMode
+		SetTweak([]byte)
+	}
+
+	// Expected ciphertext, computed with a fresh encrypter using the short tweak.
+	var expected = make([]byte, len(plaintext))
+	{
+		var encrypter, err = getFF1Encrypter(key, shortTweak, radix)
+		assert.Nil(t, err)
+		encrypter.CryptBlocks(expected, plaintext)
+	}
+
+	// Encrypter
+	var encrypter, err = getFF1Encrypter(key, initialTweak, radix)
+	assert.Nil(t, err)
+	var encWithSetTweak = encrypter.(fpeWithSetTweak)
+	encWithSetTweak.SetTweak(longTweak)
+	encWithSetTweak.SetTweak(shortTweak)
+
+	var ciphertext = make([]byte, len(plaintext))
+	encWithSetTweak.CryptBlocks(ciphertext, plaintext)
+	assert.Equal(t, expected, ciphertext)
+
+	// Decrypter
+	var decrypter cipher.BlockMode
+	decrypter, err = getFF1Decrypter(key, initialTweak, radix)
+	assert.Nil(t, err)
+	var decWithSetTweak = decrypter.(fpeWithSetTweak)
+	decWithSetTweak.SetTweak(longTweak)
+	decWithSetTweak.SetTweak(shortTweak)
+
+	var decrypted = make([]byte, len(ciphertext))
+	decWithSetTweak.CryptBlocks(decrypted, ciphertext)
+	assert.Equal(t, plaintext, decrypted)
+}
+
+// This test check that SetTweakAtomic can rotate the tweak while other goroutines encrypt
+// and decrypt. Run it with -race.
+func TestSetFF1TweakAtomic(t *testing.T) {
+	var key, tweakA, _ []byte = getRandomParameters(ff1DefaultKeySize, 8, 0)
+	var _, tweakB, _ []byte = getRandomParameters(ff1DefaultKeySize, 16, 0)
+	var radix = uint32(ff1DefaultRadix)
+	var plaintext = NumeralStringToBytes(generateRandomNumeralString(radix, 16))
+
+	// Expected ciphertexts with each tweak.
+	var ciphertexts = map[string][]byte{}
+	for _, tweak := range [][]byte{tweakA, tweakB} {
+		var encrypter, _, err = newFF1BlockModes(key, tweak, radix)
+		assert.Nil(t, err)
+		var ciphertext = make([]byte, len(plaintext))
+		encrypter.CryptBlocks(ciphertext, plaintext)
+		ciphertexts[string(ciphertext)] = ciphertext
+	}
+
+	var encrypter, decrypter, err = newFF1BlockModes(key, tweakA, radix)
+	assert.Nil(t, err)
+
+	var done = make(chan struct{})
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var ciphertext = make([]byte, len(plaintext))
+			for i := 0; i < 200; i++ {
+				encrypter.CryptBlocks(ciphertext, plaintext)
+				var _, ok = ciphertexts[string(ciphertext)]
+				assert.True(t, ok)
+			}
+		}()
+	}
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			var tweak = tweakA
+			if i%2 == 0 {
+				tweak = tweakB
+			}
+			encrypter.(*ff1Encrypter).SetTweakAtomic(tweak)
+			decrypter.(*ff1Decrypter).SetTweakAtomic(tweak)
+			decrypter.CryptBlocks(make([]byte, len(plaintext)), plaintext)
+		}
+	}()
+	wg.Wait()
+	<-done
+
+	// Set invalid tweak
+	assert.Panics(t, func() { encrypter.(*ff1Encrypter).SetTweakAtomic(make([]byte, maxTweakLenFF1+1)) })
+	assert.Panics(t, func() { decrypter.(*ff1Decrypter).SetTweakAtomic(make([]byte, maxTweakLenFF1+1)) })
+}
+
 // This test check that the function SetRadix of the FF1Encrypter and FF1Decrypter works correctly.
 func TestSetFF1Radix(t *testing.T) {
 	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, blockSizeFF1)
@@ -2600,6 +2741,80 @@ func TestSetFF1Radix(t *testing.T) {
 	assert.Panics(t, f)
 }
 
+// This test check that the functions GetTweak and GetRadix of the FF1Encrypter and FF1Decrypter work correctly.
+func TestGetFF1TweakRadix(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var _, otherTweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var radix = uint32(rand.Intn(1000) + minRadixFF1)
+
+	type fpeWithGetters interface {
+		cipher.BlockMode
+		SetTweak([]byte)
+		SetRadix(uint32)
+		GetTweak() []byte
+		GetRadix() uint32
+	}
+
+	var aesBlock, err = aes.NewCipher(key)
+	assert.Nil(t, err)
+	var cbcMode = cipher.NewCBCEncrypter(aesBlock, make([]byte, blockSizeFF1))
+
+	var blockModes = []cipher.BlockMode{
+		NewFF1Encrypter(aesBlock, cbcMode, tweak, radix),
+		NewFF1Decrypter(aesBlock, cbcMode, tweak, radix),
+	}
+
+	for _, blockMode := range blockModes {
+		var ff1, ok = blockMode.(fpeWithGetters)
+		assert.True(t, ok)
+
+		assert.Equal(t, tweak, ff1.GetTweak())
+		assert.Equal(t, radix, ff1.GetRadix())
+
+		// The returned tweak is a copy, modifying it must not modify the internal tweak.
+		var tweakCopy = ff1.GetTweak()
+		tweakCopy[0] ^= 0xff
+		assert.Equal(t, tweak, ff1.GetTweak())
+
+		ff1.SetTweak(otherTweak)
+		ff1.SetRadix(radix + 1)
+		assert.Equal(t, otherTweak, ff1.GetTweak())
+		assert.Equal(t, radix+1, ff1.GetRadix())
+	}
+}
+
+// After SetKey, the BlockModes must return the same results as BlockModes built with the new key.
+func TestSetFF1Key(t *testing.T) {
+	var keyA, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var keyB, _, _ []byte = getRandomParameters(32, 0, 0)
+	var radix uint32 = 10
+	var plaintext = NumeralStringToBytes(generateRandomNumeralString(radix, 20))
+
+	var encrypter, decrypter, _ = newFF1BlockModes(keyA, tweak, radix)
+	var encrypterB, _, _ = newFF1BlockModes(keyB, tweak, radix)
+
+	var ciphertextA = make([]byte, len(plaintext))
+	encrypter.CryptBlocks(ciphertextA, plaintext)
+
+	assert.Nil(t, encrypter.(*ff1Encrypter).SetKey(keyB))
+	assert.Nil(t, decrypter.(*ff1Decrypter).SetKey(keyB))
+
+	var ciphertext, expected = make([]byte, len(plaintext)), make([]byte, len(plaintext))
+	encrypter.CryptBlocks(ciphertext, plaintext)
+	encrypterB.CryptBlocks(expected, plaintext)
+	assert.Equal(t, expected, ciphertext)
+	assert.NotEqual(t, ciphertextA, ciphertext)
+
+	var decrypted = make([]byte, len(plaintext))
+	decrypter.CryptBlocks(decrypted, ciphertext)
+	assert.Equal(t, plaintext, decrypted)
+
+	// An invalid key is rejected and the previous key is kept.
+	assert.NotNil(t, encrypter.(*ff1Encrypter).SetKey(keyB[:20]))
+	encrypter.CryptBlocks(ciphertext, plaintext)
+	assert.Equal(t, expected, ciphertext)
+}
+
 // This test uses the NIST test vectors to validate the b value.
 func TestGetB(t *testing.T) {
 	for _, test := range ff1Tests {
@@ -2612,6 +2827,58 @@ func TestGetB(t *testing.T) {
 	}
 }
 
+// This test checks that b = ceil(v / 8) for the minimum radix 2, where b is the byte length
+// of a binary string of v bits.
+func TestGetBRadix2(t *testing.T) {
+	for v := uint32(0); v <= 1024; v++ {
+		assert.Equal(t, uint64((v+7)/8), getFF1B(v, minRadixFF1), v)
+	}
+}
+
+// This test checks b against the bit length of radix^v - 1, computed with big integers.
+func TestGetBExact(t *testing.T) {
+	for _, radix := range []uint32{3, 10, 26, 36, 62, 1000, 65535} {
+		for i := 0; i < 100; i++ {
+			var v = uint32(rand.Intn(3000))
+			var radixV = new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(v)), nil)
+			var bitLen = uint64(radixV.Sub(radixV, big.NewInt(1)).BitLen())
+			assert.Equal(t, bitLen, ceilLog2Pow(radix, v))
+			assert.Equal(t, (bitLen+7)/8, getFF1B(v, radix))
+		}
+	}
+}
+
+// This test checks b for large values of v. For radix 3, 190537 * log2(3) and
+// 10781274 * log2(3) are within 10^-7 of an integer, so radix^v is computed. For
+// v = 2^31, the values are computed with 60 significant digits.
+func TestGetBLargeV(t *testing.T) {
+	assert.Equal(t, uint64(301994), ceilLog2Pow(3, 190537))
+	assert.Equal(t, uint64(37750), getFF1B(190537, 3))
+	assert.Equal(t, uint64(17087915), ceilLog2Pow(3, 10781274))
+
+	var tests = []struct {
+		radix    uint32
+		expected uint64
+	}{
+		// 2^31 * log2(10) = 7133786263.602...
+		{10, 891723283},
+		// 2^31 * log2(36) = 11102329401.983...
+		{36, 1387791176},
+		// 2^31 * log2(1000) = 21401358790.807...
+		{1000, 2675169849},
+		// 2^31 * log2(65535) = 34359691093.408...
+		{65535, 4294961387},
+		{maxRadixFF1, 1 << 32},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, getFF1B(1<<31, test.radix), test.radix)
+	}
+
+	// The largest b, for an input of maxInputLenFF1 numerals.
+	assert.Equal(t, uint64(1<<32), getFF1B((maxInputLenFF1+1)/2, maxRadixFF1))
+	assert.Equal(t, uint64(1<<32)+4, getFF1D(1<<32))
+}
+
 // This test uses the NIST test vectors to validate the d value.
 func TestGetD(t *testing.T) {
 	for _, test := range ff1Tests {
@@ -2637,6 +2904,104 @@ func TestGetFF1P(t *testing.T) {
 	}
 }
 
+// The length n is written in the 4-byte field of P, so the inputs longer than 2^32 - 1 must
+// be rejected, and the domain rule must be evaluated exactly for lengths where radix^n does
+// not fit in a float64.
+func TestFF1LengthField(t *testing.T) {
+	assert.Nil(t, ValidateFF1Params(ff1DefaultKeySize, 0, 2, maxInputLenFF1))
+	assert.NotNil(t, ValidateFF1Params(ff1DefaultKeySize, 0, 2, maxInputLenFF1+1))
+	assert.NotNil(t, ValidateFF1Params(ff1DefaultKeySize, 0, 2, 6))
+
+	for _, n := range []int{7, 200, 1100} {
+		assert.Nil(t, ValidateFF1Params(ff1DefaultKeySize, 0, 2, n))
+		assert.Equal(t, []byte{0, 0, byte(n >> 8), byte(n)}, getFF1P(2, uint32(n/2), uint32(n), 0)[8:12])
+
+		var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+		var plaintext = generateRandomNumeralString(2, n)
+		var ciphertext, err = FF1Encrypt(key, tweak, 2, plaintext)
+		assert.Nil(t, err)
+		var decrypted, _ = FF1Decrypt(key, tweak, 2, ciphertext)
+		assert.Equal(t, plaintext, decrypted)
+	}
+}
+
+// At the maximum radix 2^16, the radix takes the 3 bytes of its field in P, and the numerals
+// take the full range of the 2 bytes of their representation.
+func TestFF1MaxRadix(t *testing.T) {
+	assert.Equal(t, []byte{0x01, 0x00, 0x00}, getFF1P(maxRadixFF1, 2, 4, 0)[3:6])
+
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var encrypter, _ = getFF1Encrypter(key, tweak, maxRadixFF1)
+	var decrypter, _ = getFF1Decrypter(key, tweak, maxRadixFF1)
+
+	for _, x := range [][]uint16{
+		{0xffff, 0xffff},
+		{0, 0},
+		{0xffff, 0, 0xffff, 0, 0xffff},
+		generateRandomNumeralString(maxRadixFF1, 100),
+	} {
+		var src = NumeralStringToBytes(x)
+		var ciphertext, decrypted = make([]byte, len(src)), make([]byte, len(src))
+		encrypter.CryptBlocks(ciphertext, src)
+		assert.NotEqual(t, src, ciphertext)
+		decrypter.CryptBlocks(decrypted, ciphertext)
+		assert.Equal(t, src, decrypted)
+	}
+
+	// The radix is not above 2^16.
+	assert.NotNil(t, ValidateFF1Params(ff1DefaultKeySize, 0, maxRadixFF1+1, 2))
+}
+
+func TestGetFF1PBoundaries(t *testing.T) {
+	// Largest radix that fits in 3 bytes, u mod 256, largest n and t.
+	var p = getFF1P(1<<24-1, 256+5, math.MaxUint32, math.MaxUint32)
+	assert.Equal(t, []byte{1, 2, 1, 0xff, 0xff, 0xff, 10, 5, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, p)
+
+	p = getFF1P(maxRadixFF1, 256, 512, maxTweakLenFF1)
+	assert.Equal(t, []byte{1, 2, 1, 0x01, 0x00, 0x00, 10, 0, 0, 0, 0x02, 0x00, 0, 0x01, 0x00, 0x00}, p)
+
+	// The radix does not fit in 3 bytes.
+	assert.Panics(t, func() { getFF1P(1<<24, 1, 2, 0) })
+}
+
+func TestFF1EmptyTweak(t *testing.T) {
+	// With t = 0, the padding z = (-b-1) mod 16 makes the length of q a multiple of 16.
+	for b := uint64(1); b <= 64; b++ {
+		var q = getFF1Q([]byte{}, 10, b, 0, nil)
+		assert.Equal(t, 0, len(q)%blockSizeFF1)
+		assert.True(t, uint64(len(q)) >= b+1 && uint64(len(q)) < b+1+blockSizeFF1)
+	}
+
+	// The NIST samples #1, #4 and #7 use an empty tweak.
+	var nbrSamples int
+	for _, test := range ff1Tests {
+		if len(test.tweak) != 0 {
+			continue
+		}
+		nbrSamples++
+		var result, err = FF1Encrypt(test.key, []byte{}, test.radix, test.in)
+		assert.Nil(t, err)
+		assert.Equal(t, test.out, result)
+	}
+	assert.Equal(t, 3, nbrSamples)
+
+	// Round trip with an empty and a nil tweak, for several radices and lengths.
+	var key, _, _ []byte = getRandomParameters(ff1DefaultKeySize, 0, 0)
+	for _, radix := range []uint32{2, 10, 26, 1000, maxRadixFF1} {
+		for l := MinInputLength(radix); l < 80; l += 7 {
+			var plaintext = generateRandomNumeralString(radix, l)
+			for _, tweak := range [][]byte{{}, nil} {
+				var ciphertext, err = FF1Encrypt(key, tweak, radix, plaintext)
+				assert.Nil(t, err)
+				var decrypted []uint16
+				decrypted, err = FF1Decrypt(key, tweak, radix, ciphertext)
+				assert.Nil(t, err)
+				assert.Equal(t, plaintext, decrypted)
+			}
+		}
+	}
+}
+
 // This test uses the NIST test vectors to validate the q value for each encryption and decryption round.
 func TestGetQ(t *testing.T) {
 	for _, test := range ff1Tests {
@@ -2670,6 +3035,23 @@ func TestGetQ(t *testing.T) {
 	}
 }
 
+// This test checks that prf gives the same result whether its input is given as one byte
+// string or split in several parts.
+func TestPrfParts(t *testing.T) {
+	var key, _, _ []byte = getRandomParameters(ff1DefaultKeySize, 0, 0)
+	var aesBlock, err = aes.NewCipher(key)
+	assert.Nil(t, err)
+	var x = make([]byte, 8*blockSizeFF1)
+	rand.Read(x)
+
+	var expected = prf(aesBlock, x)
+	for i := 0; i <= len(x); i += blockSizeFF1 {
+		assert.Equal(t, expected, prf(aesBlock, x[:i], x[i:]))
+		assert.Equal(t, expected, prf(aesBlock, x[:i], []byte{}, x[i:]))
+	}
+	assert.Equal(t, make([]byte, blockSizeFF1), prf(aesBlock))
+}
+
 // This test uses the NIST test vectors to validate the prf function value for each encryption and decryption round.
 func TestPrf(t *testing.T) {
 	for _, test := range ff1Tests {
@@ -2677,16 +3059,11 @@ func TestPrf(t *testing.T) {
 		var aesBlock, err = aes.NewCipher(test.key)
 		assert.Nil(t, err)
 
-		var iv = make([]byte, blockSizeFF1)
-		var cbcMode = cipher.NewCBCEncrypter(aesBlock, iv)
-		var cbcModeWithSetIV, ok = cbcMode.(cbcWithSetIV)
-		assert.True(t, ok)
-
 		// Iter over each encryption round.
 		for _, round := range test.encRounds {
 			var q = round.q
 			var expectedR = round.r
-			var r = prf(cbcModeWithSetIV, append(p, q...))
+			var r = prf(aesBlock, p, q)
 
 			assert.Equal(t, r, expectedR)
 		}
@@ -2695,7 +3072,7 @@ func TestPrf(t *testing.T) {
 		for _, round := range test.decRounds {
 			var q = round.q
 			var expectedR = round.r
-			var r = prf(cbcModeWithSetIV, append(p, q...))
+			var r = prf(aesBlock, p, q)
 
 			assert.Equal(t, r, expectedR)
 		}
@@ -2729,6 +3106,21 @@ func TestGetS(t *testing.T) {
 	}
 }
 
+// getFF1SWithBuffer must not allocate, even when S spans many blocks, and must return the same
+// S as getFF1S.
+func TestGetFF1SWithBufferAllocs(t *testing.T) {
+	var key, r, _ = getRandomParameters(ff1DefaultKeySize, blockSizeFF1, 0)
+	var aesBlock, _ = aes.NewCipher(key)
+	var d uint64 = 2020
+	var buf = make([]byte, getFF1SLen(d))
+
+	var allocs = testing.AllocsPerRun(10, func() {
+		getFF1SWithBuffer(aesBlock, buf, r, d)
+	})
+	assert.Equal(t, 0.0, allocs)
+	assert.Equal(t, getFF1S(aesBlock, r, d), getFF1SWithBuffer(aesBlock, buf, r, d))
+}
+
 // This test uses the NIST test vectors to validate the y value for each encryption and decryption round.
 func TestGetY(t *testing.T) {
 	for _, test := range ff1Tests {
@@ -2757,7 +3149,7 @@ func TestGetC(t *testing.T) {
 	for _, test := range ff1Tests {
 		var radix = test.radix
 
-		// For the first encryption round, the getFF1CEnc input value x is the input numeral string a.
+		// For the first encryption round, the getCEnc input value x is the input numeral string a.
 		var x = test.a
 		// Iter over each encryption round.
 		for _, round := range test.encRounds {
@@ -2765,21 +3157,21 @@ func TestGetC(t *testing.T) {
 			var y = &round.y
 
 			var expectedC = &round.c
-			var c = getFF1CEnc(x, y, radix, m)
+			var c = getCEnc(x, y, radix, m)
 			// The getFF1Q input x is the numeral string a from the previous round.
 			x = round.a
 
 			assert.Equal(t, c, expectedC)
 		}
 
-		// For the first decryption round, the getFF1CDec input x is the right half of the output numeral string.
+		// For the first decryption round, the getCDec input x is the right half of the output numeral string.
 		x = test.out[test.u:]
 		// Iter over each decryption round.
 		for _, round := range test.decRounds {
 			var m = round.m
 			var y = &round.y
 			var expectedC = &round.c
-			var c = getFF1CDec(x, y, radix, m)
+			var c = getCDec(x, y, radix, m)
 			// The getFF1Q input x is the numeral string b from the previous round.
 			x = round.b
 
@@ -2788,6 +3180,22 @@ func TestGetC(t *testing.T) {
 	}
 }
 
+// This test checks that getCEncUint64 and getCDecUint64 return the same results as their big.Int counterparts.
+func TestGetCUint64(t *testing.T) {
+	for i := 0; i < nbrTests; i++ {
+		var radix, m, radixM = generateRandomUint64Domain()
+		var x = generateRandomNumeralString(radix, int(m))
+		var s = make([]byte, getFF1D(getFF1B(m, radix)))
+		rand.Read(s)
+
+		var expected = getCEnc(x, num(s), radix, m)
+		assert.Equal(t, expected.Uint64(), getCEncUint64(x, s, radix, radixM))
+
+		expected = getCDec(x, num(s), radix, m)
+		assert.Equal(t, expected.Uint64(), getCDecUint64(x, s, radix, radixM))
+	}
+}
+
 // This test generate a random key, tweak, radix and input. It encrypts, then decrpyts the result and check that
 // the decrypted result matches the original plaintext.
 func TestFF1EncryptionDecryption(t *testing.T) {
@@ -2870,6 +3278,34 @@ func TestFF1CornerCases(t *testing.T) {
 	assert.Equal(t, plaintext, decrypted)
 }
 
+// This test encrypts and decrypts binary numeral strings, with the minimum radix 2, from the
+// minimum length 7 (2^7 >= 100) to lengths spanning several AES blocks.
+func TestFF1Radix2(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var radix uint32 = minRadixFF1
+
+	assert.Equal(t, 7, MinInputLength(radix))
+
+	var encrypter, decrypter, err = newFF1BlockModes(key, tweak, radix)
+	assert.Nil(t, err)
+
+	for _, l := range []int{7, 8, 9, 15, 16, 17, 63, 64, 65, 127, 128, 129, 200, 1000} {
+		for i := 0; i < 20; i++ {
+			var plaintext = NumeralStringToBytes(generateRandomNumeralString(radix, l))
+			var ciphertext = make([]byte, len(plaintext))
+			encrypter.CryptBlocks(ciphertext, plaintext)
+			assert.True(t, isNumeralStringValid(BytesToNumeralString(ciphertext), radix))
+
+			var decrypted = make([]byte, len(plaintext))
+			decrypter.CryptBlocks(decrypted, ciphertext)
+			assert.Equal(t, plaintext, decrypted)
+		}
+	}
+
+	// 2^6 < 100
+	assert.Panics(t, func() { encrypter.CryptBlocks(make([]byte, 12), make([]byte, 12)) })
+}
+
 func TestFF1BlockSize(t *testing.T) {
 	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, blockSizeFF1)
 	var radix = uint32(rand.Intn(1000) + minRadixFF1)
@@ -2931,3 +3367,55 @@ type mockBlockMode struct{}
 // Return a BlockMode without SetIv method
 func (c *mockBlockMode) BlockSize() int              { return 16 }
 func (c *mockBlockMode) CryptBlocks(dst, src []byte) {}
+
+// The benchmarks below report the allocations per operation (allocs/op) of CryptBlocks,
+// the buffers used by the Feistel rounds are allocated once per operation.
+func BenchmarkFF1Encrypter(b *testing.B) {
+	benchmarkFF1(b, getFF1Encrypter, ff1DefaultTweakSize, ff1DefaultRadix, 16)
+}
+
+func BenchmarkFF1Decrypter(b *testing.B) {
+	benchmarkFF1(b, getFF1Decrypter, ff1DefaultTweakSize, ff1DefaultRadix, 16)
+}
+
+// With a long tweak and a long input, the PRF input p || q spans many blocks.
+func BenchmarkFF1EncrypterLong(b *testing.B) {
+	benchmarkFF1(b, getFF1Encrypter, 256, ff1DefaultRadix, 1000)
+}
+
+// With the radix 2^16 and a long input, b and d are large, so the S string of each round
+// spans many blocks.
+func BenchmarkFF1EncrypterLargeRadix(b *testing.B) {
+	benchmarkFF1(b, getFF1Encrypter, ff1DefaultTweakSize, maxRadixFF1, 1000)
+}
+
+// The S string of d = 2020 bytes, as for a radix 2^16 and 1000 numerals, is computed in place
+// in the buffer, without allocation.
+func BenchmarkGetFF1SWithBuffer(b *testing.B) {
+	var key, r, _ = getRandomParameters(ff1DefaultKeySize, blockSizeFF1, 0)
+	var aesBlock, _ = aes.NewCipher(key)
+	var d uint64 = 2020
+	var buf = make([]byte, getFF1SLen(d))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		getFF1SWithBuffer(aesBlock, buf, r, d)
+	}
+}
+
+func benchmarkFF1(b *testing.B, getFF1 func(key, tweak []byte, radix uint32) (cipher.BlockMode, error), tweakLen, radix, n int) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, tweakLen, blockSizeFF1)
+	var ff1, err = getFF1(key, tweak, uint32(radix))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var src = NumeralStringToBytes(generateRandomNumeralString(uint32(radix), n))
+	var dst = make([]byte, len(src))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ff1.CryptBlocks(dst, src)
+	}
+}
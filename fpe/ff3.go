@@ -4,6 +4,7 @@
 package fpe
 
 import (
+	"crypto/aes"
 	"crypto/cipher"
 	"fmt"
 	"math"
@@ -20,10 +21,16 @@ const (
 	maxRadixFF3 = 1 << 16
 	// The minimum length of the numeral string is 2.
 	minInputLenFF3 = 2
+	// The domain radix^len must be at least 100.
+	minDomainFF3 = 100
 	// The internal cipher's block size (16 bytes for AES).
 	blockSizeFF3 = 16
 )
 
+// The ff3 struct is never modified by CryptBlocks, which only uses local state, so that
+// a FF3 encrypter or decrypter can be used concurrently by several goroutines. The
+// setters, SetKey included, must be called between calls of CryptBlocks. The FF3-1
+// encrypters and decrypters share this struct and its rules.
 type ff3 struct {
 	aesBlock cipher.Block
 	tweak    []byte
@@ -42,7 +49,8 @@ type ff3Encrypter ff3
 
 // NewFF3Encrypter returns a BlockMode which encrypts in FF3 mode, using the given
 // Block. The given block must be AES, the length of tweak must be 64 bits, and
-// the radix must be in [2..2^16].
+// the radix must be in [2..2^16]. As for NewFF1Encrypter, the block is self-tested.
+// FF3 is kept for backward compatibility, new code should use NewFF31Encrypter.
 func NewFF3Encrypter(aesBlock cipher.Block, tweak []byte, radix uint32) cipher.BlockMode {
 	if len(tweak) != tweakLenFF3 {
 		panic(fmt.Sprintf("NewFF3Encrypter: tweak must be %d bytes.", tweakLenFF3))
@@ -53,12 +61,18 @@ func NewFF3Encrypter(aesBlock cipher.Block, tweak []byte, radix uint32) cipher.B
 	if aesBlock.BlockSize() != blockSizeFF3 {
 		panic(fmt.Sprintf("NewFF3Encrypter: block size must be %d bytes.", blockSizeFF3))
 	}
+	if !isBlockCipher(aesBlock) {
+		panic("NewFF3Encrypter: block does not behave as a block cipher.")
+	}
 	return (*ff3Encrypter)(newFF3(aesBlock, tweak, radix))
 }
 
+// CryptBlocks encrypts the numeral string src, represented as a byte string, with FF3 and
+// writes the result to dst. The src is fully read before dst is written, so dst and src
+// may be the same slice for in-place operation, or may overlap in any way. dst is only
+// written once the result is complete, it is left unchanged if CryptBlocks panics.
 func (x *ff3Encrypter) CryptBlocks(dst, src []byte) {
 	var radix = x.radix
-	var tweak = x.tweak
 
 	// Convert the src byte string to a numeral string. We use this to be compliant with the Go BlockMode interface.
 	var numeralString = BytesToNumeralString(src)
@@ -67,43 +81,39 @@ func (x *ff3Encrypter) CryptBlocks(dst, src []byte) {
 	if n < minInputLenFF3 || n > maxLength(radix) {
 		panic("FF3Encrypter/CryptBlocks: src length not supported.")
 	}
-	if math.Pow(float64(radix), float64(n)) < 100 {
+	if !isDomainLargeEnough(radix, uint64(n), minDomainFF3) {
 		panic("FF3Encrypter/CryptBlocks: radix^len < 100.")
 	}
 	if len(dst) != len(src) {
 		panic("FF3Encrypter/CryptBlocks: src and dst size must be equal.")
 	}
-	if !isNumeralStringValid(numeralString, radix) {
-		panic("FF3Encrypter/CryptBlocks: numeral string not valid.")
+	if i := FirstInvalidNumeral(numeralString, radix); i != -1 {
+		panic(fmt.Sprintf("FF3Encrypter/CryptBlocks: numeral %d (value %d) exceeds radix %d.", i, numeralString[i], radix))
 	}
 
-	var u = uint32(math.Ceil(float64(n) / 2))
-	var v = uint32(n) - u
-	var a = numeralString[:u]
-	var b = numeralString[u:]
-	var tl = tweak[:4]
-	var tr = tweak[4:]
+	x.cryptNumerals(numeralString)
 
-	for i := uint32(0); i < roundsFF3; i++ {
-		var w []byte
-		var m uint32
-		if i%2 == 0 {
-			m = u
-			w = tr
-		} else {
-			m = v
-			w = tl
-		}
-		var p = getFF3P(w, i, radix, b)
-		var s = getFF3S(p, x.aesBlock)
-		var y = num(s)
-		var c = getFF3CEnc(a, y, radix, m)
-		copy(a, rev(strMRadix(radix, m, c)))
-		a, b = b, a
-	}
 	copy(dst, NumeralStringToBytes(numeralString))
 }
 
+// cryptNumerals encrypts the numeral string numeralString in place. It must be a valid input,
+// as checked by CryptBlocks.
+func (x *ff3Encrypter) cryptNumerals(numeralString []uint16) {
+	var u = uint32(math.Ceil(float64(len(numeralString)) / 2))
+	var f = newFF3Feistel(x.aesBlock, x.tweak, x.radix)
+	f.encrypt(numeralString, u)
+}
+
+// CryptBlocksWithTweak is CryptBlocks, but it uses tweak instead of the tweak of x for this
+// call only. The tweak of x is not modified, so that concurrent calls may use different
+// tweaks. The tweak must be 64 bits.
+func (x *ff3Encrypter) CryptBlocksWithTweak(dst, src, tweak []byte) {
+	if len(tweak) != tweakLenFF3 {
+		panic(fmt.Sprintf("FF3Encrypter/CryptBlocksWithTweak: tweak must be %d bytes.", tweakLenFF3))
+	}
+	(*ff3Encrypter)(newFF3(x.aesBlock, tweak, x.radix)).CryptBlocks(dst, src)
+}
+
 func (x *ff3Encrypter) BlockSize() int {
 	return blockSizeFF3
 }
@@ -122,12 +132,43 @@ func (x *ff3Encrypter) SetRadix(radix uint32) {
 	x.radix = radix
 }
 
+// SetKey replaces the AES block with a new one built from key, which must be 16, 24 or
+// 32 bytes. As for NewFF3EncrypterFromKey, the key is given in the byte order of the NIST
+// standard, it is reversed internally.
+func (x *ff3Encrypter) SetKey(key []byte) error {
+	if err := validateKeyLen(len(key)); err != nil {
+		return err
+	}
+	var aesBlock, err = aes.NewCipher(RevB(key))
+	if err != nil {
+		return err
+	}
+	x.aesBlock = aesBlock
+	return nil
+}
+
+func (x *ff3Encrypter) GetTweak() []byte {
+	return dup(x.tweak)
+}
+
+func (x *ff3Encrypter) GetRadix() uint32 {
+	return x.radix
+}
+
+// Reset zeroes the tweak. It does not clear the key schedule held by the AES block,
+// nor the radix. The scratch buffers used by CryptBlocks are local to each call and
+// are not retained.
+func (x *ff3Encrypter) Reset() {
+	zero(x.tweak)
+}
+
 type ff3Decrypter ff3
 
-// NewFF3Decrypter returns a FpeMode which decrypts in FF3 mode, using the given
+// NewFF3Decrypter returns a BlockMode which decrypts in FF3 mode, using the given
 // Block. The given block must be AES, the radix must be in [2..2^16], the
 // length of tweak must be 64 bits and the tweak must be the same as the tweak
 // used to encrypt the data.
+// FF3 is kept for backward compatibility, new code should use NewFF31Decrypter.
 func NewFF3Decrypter(aesBlock cipher.Block, tweak []byte, radix uint32) cipher.BlockMode {
 	if len(tweak) != tweakLenFF3 {
 		panic(fmt.Sprintf("NewFF3Decrypter: tweak must be %d bytes.", tweakLenFF3))
@@ -138,12 +179,18 @@ func NewFF3Decrypter(aesBlock cipher.Block, tweak []byte, radix uint32) cipher.B
 	if aesBlock.BlockSize() != blockSizeFF3 {
 		panic(fmt.Sprintf("NewFF3Decrypter: block size must be %d bytes.", blockSizeFF3))
 	}
+	if !isBlockCipher(aesBlock) {
+		panic("NewFF3Decrypter: block does not behave as a block cipher.")
+	}
 	return (*ff3Decrypter)(newFF3(aesBlock, tweak, radix))
 }
 
+// CryptBlocks decrypts the numeral string src, represented as a byte string, with FF3 and
+// writes the result to dst. The src is fully read before dst is written, so dst and src
+// may be the same slice for in-place operation, or may overlap in any way. dst is only
+// written once the result is complete, it is left unchanged if CryptBlocks panics.
 func (x *ff3Decrypter) CryptBlocks(dst, src []byte) {
 	var radix = x.radix
-	var tweak = x.tweak
 
 	// Convert the src byte string to a numeral string. We use this to be compliant with the Go BlockMode interface.
 	var numeralString = BytesToNumeralString(src)
@@ -152,43 +199,39 @@ func (x *ff3Decrypter) CryptBlocks(dst, src []byte) {
 	if n < minInputLenFF3 || n > maxLength(radix) {
 		panic("FF3Decrypter/CryptBlocks: src length not supported.")
 	}
-	if math.Pow(float64(radix), float64(n)) < 100 {
+	if !isDomainLargeEnough(radix, uint64(n), minDomainFF3) {
 		panic("FF3Decrypter/CryptBlocks: radix^len < 100.")
 	}
 	if len(dst) != len(src) {
 		panic("FF3Decrypter/CryptBlocks: src and dst size must be equal.")
 	}
-	if !isNumeralStringValid(numeralString, radix) {
-		panic("FF3Decrypter/CryptBlocks: numeral string not valid.")
+	if i := FirstInvalidNumeral(numeralString, radix); i != -1 {
+		panic(fmt.Sprintf("FF3Decrypter/CryptBlocks: numeral %d (value %d) exceeds radix %d.", i, numeralString[i], radix))
 	}
 
-	var u = uint32(math.Ceil(float64(n) / 2))
-	var v = uint32(n) - u
-	var a = numeralString[:u]
-	var b = numeralString[u:]
-	var tl = tweak[:4]
-	var tr = tweak[4:]
+	x.cryptNumerals(numeralString)
 
-	for i := roundsFF3 - 1; i >= 0; i-- {
-		var w []byte
-		var m uint32
-		if i%2 == 0 {
-			m = u
-			w = tr
-		} else {
-			m = v
-			w = tl
-		}
-		var p = getFF3P(w, uint32(i), radix, a)
-		var s = getFF3S(p, x.aesBlock)
-		var y = num(s)
-		var c = getFF3CDec(b, y, radix, m)
-		copy(b, rev(strMRadix(radix, m, c)))
-		a, b = b, a
-	}
 	copy(dst, NumeralStringToBytes(numeralString))
 }
 
+// cryptNumerals decrypts the numeral string numeralString in place. It must be a valid input,
+// as checked by CryptBlocks.
+func (x *ff3Decrypter) cryptNumerals(numeralString []uint16) {
+	var u = uint32(math.Ceil(float64(len(numeralString)) / 2))
+	var f = newFF3Feistel(x.aesBlock, x.tweak, x.radix)
+	f.decrypt(numeralString, u)
+}
+
+// CryptBlocksWithTweak is CryptBlocks, but it uses tweak instead of the tweak of x for this
+// call only. The tweak of x is not modified, so that concurrent calls may use different
+// tweaks. The tweak must be 64 bits.
+func (x *ff3Decrypter) CryptBlocksWithTweak(dst, src, tweak []byte) {
+	if len(tweak) != tweakLenFF3 {
+		panic(fmt.Sprintf("FF3Decrypter/CryptBlocksWithTweak: tweak must be %d bytes.", tweakLenFF3))
+	}
+	(*ff3Decrypter)(newFF3(x.aesBlock, tweak, x.radix)).CryptBlocks(dst, src)
+}
+
 func (x *ff3Decrypter) BlockSize() int {
 	return blockSizeFF3
 }
@@ -207,50 +250,148 @@ func (x *ff3Decrypter) SetRadix(radix uint32) {
 	x.radix = radix
 }
 
+// SetKey replaces the AES block with a new one built from key, which must be 16, 24 or
+// 32 bytes. As for NewFF3EncrypterFromKey, the key is given in the byte order of the NIST
+// standard, it is reversed internally.
+func (x *ff3Decrypter) SetKey(key []byte) error {
+	if err := validateKeyLen(len(key)); err != nil {
+		return err
+	}
+	var aesBlock, err = aes.NewCipher(RevB(key))
+	if err != nil {
+		return err
+	}
+	x.aesBlock = aesBlock
+	return nil
+}
+
+func (x *ff3Decrypter) GetTweak() []byte {
+	return dup(x.tweak)
+}
+
+func (x *ff3Decrypter) GetRadix() uint32 {
+	return x.radix
+}
+
+// Reset zeroes the tweak. It does not clear the key schedule held by the AES block,
+// nor the radix. The scratch buffers used by CryptBlocks are local to each call and
+// are not retained.
+func (x *ff3Decrypter) Reset() {
+	zero(x.tweak)
+}
+
+// NumRoundsFF3 returns the number of Feistel rounds of FF3 and FF3-1, which is always 8.
+func NumRoundsFF3() int {
+	return roundsFF3
+}
+
+// MaxInputLengthFF3 takes an integer radix in [2..2^16]. It returns the maximum length of
+// a numeral string that FF3 accepts for this radix, i.e. 2 * floor(log_radix(2^96)).
+func MaxInputLengthFF3(radix uint32) int {
+	if radix < minRadixFF3 || radix > maxRadixFF3 {
+		panic(fmt.Sprintf("MaxInputLengthFF3: radix must be in [%d..%d].", minRadixFF3, maxRadixFF3))
+	}
+	return maxLength(radix)
+}
+
 // maxLength takes an integer radix. It returns the maximum length of the input numeral string
-// computed as maxlen = 2 * floor(log_radix(2^96)).
+// maxlen = 2 * floor(log_radix(2^96)), i.e. twice the largest k such that radix^k <= 2^96.
+// It is computed exactly with big integers, not with floating point logarithms.
 func maxLength(radix uint32) int {
-	return 2 * int(math.Floor(math.Log2(math.Pow(2, 96))/math.Log2(float64(radix))))
+	if radix < minRadixFF3 {
+		return 0
+	}
+
+	var limit = new(big.Int).Lsh(big.NewInt(1), 96)
+	var bigRadix = big.NewInt(int64(radix))
+	var pow = new(big.Int).Set(bigRadix)
+
+	var k int
+	for pow.Cmp(limit) <= 0 {
+		pow.Mul(pow, bigRadix)
+		k++
+	}
+	return 2 * k
+}
+
+// The byte ordering of FF3 is the one of NIST SP 800-38G, which other implementations must
+// follow to decrypt the data encrypted by this one and conversely:
+//   - the AES key is the key K of the standard with its bytes reversed: the constructors
+//     taking an AES block expect aes.NewCipher(RevB(K)), the ones taking a key reverse it,
+//   - the tweak T is split into TL = T[0..3] and TR = T[4..7], the even rounds use TR and
+//     the odd rounds use TL,
+//   - the numerals of a half are reversed before being converted to an integer, so the last
+//     numeral is the most significant one, and the result is reversed back,
+//   - P = W xor [i]4 || [NUM(REV(B))]12, with big-endian integers, and the round output is
+//     S = REV(AES(REV(P))), i.e. the bytes are reversed before and after AES.
+//
+// The NIST samples exercise all of these conventions, so the implementations which pass them,
+// e.g. the capitalone/fpe Go library, compute the same ciphertexts: there is no compatibility
+// mode. The mismatches between libraries rather come from the mapping of the characters to
+// the numerals, the alphabet must be the same on both sides.
+
+// newFF3Feistel takes an AES block, a byte string tweak and an integer radix. It returns
+// the Feistel structure of FF3. The round function uses the right half of the tweak in the
+// even rounds and its left half in the odd rounds.
+func newFF3Feistel(aesBlock cipher.Block, tweak []byte, radix uint32) *feistel {
+	var tl = tweak[:4]
+	var tr = tweak[4:]
+	// The P block is overwritten at each round, getFF3S computes S in it.
+	var p = make([]byte, blockSizeFF3)
+
+	return &feistel{
+		radix:    radix,
+		rounds:   roundsFF3,
+		reversed: true,
+		roundFunction: func(i int, x []uint16) []byte {
+			var w = tl
+			if i%2 == 0 {
+				w = tr
+			}
+			setFF3P(p, w, uint32(i), radix, x)
+			return getFF3S(p, aesBlock)
+		},
+	}
 }
 
 // getFF3P takes a byte string w, the integers i, radix and a numeral string x. It returns
 // p = w xor [i]4 || [numRadix(rev(x))]12, where [x]y means x represented as a string of s bytes.
 func getFF3P(w []byte, i, radix uint32, x []uint16) []byte {
 	var p = make([]byte, blockSizeFF3)
+	setFF3P(p, w, i, radix, x)
+	return p
+}
 
+// setFF3P is getFF3P, but it writes p to the 16-byte p. x is reversed in place to compute
+// numRadix(rev(x)), and reversed back, so it must not be read concurrently.
+func setFF3P(p, w []byte, i, radix uint32, x []uint16) {
 	p[0] = w[0] ^ byte(i>>24)
 	p[1] = w[1] ^ byte(i>>16)
 	p[2] = w[2] ^ byte(i>>8)
 	p[3] = w[3] ^ byte(i)
-	copy(p[4:], getAsBBytes(numRadix(rev(x), radix), 12))
 
-	return p
+	revInPlace(x)
+	if _, fits := radixPowUint64(radix, uint32(len(x))); fits {
+		var y = numRadixUint64(x, radix)
+		for j := blockSizeFF3 - 1; j >= 4; j-- {
+			p[j] = byte(y)
+			y >>= 8
+		}
+	} else {
+		var y = numRadixInto(acquireBigInt(), x, radix)
+		copy(p[4:], getAsBBytes(y, 12))
+		releaseBigInt(y)
+	}
+	revInPlace(x)
 }
 
 // getFF3S takes a byte string p and an AES Block. It returns s = revB(aes.Encrypt(revB(p))).
+// The FF3 specification reverses the bytes around AES, they are reversed in place, so s is
+// computed in p, which is overwritten.
 func getFF3S(p []byte, aesBlock cipher.Block) []byte {
-	var s = RevB(p)
-	aesBlock.Encrypt(s, s)
-	s = RevB(s)
-	return s
-}
-
-// getFF3CEnc takes a numeral string x, and the integers y, radix and m. It returns
-// c = (numRadix(rev(x), radix) + y) mod radix^m.
-func getFF3CEnc(x []uint16, y *big.Int, radix, m uint32) *big.Int {
-	var c = numRadix(rev(x), radix)
-	c.Add(c, y)
-	var radixM = big.NewInt(0).Exp(big.NewInt(int64(radix)), big.NewInt(int64(m)), nil)
-	c.Mod(c, radixM)
-	return c
-}
-
-// getFF3CDec takes a numeral string x, and the integers y, radix and m. It returns
-// c = (numRadix(rev(x), radix) - y) mod radix^m.
-func getFF3CDec(x []uint16, y *big.Int, radix, m uint32) *big.Int {
-	var c = numRadix(rev(x), radix)
-	c.Sub(c, y)
-	var radixM = big.NewInt(0).Exp(big.NewInt(int64(radix)), big.NewInt(int64(m)), nil)
-	c.Mod(c, radixM)
-	return c
+	p = p[:blockSizeFF3:blockSizeFF3]
+	RevBInPlace(p)
+	aesBlock.Encrypt(p, p)
+	RevBInPlace(p)
+	return p
 }
@@ -0,0 +1,258 @@
+package fpe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+)
+
+const (
+	// The tweak must be 7 bytes.
+	tweakLenFF31 = 7
+	// The domain radix^len must be at least 1000000.
+	minDomainFF31 = 1000000
+)
+
+// FF3-1 is the revision of FF3 published in the first revision of NIST SP 800-38G,
+// after the attack of Durak and Vaudenay. It uses a 56-bit tweak and a larger minimum
+// domain size, but the Feistel structure is the one of FF3. FF3-1 should be preferred
+// over FF3.
+
+type ff31Encrypter ff3
+
+// NewFF31Encrypter returns a BlockMode which encrypts in FF3-1 mode, using the given
+// Block. The given block must be AES, the length of tweak must be 56 bits, and
+// the radix must be in [2..2^16]. As for NewFF1Encrypter, the block is self-tested.
+func NewFF31Encrypter(aesBlock cipher.Block, tweak []byte, radix uint32) cipher.BlockMode {
+	if len(tweak) != tweakLenFF31 {
+		panic(fmt.Sprintf("NewFF31Encrypter: tweak must be %d bytes.", tweakLenFF31))
+	}
+	if radix < minRadixFF3 || radix > maxRadixFF3 {
+		panic(fmt.Sprintf("NewFF31Encrypter: radix must be in [%d..%d].", minRadixFF3, maxRadixFF3))
+	}
+	if aesBlock.BlockSize() != blockSizeFF3 {
+		panic(fmt.Sprintf("NewFF31Encrypter: block size must be %d bytes.", blockSizeFF3))
+	}
+	if !isBlockCipher(aesBlock) {
+		panic("NewFF31Encrypter: block does not behave as a block cipher.")
+	}
+	return (*ff31Encrypter)(newFF3(aesBlock, tweak, radix))
+}
+
+// CryptBlocks encrypts the numeral string src, represented as a byte string, with FF3-1 and
+// writes the result to dst. The src is fully read before dst is written, so dst and src
+// may be the same slice for in-place operation, or may overlap in any way. dst is only
+// written once the result is complete, it is left unchanged if CryptBlocks panics.
+func (x *ff31Encrypter) CryptBlocks(dst, src []byte) {
+	var n = NumeralLen(len(src))
+
+	if n < minInputLenFF3 || n > maxLength(x.radix) {
+		panic("FF31Encrypter/CryptBlocks: src length not supported.")
+	}
+	if !isDomainLargeEnough(x.radix, uint64(n), minDomainFF31) {
+		panic(fmt.Sprintf("FF31Encrypter/CryptBlocks: radix^len < %d.", minDomainFF31))
+	}
+
+	var encrypter = newFF3(x.aesBlock, getFF31Tweak(x.tweak), x.radix)
+	(*ff3Encrypter)(encrypter).CryptBlocks(dst, src)
+}
+
+// cryptNumerals encrypts the numeral string numeralString in place. It must be a valid input,
+// as checked by CryptBlocks.
+func (x *ff31Encrypter) cryptNumerals(numeralString []uint16) {
+	var encrypter = newFF3(x.aesBlock, getFF31Tweak(x.tweak), x.radix)
+	(*ff3Encrypter)(encrypter).cryptNumerals(numeralString)
+}
+
+// CryptBlocksWithTweak is CryptBlocks, but it uses tweak instead of the tweak of x for this
+// call only. The tweak of x is not modified, so that concurrent calls may use different
+// tweaks. The tweak must be 56 bits.
+func (x *ff31Encrypter) CryptBlocksWithTweak(dst, src, tweak []byte) {
+	if len(tweak) != tweakLenFF31 {
+		panic(fmt.Sprintf("FF31Encrypter/CryptBlocksWithTweak: tweak must be %d bytes.", tweakLenFF31))
+	}
+	(*ff31Encrypter)(newFF3(x.aesBlock, tweak, x.radix)).CryptBlocks(dst, src)
+}
+
+func (x *ff31Encrypter) BlockSize() int {
+	return blockSizeFF3
+}
+
+func (x *ff31Encrypter) SetTweak(tweak []byte) {
+	if len(tweak) != tweakLenFF31 {
+		panic(fmt.Sprintf("FF31Encrypter/SetTweak: tweak must be %d bytes.", tweakLenFF31))
+	}
+	copy(x.tweak, tweak)
+}
+
+func (x *ff31Encrypter) SetRadix(radix uint32) {
+	if radix < minRadixFF3 || radix > maxRadixFF3 {
+		panic(fmt.Sprintf("FF31Encrypter/SetRadix: radix must be in [%d..%d].", minRadixFF3, maxRadixFF3))
+	}
+	x.radix = radix
+}
+
+// SetKey replaces the AES block with a new one built from key, which must be 16, 24 or
+// 32 bytes. As for NewFF31Cipher, the key is given in the byte order of the NIST standard,
+// it is reversed internally.
+func (x *ff31Encrypter) SetKey(key []byte) error {
+	if err := validateKeyLen(len(key)); err != nil {
+		return err
+	}
+	var aesBlock, err = aes.NewCipher(RevB(key))
+	if err != nil {
+		return err
+	}
+	x.aesBlock = aesBlock
+	return nil
+}
+
+func (x *ff31Encrypter) GetTweak() []byte {
+	return dup(x.tweak)
+}
+
+func (x *ff31Encrypter) GetRadix() uint32 {
+	return x.radix
+}
+
+// Reset zeroes the tweak. It does not clear the key schedule held by the AES block,
+// nor the radix. The scratch buffers used by CryptBlocks are local to each call and
+// are not retained.
+func (x *ff31Encrypter) Reset() {
+	zero(x.tweak)
+}
+
+type ff31Decrypter ff3
+
+// NewFF31Decrypter returns a BlockMode which decrypts in FF3-1 mode, using the given
+// Block. The given block must be AES, the radix must be in [2..2^16], the
+// length of tweak must be 56 bits and the tweak must be the same as the tweak
+// used to encrypt the data.
+func NewFF31Decrypter(aesBlock cipher.Block, tweak []byte, radix uint32) cipher.BlockMode {
+	if len(tweak) != tweakLenFF31 {
+		panic(fmt.Sprintf("NewFF31Decrypter: tweak must be %d bytes.", tweakLenFF31))
+	}
+	if radix < minRadixFF3 || radix > maxRadixFF3 {
+		panic(fmt.Sprintf("NewFF31Decrypter: radix must be in [%d..%d].", minRadixFF3, maxRadixFF3))
+	}
+	if aesBlock.BlockSize() != blockSizeFF3 {
+		panic(fmt.Sprintf("NewFF31Decrypter: block size must be %d bytes.", blockSizeFF3))
+	}
+	if !isBlockCipher(aesBlock) {
+		panic("NewFF31Decrypter: block does not behave as a block cipher.")
+	}
+	return (*ff31Decrypter)(newFF3(aesBlock, tweak, radix))
+}
+
+// CryptBlocks decrypts the numeral string src, represented as a byte string, with FF3-1 and
+// writes the result to dst. The src is fully read before dst is written, so dst and src
+// may be the same slice for in-place operation, or may overlap in any way. dst is only
+// written once the result is complete, it is left unchanged if CryptBlocks panics.
+func (x *ff31Decrypter) CryptBlocks(dst, src []byte) {
+	var n = NumeralLen(len(src))
+
+	if n < minInputLenFF3 || n > maxLength(x.radix) {
+		panic("FF31Decrypter/CryptBlocks: src length not supported.")
+	}
+	if !isDomainLargeEnough(x.radix, uint64(n), minDomainFF31) {
+		panic(fmt.Sprintf("FF31Decrypter/CryptBlocks: radix^len < %d.", minDomainFF31))
+	}
+
+	var decrypter = newFF3(x.aesBlock, getFF31Tweak(x.tweak), x.radix)
+	(*ff3Decrypter)(decrypter).CryptBlocks(dst, src)
+}
+
+// cryptNumerals decrypts the numeral string numeralString in place. It must be a valid input,
+// as checked by CryptBlocks.
+func (x *ff31Decrypter) cryptNumerals(numeralString []uint16) {
+	var decrypter = newFF3(x.aesBlock, getFF31Tweak(x.tweak), x.radix)
+	(*ff3Decrypter)(decrypter).cryptNumerals(numeralString)
+}
+
+// CryptBlocksWithTweak is CryptBlocks, but it uses tweak instead of the tweak of x for this
+// call only. The tweak of x is not modified, so that concurrent calls may use different
+// tweaks. The tweak must be 56 bits.
+func (x *ff31Decrypter) CryptBlocksWithTweak(dst, src, tweak []byte) {
+	if len(tweak) != tweakLenFF31 {
+		panic(fmt.Sprintf("FF31Decrypter/CryptBlocksWithTweak: tweak must be %d bytes.", tweakLenFF31))
+	}
+	(*ff31Decrypter)(newFF3(x.aesBlock, tweak, x.radix)).CryptBlocks(dst, src)
+}
+
+func (x *ff31Decrypter) BlockSize() int {
+	return blockSizeFF3
+}
+
+func (x *ff31Decrypter) SetTweak(tweak []byte) {
+	if len(tweak) != tweakLenFF31 {
+		panic(fmt.Sprintf("FF31Decrypter/SetTweak: tweak must be %d bytes.", tweakLenFF31))
+	}
+	copy(x.tweak, tweak)
+}
+
+func (x *ff31Decrypter) SetRadix(radix uint32) {
+	if radix < minRadixFF3 || radix > maxRadixFF3 {
+		panic(fmt.Sprintf("FF31Decrypter/SetRadix: radix must be in [%d..%d].", minRadixFF3, maxRadixFF3))
+	}
+	x.radix = radix
+}
+
+// SetKey replaces the AES block with a new one built from key, which must be 16, 24 or
+// 32 bytes. As for NewFF31Cipher, the key is given in the byte order of the NIST standard,
+// it is reversed internally.
+func (x *ff31Decrypter) SetKey(key []byte) error {
+	if err := validateKeyLen(len(key)); err != nil {
+		return err
+	}
+	var aesBlock, err = aes.NewCipher(RevB(key))
+	if err != nil {
+		return err
+	}
+	x.aesBlock = aesBlock
+	return nil
+}
+
+func (x *ff31Decrypter) GetTweak() []byte {
+	return dup(x.tweak)
+}
+
+func (x *ff31Decrypter) GetRadix() uint32 {
+	return x.radix
+}
+
+// Reset zeroes the tweak. It does not clear the key schedule held by the AES block,
+// nor the radix. The scratch buffers used by CryptBlocks are local to each call and
+// are not retained.
+func (x *ff31Decrypter) Reset() {
+	zero(x.tweak)
+}
+
+// ConvertFF3TweakToFF31 takes a 64-bit FF3 tweak t. It returns the 56-bit FF3-1 tweak from
+// which FF3-1 derives t (see NIST SP 800-38G Rev. 1, Algorithm 9), to migrate FF3 data to
+// FF3-1. The derivation sets the bits 28..31 and 60..63 of the 64-bit tweak to 0, so only
+// the FF3 tweaks where these bits are 0 have a FF3-1 equivalent: for them, FF3-1 with the
+// returned tweak runs the same rounds as FF3 with t, on the inputs both modes accept. An
+// error is returned for the other tweaks, and if t is not 64 bits. For those, there is no
+// equivalent tweak, the data must be decrypted with FF3 and re-encrypted with FF3-1 and a
+// new 56-bit tweak, whose ciphertexts are not compatible with the FF3 ones.
+func ConvertFF3TweakToFF31(t []byte) ([]byte, error) {
+	if err := validateFF3Tweak(len(t)); err != nil {
+		return nil, err
+	}
+	if t[3]&0x0f != 0 || t[7]&0x0f != 0 {
+		return nil, &ParamError{Field: FieldTweak, Msg: "the bits 28..31 and 60..63 of the tweak must be 0 to have a FF3-1 equivalent"}
+	}
+
+	return []byte{t[0], t[1], t[2], t[3] | t[7]>>4, t[4], t[5], t[6]}, nil
+}
+
+// getFF31Tweak takes a 56-bit tweak t. It returns the 64-bit FF3 tweak tl || tr, where
+// tl = t[0..27] || [0]4 and tr = t[32..55] || t[28..31] || [0]4 (indices are in bits).
+func getFF31Tweak(t []byte) []byte {
+	var out = make([]byte, tweakLenFF3)
+
+	out[0], out[1], out[2], out[3] = t[0], t[1], t[2], t[3]&0xf0
+	out[4], out[5], out[6], out[7] = t[4], t[5], t[6], t[3]<<4
+
+	return out
+}
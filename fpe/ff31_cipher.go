@@ -0,0 +1,50 @@
+package fpe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+)
+
+// NewFF31Cipher returns a FF3Cipher which uses FF3-1 instead of FF3. The key, tweak and
+// alphabet are as for NewFF3Cipher, except that the length of tweak must be 56 bits.
+func NewFF31Cipher(key, tweak []byte, alphabet *Alphabet) (*FF3Cipher, error) {
+	if err := checkAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	var encrypter, decrypter, err = newFF31BlockModes(key, tweak, alphabet.Radix())
+	if err != nil {
+		return nil, err
+	}
+
+	var c = &FF3Cipher{
+		encrypter: encrypter,
+		decrypter: decrypter,
+		alphabet:  alphabet,
+	}
+	if err = c.CheckAlphabet(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newFF31BlockModes returns the FF3-1 encrypter and decrypter for the given key, tweak and radix.
+// It returns an error in the cases where the FF3-1 constructors would panic.
+func newFF31BlockModes(key, tweak []byte, radix uint32) (cipher.BlockMode, cipher.BlockMode, error) {
+	if err := validateKeyLen(len(key)); err != nil {
+		return nil, nil, err
+	}
+	if err := validateFF31Tweak(len(tweak)); err != nil {
+		return nil, nil, err
+	}
+	if err := validateFF3Radix(radix); err != nil {
+		return nil, nil, err
+	}
+
+	// As for FF3, the NIST standard require to reverse the key bytes for FF3-1.
+	var aesBlock, err = aes.NewCipher(RevB(key))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return NewFF31Encrypter(aesBlock, tweak, radix), NewFF31Decrypter(aesBlock, tweak, radix), nil
+}
@@ -0,0 +1,240 @@
+// The FF3-1 method is specified in the first revision of NIST SP 800-38G.
+// NIST did not publish FF3-1 samples alongside the FF1 and FF3 ones, the test
+// vectors below are the FF3-1 vectors used by other implementations
+// (see https://github.com/mysto/python-fpe).
+package fpe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+var ff31Tests = []struct {
+	name  string
+	key   []byte
+	radix uint32
+	tweak []byte
+	in    []uint16
+	out   []uint16
+}{
+	{
+		"Sample #1",
+		ff3CommonKey128,
+		10,
+		[]byte{0xd8, 0xe7, 0x92, 0x0a, 0xfa, 0x33, 0x0a},
+		[]uint16{8, 9, 0, 1, 2, 1, 2, 3, 4, 5, 6, 7, 8, 9, 0, 0, 0, 0},
+		[]uint16{4, 7, 7, 0, 6, 4, 1, 8, 5, 1, 2, 4, 3, 5, 4, 6, 6, 2},
+	},
+	{
+		"Sample #2",
+		[]byte{0x2d, 0xe7, 0x9d, 0x23, 0x2d, 0xf5, 0x58, 0x5d, 0x68, 0xce, 0x47, 0x88, 0x2a, 0xe2, 0x56, 0xd6},
+		10,
+		[]byte{0xcb, 0xd0, 0x92, 0x80, 0x97, 0x95, 0x64},
+		[]uint16{3, 9, 9, 2, 5, 2, 0, 2, 4, 0},
+		[]uint16{8, 9, 0, 1, 8, 0, 1, 1, 0, 6},
+	},
+}
+
+// Test input validation of NewFF31Encrypter and NewFF31Decrypter
+func TestNewFF31(t *testing.T) {
+	var key, _, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF31, 0)
+
+	var aesBlock, err = aes.NewCipher(key)
+	assert.Nil(t, err)
+
+	var constructors = []func(cipher.Block, []byte, uint32) cipher.BlockMode{
+		NewFF31Encrypter,
+		NewFF31Decrypter,
+	}
+
+	for _, newFF31 := range constructors {
+		// Invalid tweak length, the FF3 tweak length is not accepted
+		var f func()
+		f = func() {
+			var tweak = make([]byte, tweakLenFF3)
+			newFF31(aesBlock, tweak, uint32(maxRadixFF3))
+		}
+		assert.Panics(t, f)
+
+		// Invalid radix
+		f = func() {
+			var tweak = make([]byte, tweakLenFF31)
+			newFF31(aesBlock, tweak, uint32(maxRadixFF3+1))
+		}
+		assert.Panics(t, f)
+
+		// Invalid Block
+		f = func() {
+			var tweak = make([]byte, tweakLenFF31)
+			newFF31(&mockBlock{}, tweak, uint32(maxRadixFF3))
+		}
+		assert.Panics(t, f)
+	}
+}
+
+// Test input validation of Crypt method for FF3-1 encrypter and decrypter
+func TestFF31CryptBlocks(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF31, 0)
+	var radix uint32 = 10
+
+	var aesBlock, err = aes.NewCipher(key)
+	assert.Nil(t, err)
+
+	var ff31BlockMode = []cipher.BlockMode{
+		NewFF31Encrypter(aesBlock, tweak, radix),
+		NewFF31Decrypter(aesBlock, tweak, radix),
+	}
+
+	for _, ff31 := range ff31BlockMode {
+		// Test invalid input length
+		var f func()
+		f = func() {
+			var b = NumeralStringToBytes(make([]uint16, 1))
+			ff31.CryptBlocks(b, b)
+		}
+		assert.Panics(t, f)
+
+		// Test radix^len < 1000000, which is accepted by FF3
+		f = func() {
+			var b = NumeralStringToBytes(make([]uint16, 5))
+			ff31.CryptBlocks(b, b)
+		}
+		assert.Panics(t, f)
+
+		// Test radix^len = 1000000
+		f = func() {
+			var b = NumeralStringToBytes(make([]uint16, 6))
+			ff31.CryptBlocks(b, b)
+		}
+		assert.NotPanics(t, f)
+	}
+}
+
+// This test uses the FF3-1 test vectors to validate the encryption and decryption.
+func TestFF31EncrypterDecrypter(t *testing.T) {
+	for _, test := range ff31Tests {
+		// As for FF3, the key bytes must be reversed.
+		var aesBlock, err = aes.NewCipher(RevB(test.key))
+		assert.Nil(t, err)
+
+		var encrypter = NewFF31Encrypter(aesBlock, test.tweak, test.radix)
+		var decrypter = NewFF31Decrypter(aesBlock, test.tweak, test.radix)
+
+		var data = NumeralStringToBytes(test.in)
+		encrypter.CryptBlocks(data, data)
+		assert.Equal(t, test.out, BytesToNumeralString(data), test.name)
+
+		decrypter.CryptBlocks(data, data)
+		assert.Equal(t, test.in, BytesToNumeralString(data), test.name)
+	}
+}
+
+func TestFF31EncryptionDecryption(t *testing.T) {
+	for i := 0; i < nbrFF3Tests; i++ {
+		var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF31, 0)
+		var radix = (rand.Uint32() % (maxRadixFF3 - minRadixFF3)) + minRadixFF3
+		// We take inputs length at random between the smallest length satisfying the
+		// condition radix^len >= 1000000 and maxLength.
+		var minLen = int(math.Ceil(6 / math.Log10(float64(radix))))
+		var l = rand.Intn(maxLength(radix)-minLen+1) + minLen
+
+		var aesBlock, err = aes.NewCipher(key)
+		assert.Nil(t, err)
+		var encrypter = NewFF31Encrypter(aesBlock, tweak, radix)
+		var decrypter = NewFF31Decrypter(aesBlock, tweak, radix)
+
+		var plaintext = generateRandomNumeralString(radix, l)
+		var data = NumeralStringToBytes(plaintext)
+		encrypter.CryptBlocks(data, data)
+		decrypter.CryptBlocks(data, data)
+
+		assert.Equal(t, plaintext, BytesToNumeralString(data))
+	}
+}
+
+// This test check that the functions GetTweak and GetRadix of the FF31Encrypter and FF31Decrypter work correctly.
+func TestGetFF31TweakRadix(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF31, 0)
+	var _, otherTweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF31, 0)
+	var radix = uint32(rand.Intn(1000) + minRadixFF3)
+
+	type fpeWithGetters interface {
+		cipher.BlockMode
+		SetTweak([]byte)
+		SetRadix(uint32)
+		GetTweak() []byte
+		GetRadix() uint32
+	}
+
+	var aesBlock, err = aes.NewCipher(key)
+	assert.Nil(t, err)
+
+	var blockModes = []cipher.BlockMode{
+		NewFF31Encrypter(aesBlock, tweak, radix),
+		NewFF31Decrypter(aesBlock, tweak, radix),
+	}
+
+	for _, blockMode := range blockModes {
+		var ff31, ok = blockMode.(fpeWithGetters)
+		assert.True(t, ok)
+
+		assert.Equal(t, tweak, ff31.GetTweak())
+		assert.Equal(t, radix, ff31.GetRadix())
+
+		// The returned tweak is a copy, modifying it must not modify the internal tweak.
+		var tweakCopy = ff31.GetTweak()
+		tweakCopy[0] ^= 0xff
+		assert.Equal(t, tweak, ff31.GetTweak())
+
+		ff31.SetTweak(otherTweak)
+		ff31.SetRadix(radix + 1)
+		assert.Equal(t, otherTweak, ff31.GetTweak())
+		assert.Equal(t, radix+1, ff31.GetRadix())
+	}
+}
+
+func TestGetFF31Tweak(t *testing.T) {
+	var tweak = []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd}
+	var expected = []byte{0x01, 0x23, 0x45, 0x60, 0x89, 0xab, 0xcd, 0x70}
+
+	assert.Equal(t, expected, getFF31Tweak(tweak))
+}
+
+func TestConvertFF3TweakToFF31(t *testing.T) {
+	// The example of TestGetFF31Tweak, in reverse.
+	var result, err = ConvertFF3TweakToFF31([]byte{0x01, 0x23, 0x45, 0x60, 0x89, 0xab, 0xcd, 0x70})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd}, result)
+
+	for i := 0; i < 100; i++ {
+		var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF31, 0)
+		var ff3Tweak = getFF31Tweak(tweak)
+		result, err = ConvertFF3TweakToFF31(ff3Tweak)
+		assert.Nil(t, err)
+		assert.Equal(t, tweak, result)
+
+		// FF3 with the 64-bit tweak and FF3-1 with the converted tweak are the same.
+		var ff3, _ = NewFF3Cipher(key, ff3Tweak, mustNewAlphabet("0123456789"))
+		var ff31, _ = NewFF31Cipher(key, result, mustNewAlphabet("0123456789"))
+		var ff3Ciphertext, _ = ff3.EncryptString("0123456789")
+		var ff31Ciphertext, _ = ff31.EncryptString("0123456789")
+		assert.Equal(t, ff3Ciphertext, ff31Ciphertext)
+	}
+
+	// Tweaks without FF3-1 equivalent, and invalid lengths.
+	for _, tweak := range [][]byte{
+		{0x01, 0x23, 0x45, 0x61, 0x89, 0xab, 0xcd, 0x70},
+		{0x01, 0x23, 0x45, 0x60, 0x89, 0xab, 0xcd, 0x78},
+		make([]byte, tweakLenFF31),
+		make([]byte, tweakLenFF3+1),
+		nil,
+	} {
+		result, err = ConvertFF3TweakToFF31(tweak)
+		assert.NotNil(t, err)
+		assert.Nil(t, result)
+	}
+}
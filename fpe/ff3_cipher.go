@@ -0,0 +1,190 @@
+package fpe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+)
+
+// FF3Cipher encrypts and decrypts strings over an alphabet with FF3 or FF3-1. It builds
+// the AES block internally, so the caller only provides the key.
+type FF3Cipher struct {
+	encrypter cipher.BlockMode
+	decrypter cipher.BlockMode
+	alphabet  *Alphabet
+}
+
+// NewFF3Cipher returns a FF3Cipher using the given key, tweak and alphabet. The key must
+// be a valid AES key, given in the byte order of the NIST standard (it is reversed
+// internally), the length of tweak must be 64 bits, and the radix of the alphabet must be
+// in [2..2^16]. See NewFF31Cipher for FF3-1.
+func NewFF3Cipher(key, tweak []byte, alphabet *Alphabet) (*FF3Cipher, error) {
+	if err := checkAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	var encrypter, decrypter, err = newFF3BlockModes(key, tweak, alphabet.Radix())
+	if err != nil {
+		return nil, err
+	}
+
+	var c = &FF3Cipher{
+		encrypter: encrypter,
+		decrypter: decrypter,
+		alphabet:  alphabet,
+	}
+	if err = c.CheckAlphabet(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// CheckAlphabet returns an error if the radix of the cipher does not match the number of
+// symbols of its alphabet. It is run by the constructors.
+func (c *FF3Cipher) CheckAlphabet() error {
+	return checkAlphabet(c.alphabet, c.encrypter, c.decrypter)
+}
+
+// EncryptString takes a plaintext made of symbols of the alphabet and returns the
+// corresponding ciphertext, made of symbols of the same alphabet. The ciphertext always has
+// as many symbols as the plaintext: the leading zeros, i.e. the first symbol of the alphabet,
+// are numerals like the others, they are neither dropped nor added.
+func (c *FF3Cipher) EncryptString(plaintext string) (string, error) {
+	return c.cryptString(c.encrypter, plaintext)
+}
+
+// DecryptString takes a ciphertext made of symbols of the alphabet and returns the
+// corresponding plaintext, made of symbols of the same alphabet.
+func (c *FF3Cipher) DecryptString(ciphertext string) (string, error) {
+	return c.cryptString(c.decrypter, ciphertext)
+}
+
+func (c *FF3Cipher) cryptString(mode cipher.BlockMode, s string) (string, error) {
+	var numeralString, err = c.alphabet.ToNumerals(s)
+	if err != nil {
+		return "", err
+	}
+
+	// The input rules differ between FF3 and FF3-1.
+	numeralString, err = cryptModeNumerals(mode, numeralString)
+	if err != nil {
+		return "", err
+	}
+
+	return c.alphabet.ToString(numeralString)
+}
+
+// SetKey replaces the key of the cipher. The key must be a valid AES key, given in the
+// byte order of the NIST standard. It must not be called concurrently with the other
+// methods.
+func (c *FF3Cipher) SetKey(key []byte) error {
+	if err := c.encrypter.(keySetter).SetKey(key); err != nil {
+		return err
+	}
+	return c.decrypter.(keySetter).SetKey(key)
+}
+
+// EncryptNumerals encrypts the numeral string in, whose numerals must be lower than the
+// radix of the alphabet. It works on the numerals directly, without the byte conversions
+// of CryptBlocks. The input is not modified.
+func (c *FF3Cipher) EncryptNumerals(in []uint16) ([]uint16, error) {
+	return cryptModeNumerals(c.encrypter, in)
+}
+
+// DecryptNumerals decrypts the numeral string in, as EncryptNumerals does.
+func (c *FF3Cipher) DecryptNumerals(in []uint16) ([]uint16, error) {
+	return cryptModeNumerals(c.decrypter, in)
+}
+
+// EncryptInPlaceNumerals is EncryptNumerals, but it overwrites x with the ciphertext instead
+// of allocating it. x is validated first, it is left unchanged if an error is returned.
+func (c *FF3Cipher) EncryptInPlaceNumerals(x []uint16) error {
+	return cryptModeNumeralsInPlace(c.encrypter, x)
+}
+
+// DecryptInPlaceNumerals is DecryptNumerals, but it overwrites x with the plaintext, as
+// EncryptInPlaceNumerals does.
+func (c *FF3Cipher) DecryptInPlaceNumerals(x []uint16) error {
+	return cryptModeNumeralsInPlace(c.decrypter, x)
+}
+
+// FF3Encrypt encrypts the numeral string input with FF3, using the given key, tweak and
+// radix. The key must be a valid AES key, given in the byte order of the NIST standard (it
+// is reversed internally), the length of tweak must be 64 bits, and the radix must be in
+// [2..2^16]. The input is not modified.
+func FF3Encrypt(key, tweak []byte, radix uint32, input []uint16) ([]uint16, error) {
+	var encrypter, _, err = newFF3BlockModes(key, tweak, radix)
+	if err != nil {
+		return nil, err
+	}
+	return ff3Crypt(encrypter, radix, input)
+}
+
+// FF3Decrypt decrypts the numeral string input with FF3, using the given key, tweak and
+// radix. The key, tweak and radix must match the ones used to encrypt the data. The input
+// is not modified.
+func FF3Decrypt(key, tweak []byte, radix uint32, input []uint16) ([]uint16, error) {
+	var _, decrypter, err = newFF3BlockModes(key, tweak, radix)
+	if err != nil {
+		return nil, err
+	}
+	return ff3Crypt(decrypter, radix, input)
+}
+
+// NewFF3EncrypterFromKey returns a BlockMode which encrypts in FF3 mode, using the given
+// key, tweak and radix. The key must be 16, 24 or 32 bytes (AES-128, AES-192 or AES-256),
+// given in the byte order of the NIST standard (it is reversed internally). Unlike
+// NewFF3Encrypter, it returns an error instead of panicking if a parameter is not valid.
+func NewFF3EncrypterFromKey(key, tweak []byte, radix uint32) (cipher.BlockMode, error) {
+	var encrypter, _, err = newFF3BlockModes(key, tweak, radix)
+	return encrypter, err
+}
+
+// NewFF3DecrypterFromKey returns a BlockMode which decrypts in FF3 mode, using the given
+// key, tweak and radix, as NewFF3EncrypterFromKey does.
+func NewFF3DecrypterFromKey(key, tweak []byte, radix uint32) (cipher.BlockMode, error) {
+	var _, decrypter, err = newFF3BlockModes(key, tweak, radix)
+	return decrypter, err
+}
+
+// newFF3BlockModes returns the FF3 encrypter and decrypter for the given key, tweak and radix.
+// It returns an error in the cases where the FF3 constructors would panic.
+func newFF3BlockModes(key, tweak []byte, radix uint32) (cipher.BlockMode, cipher.BlockMode, error) {
+	if err := validateKeyLen(len(key)); err != nil {
+		return nil, nil, err
+	}
+	if err := validateFF3Tweak(len(tweak)); err != nil {
+		return nil, nil, err
+	}
+	if err := validateFF3Radix(radix); err != nil {
+		return nil, nil, err
+	}
+
+	// The NIST standard require to reverse the key bytes for FF3.
+	var aesBlock, err = aes.NewCipher(RevB(key))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return NewFF3Encrypter(aesBlock, tweak, radix), NewFF3Decrypter(aesBlock, tweak, radix), nil
+}
+
+// ff3Crypt takes a FF3 encrypter or decrypter, an integer radix and a numeral string x.
+// It returns the encryption or decryption of x, or an error if x is not a valid input.
+func ff3Crypt(mode cipher.BlockMode, radix uint32, x []uint16) ([]uint16, error) {
+	if err := checkFF3Input(x, radix); err != nil {
+		return nil, err
+	}
+
+	var out = append([]uint16(nil), x...)
+	mode.(numeralCrypter).cryptNumerals(out)
+
+	return out, nil
+}
+
+// checkFF3Input takes a numeral string x and an integer radix. It returns an error if x
+// cannot be processed by FF3, i.e. in the cases where CryptBlocks would panic.
+func checkFF3Input(x []uint16, radix uint32) error {
+	if err := validateFF3InputLen(radix, len(x)); err != nil {
+		return err
+	}
+	return validateNumerals(x, radix)
+}
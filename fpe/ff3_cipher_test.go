@@ -0,0 +1,379 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestNewFF3Cipher(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var alphabet, _ = Alphabets("decimal")
+
+	var c, err = NewFF3Cipher(key, tweak, alphabet)
+	assert.Nil(t, err)
+	assert.NotNil(t, c)
+
+	var invalid = []struct {
+		key, tweak []byte
+		alphabet   *Alphabet
+	}{
+		{key[:10], tweak, alphabet},
+		{key, tweak[:tweakLenFF31], alphabet},
+		{key, tweak, generateAlphabet(maxRadixFF3 + 1)},
+	}
+	for _, test := range invalid {
+		c, err = NewFF3Cipher(test.key, test.tweak, test.alphabet)
+		assert.NotNil(t, err)
+		assert.Nil(t, c)
+	}
+
+	// FF3-1 takes a 56-bit tweak.
+	c, err = NewFF31Cipher(key, tweak[:tweakLenFF31], alphabet)
+	assert.Nil(t, err)
+	assert.NotNil(t, c)
+	c, err = NewFF31Cipher(key, tweak, alphabet)
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+}
+
+// This test uses the NIST test vectors with radix 10 to validate EncryptString and DecryptString.
+func TestFF3CipherNIST(t *testing.T) {
+	var alphabet, _ = Alphabets("decimal")
+
+	for _, test := range ff3Tests {
+		if test.radix != alphabet.Radix() {
+			continue
+		}
+		var c, err = NewFF3Cipher(test.key, test.tweak, alphabet)
+		assert.Nil(t, err)
+
+		var plaintext, ciphertext string
+		plaintext, err = alphabet.ToString(test.in)
+		assert.Nil(t, err)
+		ciphertext, err = alphabet.ToString(test.out)
+		assert.Nil(t, err)
+
+		var result string
+		result, err = c.EncryptString(plaintext)
+		assert.Nil(t, err)
+		assert.Equal(t, ciphertext, result)
+
+		result, err = c.DecryptString(ciphertext)
+		assert.Nil(t, err)
+		assert.Equal(t, plaintext, result)
+	}
+}
+
+// A cipher whose radix does not match its alphabet must be reported by CheckAlphabet.
+func TestFF3CipherCheckAlphabet(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var alphabet, _ = Alphabets("decimal")
+	var c, err = NewFF3Cipher(key, tweak, alphabet)
+	assert.Nil(t, err)
+	assert.Nil(t, c.CheckAlphabet())
+
+	_, err = NewFF3Cipher(key, tweak, nil)
+	assert.NotNil(t, err)
+	_, err = NewFF31Cipher(key, tweak[:tweakLenFF31], nil)
+	assert.NotNil(t, err)
+
+	// FF3 with radix 10, and an alphabet of 26 letters.
+	var encrypter, decrypter, _ = newFF3BlockModes(key, tweak, 10)
+	c = &FF3Cipher{encrypter: encrypter, decrypter: decrypter, alphabet: mustNewAlphabet("abcdefghijklmnopqrstuvwxyz")}
+	assert.NotNil(t, c.CheckAlphabet())
+
+	// The radix of the decrypter is checked too.
+	encrypter, decrypter, _ = newFF3BlockModes(key, tweak, 26)
+	decrypter.(FPE).SetRadix(10)
+	c = &FF3Cipher{encrypter: encrypter, decrypter: decrypter, alphabet: mustNewAlphabet("abcdefghijklmnopqrstuvwxyz")}
+	assert.NotNil(t, c.CheckAlphabet())
+}
+
+func TestFF3CipherEncryptionDecryption(t *testing.T) {
+	for _, name := range []string{"decimal", "base36"} {
+		var alphabet, _ = Alphabets(name)
+
+		for i := 0; i < nbrTests; i++ {
+			var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+			var ff3, err = NewFF3Cipher(key, tweak, alphabet)
+			assert.Nil(t, err)
+			var ff31 *FF3Cipher
+			ff31, err = NewFF31Cipher(key, tweak[:tweakLenFF31], alphabet)
+			assert.Nil(t, err)
+
+			var plaintext string
+			plaintext, err = alphabet.ToString(generateRandomNumeralString(alphabet.Radix(), 6+i%(maxLength(alphabet.Radix())-5)))
+			assert.Nil(t, err)
+
+			for _, c := range []*FF3Cipher{ff3, ff31} {
+				var ciphertext, decrypted string
+				ciphertext, err = c.EncryptString(plaintext)
+				assert.Nil(t, err)
+				assert.Equal(t, len(plaintext), len(ciphertext))
+				decrypted, err = c.DecryptString(ciphertext)
+				assert.Nil(t, err)
+				assert.Equal(t, plaintext, decrypted)
+			}
+		}
+	}
+}
+
+// EncryptNumerals and DecryptNumerals must match CryptBlocks on the byte representation.
+func TestFF3CipherNumerals(t *testing.T) {
+	var alphabet, _ = Alphabets("decimal")
+
+	for i := 0; i < nbrTests; i++ {
+		var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+		var ff3, err = NewFF3Cipher(key, tweak, alphabet)
+		assert.Nil(t, err)
+		var ff31 *FF3Cipher
+		ff31, err = NewFF31Cipher(key, tweak[:tweakLenFF31], alphabet)
+		assert.Nil(t, err)
+
+		var plaintext = generateRandomNumeralString(alphabet.Radix(), 6+i%(maxLength(alphabet.Radix())-5))
+
+		for _, c := range []*FF3Cipher{ff3, ff31} {
+			var input = dupNumeralString(plaintext)
+			var ciphertext []uint16
+			ciphertext, err = c.EncryptNumerals(input)
+			assert.Nil(t, err)
+			// The input must not be modified
+			assert.Equal(t, plaintext, input)
+
+			var buf = NumeralStringToBytes(plaintext)
+			c.encrypter.CryptBlocks(buf, buf)
+			assert.Equal(t, BytesToNumeralString(buf), ciphertext)
+
+			var decrypted []uint16
+			decrypted, err = c.DecryptNumerals(ciphertext)
+			assert.Nil(t, err)
+			assert.Equal(t, plaintext, decrypted)
+		}
+	}
+
+	// 10^5 < 10^6 is accepted by FF3 but not by FF3-1.
+	var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var ff3, _ = NewFF3Cipher(key, tweak, alphabet)
+	var ff31, _ = NewFF31Cipher(key, tweak[:tweakLenFF31], alphabet)
+	var _, err = ff3.EncryptNumerals([]uint16{1, 2, 3, 4, 5})
+	assert.Nil(t, err)
+	_, err = ff31.DecryptNumerals([]uint16{1, 2, 3, 4, 5})
+	assert.NotNil(t, err)
+	_, err = ff3.EncryptNumerals([]uint16{1, 2, 3, 4, 10})
+	assert.NotNil(t, err)
+}
+
+// The in-place methods must match EncryptNumerals and DecryptNumerals, and leave an invalid
+// input untouched.
+func TestFF3CipherInPlaceNumerals(t *testing.T) {
+	var alphabet, _ = Alphabets("decimal")
+	var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var ff3, _ = NewFF3Cipher(key, tweak, alphabet)
+	var ff31, _ = NewFF31Cipher(key, tweak[:tweakLenFF31], alphabet)
+
+	for _, c := range []*FF3Cipher{ff3, ff31} {
+		for i := 0; i < 100; i++ {
+			var plaintext = generateRandomNumeralString(alphabet.Radix(), 6+i%(maxLength(alphabet.Radix())-5))
+			var expected, _ = c.EncryptNumerals(plaintext)
+
+			var x = dupNumeralString(plaintext)
+			assert.Nil(t, c.EncryptInPlaceNumerals(x))
+			assert.Equal(t, expected, x)
+			assert.Nil(t, c.DecryptInPlaceNumerals(x))
+			assert.Equal(t, plaintext, x)
+		}
+
+		for _, input := range [][]uint16{{1, 2, 3, 4, 5, 6, 10}, make([]uint16, 57)} {
+			var x = dupNumeralString(input)
+			assert.NotNil(t, c.EncryptInPlaceNumerals(x))
+			assert.Equal(t, input, x)
+			assert.NotNil(t, c.DecryptInPlaceNumerals(x))
+			assert.Equal(t, input, x)
+		}
+	}
+}
+
+func TestFF3CipherSetKey(t *testing.T) {
+	var keyA, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var keyB, _, _ []byte = getRandomParameters(ff3DefaultKeySize, 0, 0)
+	var alphabet, _ = Alphabets("decimal")
+	var c, _ = NewFF3Cipher(keyA, tweak, alphabet)
+	var expected, _ = NewFF3Cipher(keyB, tweak, alphabet)
+
+	assert.Nil(t, c.SetKey(keyB))
+	var ciphertext, err = c.EncryptString("0123456789")
+	assert.Nil(t, err)
+	var want string
+	want, err = expected.EncryptString("0123456789")
+	assert.Nil(t, err)
+	assert.Equal(t, want, ciphertext)
+
+	var plaintext string
+	plaintext, err = c.DecryptString(ciphertext)
+	assert.Nil(t, err)
+	assert.Equal(t, "0123456789", plaintext)
+
+	assert.NotNil(t, c.SetKey(keyB[:15]))
+}
+
+// The leading zeros must be kept, both in the plaintexts and in the ciphertexts.
+func TestFF3CipherLeadingZeros(t *testing.T) {
+	var alphabet, _ = Alphabets("decimal")
+	var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var ff3, _ = NewFF3Cipher(key, tweak, alphabet)
+	var ff31, _ = NewFF31Cipher(key, tweak[:tweakLenFF31], alphabet)
+
+	for _, c := range []*FF3Cipher{ff3, ff31} {
+		for _, s := range []string{"0000000001", "0000000000", "000000"} {
+			var ciphertext, err = c.EncryptString(s)
+			assert.Nil(t, err)
+			assert.Equal(t, len(s), len(ciphertext))
+			var decrypted string
+			decrypted, err = c.DecryptString(ciphertext)
+			assert.Nil(t, err)
+			assert.Equal(t, s, decrypted)
+
+			// s as a ciphertext
+			var plaintext string
+			plaintext, err = c.DecryptString(s)
+			assert.Nil(t, err)
+			assert.Equal(t, len(s), len(plaintext))
+			ciphertext, err = c.EncryptString(plaintext)
+			assert.Nil(t, err)
+			assert.Equal(t, s, ciphertext)
+		}
+	}
+}
+
+func TestFF3CipherErrors(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var alphabet, _ = Alphabets("decimal")
+	var ff3, _ = NewFF3Cipher(key, tweak, alphabet)
+	var ff31, _ = NewFF31Cipher(key, tweak[:tweakLenFF31], alphabet)
+
+	// Not in the alphabet, too short, too long
+	for _, s := range []string{"12345a", "1", strings.Repeat("1", 57)} {
+		var _, err = ff3.EncryptString(s)
+		assert.NotNil(t, err)
+		_, err = ff3.DecryptString(s)
+		assert.NotNil(t, err)
+	}
+
+	// 10^5 < 10^6 is accepted by FF3 but not by FF3-1.
+	var _, err = ff3.EncryptString("12345")
+	assert.Nil(t, err)
+	_, err = ff31.EncryptString("12345")
+	assert.NotNil(t, err)
+}
+
+// This test uses the NIST test vectors to validate FF3Encrypt and FF3Decrypt. The key is
+// given as in the NIST samples, FF3Encrypt and FF3Decrypt reverse it.
+func TestFF3EncryptDecrypt(t *testing.T) {
+	for _, test := range ff3Tests {
+		var input = dupNumeralString(test.in)
+		var result, err = FF3Encrypt(test.key, test.tweak, test.radix, input)
+		assert.Nil(t, err)
+		assert.Equal(t, test.out, result)
+		// The input must not be modified
+		assert.Equal(t, test.in, input)
+
+		result, err = FF3Decrypt(test.key, test.tweak, test.radix, test.out)
+		assert.Nil(t, err)
+		assert.Equal(t, test.in, result)
+	}
+}
+
+// Invalid parameters and inputs must return an error instead of panicking.
+func TestFF3EncryptDecryptErrors(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var radix = uint32(ff3DefaultRadix)
+
+	var tests = []struct {
+		key   []byte
+		tweak []byte
+		radix uint32
+		input []uint16
+	}{
+		// Invalid key length
+		{key[:10], tweak, radix, ff3CommonInput1},
+		// Invalid tweak length
+		{key, tweak[:tweakLenFF31], radix, ff3CommonInput1},
+		// Invalid radix
+		{key, tweak, maxRadixFF3 + 1, ff3CommonInput1},
+		// Invalid input length
+		{key, tweak, radix, []uint16{1}},
+		{key, tweak, radix, make([]uint16, maxLength(radix)+1)},
+		// radix^len < 100
+		{key, tweak, 2, []uint16{0, 1, 0, 1, 0, 1}},
+		// Invalid numeral string
+		{key, tweak, radix, ff3CommonInput3},
+	}
+
+	for _, test := range tests {
+		var f = func() {
+			var result, err = FF3Encrypt(test.key, test.tweak, test.radix, test.input)
+			assert.NotNil(t, err)
+			assert.Nil(t, result)
+			result, err = FF3Decrypt(test.key, test.tweak, test.radix, test.input)
+			assert.NotNil(t, err)
+			assert.Nil(t, result)
+		}
+		assert.NotPanics(t, f)
+	}
+}
+
+// The NIST samples use AES-128, AES-192 and AES-256 keys.
+func TestNewFF3FromKey(t *testing.T) {
+	for _, test := range ff3Tests {
+		var encrypter, err = NewFF3EncrypterFromKey(test.key, test.tweak, test.radix)
+		assert.Nil(t, err)
+		var result = make([]byte, 2*len(test.in))
+		encrypter.CryptBlocks(result, NumeralStringToBytes(test.in))
+		assert.Equal(t, test.out, BytesToNumeralString(result))
+
+		var decrypter cipher.BlockMode
+		decrypter, err = NewFF3DecrypterFromKey(test.key, test.tweak, test.radix)
+		assert.Nil(t, err)
+		decrypter.CryptBlocks(result, NumeralStringToBytes(test.out))
+		assert.Equal(t, test.in, BytesToNumeralString(result))
+	}
+}
+
+func TestFromKeyKeySizes(t *testing.T) {
+	var radix uint32 = 10
+	var input = generateRandomNumeralString(radix, 10)
+
+	for _, keySize := range []int{16, 24, 32} {
+		var key, tweak, _ []byte = getRandomParameters(keySize, tweakLenFF3, 0)
+		var modes = []func() (cipher.BlockMode, error){
+			func() (cipher.BlockMode, error) { return NewFF1EncrypterFromKey(key, tweak, radix) },
+			func() (cipher.BlockMode, error) { return NewFF3EncrypterFromKey(key, tweak, radix) },
+		}
+		for _, newMode := range modes {
+			var mode, err = newMode()
+			assert.Nil(t, err)
+			var result = make([]byte, 2*len(input))
+			mode.CryptBlocks(result, NumeralStringToBytes(input))
+		}
+	}
+
+	// A 20-byte key is rejected with a ParamError.
+	var key, tweak, _ []byte = getRandomParameters(20, tweakLenFF3, 0)
+	var modes = []func() (cipher.BlockMode, error){
+		func() (cipher.BlockMode, error) { return NewFF1EncrypterFromKey(key, tweak, radix) },
+		func() (cipher.BlockMode, error) { return NewFF1DecrypterFromKey(key, tweak, radix) },
+		func() (cipher.BlockMode, error) { return NewFF3EncrypterFromKey(key, tweak, radix) },
+		func() (cipher.BlockMode, error) { return NewFF3DecrypterFromKey(key, tweak, radix) },
+	}
+	for _, newMode := range modes {
+		var mode, err = newMode()
+		assert.Nil(t, mode)
+		var paramErr, ok = err.(*ParamError)
+		assert.True(t, ok)
+		if ok {
+			assert.Equal(t, FieldKey, paramErr.Field)
+		}
+	}
+}
@@ -2545,6 +2545,18 @@ func TestFF3CryptBlocks(t *testing.T) {
 		}
 		assert.Panics(t, f)
 
+		// Test radix^len just below and above 100 (2^6 = 64, 2^7 = 128)
+		f = func() {
+			var b = NumeralStringToBytes(make([]uint16, 6))
+			ff3.CryptBlocks(b, b)
+		}
+		assert.Panics(t, f)
+		f = func() {
+			var b = NumeralStringToBytes(make([]uint16, 7))
+			ff3.CryptBlocks(b, b)
+		}
+		assert.NotPanics(t, f)
+
 		// Test len(dst) != len(src)
 		f = func() {
 			// minInputLenFF3 < 10 and radix^len > 100
@@ -2790,6 +2802,108 @@ func TestSetFF3Radix(t *testing.T) {
 	assert.Panics(t, f)
 }
 
+// maxLength must return the pinned maxima 2 * floor(log_radix(2^96)).
+func TestMaxLength(t *testing.T) {
+	var expected = map[uint32]int{2: 192, 10: 56, 16: 48, 26: 40, 1 << 16: 12}
+	for radix, maxLen := range expected {
+		assert.Equal(t, maxLen, maxLength(radix))
+	}
+
+	// radix^(maxlen/2) <= 2^96 < radix^(maxlen/2 + 1)
+	var limit = new(big.Int).Lsh(big.NewInt(1), 96)
+	for i := 0; i < 100; i++ {
+		var radix = uint32(rand.Intn(maxRadixFF3-minRadixFF3+1) + minRadixFF3)
+		var k = int64(maxLength(radix) / 2)
+		var bigRadix = big.NewInt(int64(radix))
+		assert.True(t, new(big.Int).Exp(bigRadix, big.NewInt(k), nil).Cmp(limit) <= 0)
+		assert.True(t, new(big.Int).Exp(bigRadix, big.NewInt(k+1), nil).Cmp(limit) > 0)
+	}
+}
+
+// This test check that the functions GetTweak and GetRadix of the FF3Encrypter and FF3Decrypter work correctly.
+func TestGetFF3TweakRadix(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var _, otherTweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var radix = uint32(rand.Intn(1000) + minRadixFF3)
+
+	type fpeWithGetters interface {
+		cipher.BlockMode
+		SetTweak([]byte)
+		SetRadix(uint32)
+		GetTweak() []byte
+		GetRadix() uint32
+	}
+
+	var aesBlock, err = aes.NewCipher(key)
+	assert.Nil(t, err)
+
+	var blockModes = []cipher.BlockMode{
+		NewFF3Encrypter(aesBlock, tweak, radix),
+		NewFF3Decrypter(aesBlock, tweak, radix),
+	}
+
+	for _, blockMode := range blockModes {
+		var ff3, ok = blockMode.(fpeWithGetters)
+		assert.True(t, ok)
+
+		assert.Equal(t, tweak, ff3.GetTweak())
+		assert.Equal(t, radix, ff3.GetRadix())
+
+		// The returned tweak is a copy, modifying it must not modify the internal tweak.
+		var tweakCopy = ff3.GetTweak()
+		tweakCopy[0] ^= 0xff
+		assert.Equal(t, tweak, ff3.GetTweak())
+
+		ff3.SetTweak(otherTweak)
+		ff3.SetRadix(radix + 1)
+		assert.Equal(t, otherTweak, ff3.GetTweak())
+		assert.Equal(t, radix+1, ff3.GetRadix())
+	}
+}
+
+// After SetKey, the BlockModes must return the same results as BlockModes built with the new key.
+func TestSetFF3Key(t *testing.T) {
+	var keyA, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var keyB, _, _ []byte = getRandomParameters(24, 0, 0)
+	var radix uint32 = 10
+	var plaintext = NumeralStringToBytes(generateRandomNumeralString(radix, 20))
+
+	var ff3Encrypter, ff3Decrypter, _ = newFF3BlockModes(keyA, tweak, radix)
+	var ff3EncrypterB, _, _ = newFF3BlockModes(keyB, tweak, radix)
+	var ff31Encrypter, ff31Decrypter, _ = newFF31BlockModes(keyA, tweak[:tweakLenFF31], radix)
+	var ff31EncrypterB, _, _ = newFF31BlockModes(keyB, tweak[:tweakLenFF31], radix)
+
+	var tests = []struct {
+		encrypter, decrypter, expected cipher.BlockMode
+	}{
+		{ff3Encrypter, ff3Decrypter, ff3EncrypterB},
+		{ff31Encrypter, ff31Decrypter, ff31EncrypterB},
+	}
+
+	for _, test := range tests {
+		var ciphertextA = make([]byte, len(plaintext))
+		test.encrypter.CryptBlocks(ciphertextA, plaintext)
+
+		assert.Nil(t, test.encrypter.(keySetter).SetKey(keyB))
+		assert.Nil(t, test.decrypter.(keySetter).SetKey(keyB))
+
+		var ciphertext, expected = make([]byte, len(plaintext)), make([]byte, len(plaintext))
+		test.encrypter.CryptBlocks(ciphertext, plaintext)
+		test.expected.CryptBlocks(expected, plaintext)
+		assert.Equal(t, expected, ciphertext)
+		assert.NotEqual(t, ciphertextA, ciphertext)
+
+		var decrypted = make([]byte, len(plaintext))
+		test.decrypter.CryptBlocks(decrypted, ciphertext)
+		assert.Equal(t, plaintext, decrypted)
+
+		// An invalid key is rejected and the previous key is kept.
+		assert.NotNil(t, test.encrypter.(keySetter).SetKey(nil))
+		test.encrypter.CryptBlocks(ciphertext, plaintext)
+		assert.Equal(t, expected, ciphertext)
+	}
+}
+
 // This test uses the NIST test vectors to validate the p value for each encryption and decryption round.
 func TestGetFF3P(t *testing.T) {
 	for _, test := range ff3Tests {
@@ -2846,7 +2960,7 @@ func TestGetFF3S(t *testing.T) {
 		// Iter over each encryption round.
 		var rounds = test.encRounds
 		for _, round := range rounds {
-			var p = round.p
+			var p = dup(round.p)
 			var expectedS = round.s
 			var s = getFF3S(p, aesBlock)
 
@@ -2856,7 +2970,7 @@ func TestGetFF3S(t *testing.T) {
 		// Iter over each decryption round.
 		rounds = test.decRounds
 		for _, round := range rounds {
-			var p = round.p
+			var p = dup(round.p)
 			var expectedS = round.s
 			var s = getFF3S(p, aesBlock)
 
@@ -2909,7 +3023,7 @@ func TestGetFF3C(t *testing.T) {
 			var y = &round.y
 
 			var expectedC = &round.c
-			var c = getFF3CEnc(x, y, radix, m)
+			var c = getCEnc(rev(x), y, radix, m)
 			// The x value is the numeral string a from the previous round.
 			x = round.a
 
@@ -2931,7 +3045,7 @@ func TestGetFF3C(t *testing.T) {
 			var y = &round.y
 
 			var expectedC = &round.c
-			var c = getFF3CDec(x, y, radix, m)
+			var c = getCDec(rev(x), y, radix, m)
 			// The x value is the numeral string b from the previous round.
 			x = round.b
 
@@ -3017,6 +3131,108 @@ func TestFF3CornerCases(t *testing.T) {
 	assert.Equal(t, plaintext, decrypted)
 }
 
+// This test encrypts and decrypts binary numeral strings, with the minimum radix 2, from the
+// minimum length 7 (2^7 >= 100) to the maximum length 192.
+func TestFF3Radix2(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var radix uint32 = minRadixFF3
+
+	assert.Equal(t, 192, maxLength(radix))
+
+	var encrypter, decrypter, err = newFF3BlockModes(key, tweak, radix)
+	assert.Nil(t, err)
+
+	for _, l := range []int{7, 8, 9, 15, 16, 17, 63, 64, 65, 127, 128, 129, 191, 192} {
+		for i := 0; i < 20; i++ {
+			var plaintext = NumeralStringToBytes(generateRandomNumeralString(radix, l))
+			var ciphertext = make([]byte, len(plaintext))
+			encrypter.CryptBlocks(ciphertext, plaintext)
+			assert.True(t, isNumeralStringValid(BytesToNumeralString(ciphertext), radix))
+
+			var decrypted = make([]byte, len(plaintext))
+			decrypter.CryptBlocks(decrypted, ciphertext)
+			assert.Equal(t, plaintext, decrypted)
+		}
+	}
+
+	// 2^6 < 100 and 193 > maxLength(2)
+	assert.Panics(t, func() { encrypter.CryptBlocks(make([]byte, 12), make([]byte, 12)) })
+	assert.Panics(t, func() { encrypter.CryptBlocks(make([]byte, 386), make([]byte, 386)) })
+}
+
+// ff3Reference is a direct transcription of Algorithm 9 (FF3.Encrypt) of NIST SP 800-38G,
+// without the in-place halves of the Feistel structure. The key of aesBlock must be reversed.
+func ff3Reference(aesBlock cipher.Block, tweak []byte, radix uint32, x []uint16) []uint16 {
+	var n = len(x)
+	var u = (n + 1) / 2
+	var v = n - u
+	var a, b = dupNumeralString(x[:u]), dupNumeralString(x[u:])
+	var tl, tr = tweak[:4], tweak[4:]
+
+	for i := 0; i < 8; i++ {
+		var m, w = u, tr
+		if i%2 == 1 {
+			m, w = v, tl
+		}
+
+		var p = make([]byte, 16)
+		for j := 0; j < 4; j++ {
+			p[j] = w[j]
+		}
+		p[3] ^= byte(i)
+		var numB = numRadixReference(rev(b), radix).Bytes()
+		copy(p[16-len(numB):], numB)
+
+		var s = make([]byte, 16)
+		aesBlock.Encrypt(s, RevB(p))
+		var y = new(big.Int).SetBytes(RevB(s))
+
+		var radixM = new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(m)), nil)
+		var c = new(big.Int).Add(numRadixReference(rev(a), radix), y)
+		c.Mod(c, radixM)
+
+		var cStr = make([]uint16, m)
+		var bigRadix, r = big.NewInt(int64(radix)), new(big.Int)
+		for j := m - 1; j >= 0; j-- {
+			c.DivMod(c, bigRadix, r)
+			cStr[j] = uint16(r.Int64())
+		}
+		a, b = b, rev(cStr)
+	}
+	return append(a, b...)
+}
+
+// For odd lengths, A is one numeral longer than B, so each round must use the length of the
+// half it modifies, together with the matching half of the tweak. The results are checked
+// against ff3Reference.
+func TestFF3OddLength(t *testing.T) {
+	// The reference itself is checked with the NIST samples, some of which have odd lengths.
+	for _, test := range ff3Tests {
+		var aesBlock, _ = aes.NewCipher(RevB(test.key))
+		assert.Equal(t, test.out, ff3Reference(aesBlock, test.tweak, test.radix, test.in))
+	}
+
+	for _, radix := range []uint32{10, 26} {
+		for _, n := range []int{7, 11, 15} {
+			for i := 0; i < 20; i++ {
+				var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+				var encrypter, decrypter, err = newFF3BlockModes(key, tweak, radix)
+				assert.Nil(t, err)
+				var aesBlock, _ = aes.NewCipher(RevB(key))
+
+				var plaintext = generateRandomNumeralString(radix, n)
+				var ciphertext = NumeralStringToBytes(plaintext)
+				encrypter.CryptBlocks(ciphertext, ciphertext)
+				assert.Equal(t, ff3Reference(aesBlock, tweak, radix, plaintext), BytesToNumeralString(ciphertext))
+
+				var decrypted = make([]byte, len(ciphertext))
+				decrypter.CryptBlocks(decrypted, ciphertext)
+				assert.Equal(t, plaintext, BytesToNumeralString(decrypted))
+			}
+		}
+	}
+}
+
 func TestFF3BlockSize(t *testing.T) {
 	var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
 	var radix = uint32(rand.Intn(1000) + minRadixFF3)
@@ -3063,3 +3279,63 @@ func getFF3Decrypter(key, tweak []byte, radix uint32) (cipher.BlockMode, error)
 
 	return decrypter, nil
 }
+
+// The benchmarks below report the allocations per operation (allocs/op) of CryptBlocks. The
+// numerals are reversed in place, so the rounds only allocate when radix^m does not fit in
+// a uint64.
+func BenchmarkFF3Encrypter(b *testing.B) {
+	benchmarkFF3(b, getFF3Encrypter, 16)
+}
+
+func BenchmarkFF3Decrypter(b *testing.B) {
+	benchmarkFF3(b, getFF3Decrypter, 16)
+}
+
+// With 56 decimal numerals, the halves do not fit in a uint64.
+func BenchmarkFF3EncrypterLong(b *testing.B) {
+	benchmarkFF3(b, getFF3Encrypter, maxLength(uint32(ff3DefaultRadix)))
+}
+
+func benchmarkFF3(b *testing.B, getFF3 func(key, tweak []byte, radix uint32) (cipher.BlockMode, error), n int) {
+	var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var ff3, err = getFF3(key, tweak, uint32(ff3DefaultRadix))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var src = NumeralStringToBytes(generateRandomNumeralString(uint32(ff3DefaultRadix), n))
+	var dst = make([]byte, len(src))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ff3.CryptBlocks(dst, src)
+	}
+}
+
+// At the maximum radix 2^16, the numerals take the full range of the 2 bytes of their
+// representation, and the inputs at most maxLength(2^16) = 12 numerals.
+func TestFF3MaxRadix(t *testing.T) {
+	assert.Equal(t, 12, maxLength(maxRadixFF3))
+
+	var key, tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var encrypter, _ = getFF3Encrypter(key, tweak, maxRadixFF3)
+	var decrypter, _ = getFF3Decrypter(key, tweak, maxRadixFF3)
+
+	for _, x := range [][]uint16{
+		{0xffff, 0xffff},
+		{0, 0},
+		{0xffff, 0, 0xffff, 0, 0xffff},
+		{0xffff, 0xffff, 0xffff, 0xffff, 0xffff, 0xffff, 0xffff, 0xffff, 0xffff, 0xffff, 0xffff, 0xffff},
+		generateRandomNumeralString(maxRadixFF3, 12),
+	} {
+		var src = NumeralStringToBytes(x)
+		var ciphertext, decrypted = make([]byte, len(src)), make([]byte, len(src))
+		encrypter.CryptBlocks(ciphertext, src)
+		assert.NotEqual(t, src, ciphertext)
+		decrypter.CryptBlocks(decrypted, ciphertext)
+		assert.Equal(t, src, decrypted)
+	}
+
+	var tooLong = make([]byte, EncodedByteLen(13))
+	assert.Panics(t, func() { encrypter.CryptBlocks(tooLong, tooLong) })
+}
@@ -0,0 +1,46 @@
+package fpe
+
+import (
+	"fmt"
+)
+
+// JoinFields concatenates the numeral strings parts into a single numeral string, so that
+// several fields can be encrypted together as one domain. The fields are recovered from
+// the result, or from its ciphertext, with SplitFields and the lengths of the parts.
+func JoinFields(parts ...[]uint16) []uint16 {
+	var n int
+	for _, p := range parts {
+		n += len(p)
+	}
+
+	var out = make([]uint16, 0, n)
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// SplitFields splits the numeral string s into consecutive fields of the given lengths, as
+// joined by JoinFields. It returns an error if a length is negative or if the lengths do
+// not sum to len(s). The fields are copies, s is not modified.
+func SplitFields(s []uint16, lengths ...int) ([][]uint16, error) {
+	var sum int
+	for i, l := range lengths {
+		if l < 0 {
+			return nil, fmt.Errorf("fpe: length %d of field %d is negative", l, i)
+		}
+		sum += l
+	}
+	if sum != len(s) {
+		return nil, fmt.Errorf("fpe: field lengths sum to %d, numeral string length is %d", sum, len(s))
+	}
+
+	var out = make([][]uint16, len(lengths))
+	var start int
+	for i, l := range lengths {
+		out[i] = make([]uint16, l)
+		copy(out[i], s[start:start+l])
+		start += l
+	}
+	return out, nil
+}
@@ -0,0 +1,54 @@
+package fpe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestJoinSplitFields(t *testing.T) {
+	var areaCode, exchange, line = []uint16{4, 1, 5}, []uint16{5, 5, 5}, []uint16{0, 1, 9, 9}
+
+	var joined = JoinFields(areaCode, exchange, line)
+	assert.Equal(t, []uint16{4, 1, 5, 5, 5, 5, 0, 1, 9, 9}, joined)
+
+	var fields, err = SplitFields(joined, 3, 3, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]uint16{areaCode, exchange, line}, fields)
+
+	// Joint encryption: the ciphertext is split into fields of the same widths.
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var ciphertext []uint16
+	ciphertext, err = FF1Encrypt(key, tweak, 10, joined)
+	assert.Nil(t, err)
+	fields, err = SplitFields(ciphertext, 3, 3, 4)
+	assert.Nil(t, err)
+	assert.Len(t, fields[0], 3)
+	assert.Len(t, fields[1], 3)
+	assert.Len(t, fields[2], 4)
+
+	var decrypted []uint16
+	decrypted, err = FF1Decrypt(key, tweak, 10, JoinFields(fields...))
+	assert.Nil(t, err)
+	assert.Equal(t, joined, decrypted)
+
+	// Empty fields
+	assert.Equal(t, []uint16{}, JoinFields())
+	fields, err = SplitFields([]uint16{1, 2}, 0, 2, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]uint16{{}, {1, 2}, {}}, fields)
+
+	// The fields do not share memory with the input.
+	fields, _ = SplitFields(joined, 3, 3, 4)
+	fields[0][0] = 9
+	assert.Equal(t, uint16(4), joined[0])
+}
+
+func TestSplitFieldsErrors(t *testing.T) {
+	var s = []uint16{1, 2, 3, 4}
+
+	for _, lengths := range [][]int{{1, 2}, {2, 3}, {5, -1}, {}} {
+		var fields, err = SplitFields(s, lengths...)
+		assert.Nil(t, fields)
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,97 @@
+package fpe
+
+import (
+	"fmt"
+)
+
+// Format describes the values of a template such as "999-999-9999": the positions holding
+// the wildcard are encrypted, over an alphabet, and the other characters are literals, which
+// the values must contain at the same positions and which are kept unchanged.
+type Format struct {
+	template []rune
+	wildcard rune
+	alphabet *Alphabet
+	// n is the number of wildcards, i.e. the length of the numeral strings encrypted.
+	n int
+}
+
+// NewFormat returns the Format of the template, where the positions holding wildcard take a
+// symbol of alphabet. E.g. NewFormat("999-99-9999", '9', decimal) describes the US social
+// security numbers. It returns an error if the alphabet is nil or its radix is not in
+// [2..2^16], or if there are not enough wildcards for FF1, e.g. less than 2 for radix 10.
+func NewFormat(template string, wildcard rune, alphabet *Alphabet) (*Format, error) {
+	if alphabet == nil {
+		return nil, fmt.Errorf("fpe: alphabet must not be nil")
+	}
+	if err := validateFF1Radix(alphabet.Radix()); err != nil {
+		return nil, err
+	}
+
+	var f = &Format{
+		template: []rune(template),
+		wildcard: wildcard,
+		alphabet: alphabet,
+	}
+	for _, r := range f.template {
+		if r == wildcard {
+			f.n++
+		}
+	}
+	if err := validateFF1InputLen(alphabet.Radix(), f.n); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Encrypt takes a value matching the template of the format, i.e. with the literals of the
+// template at their positions and symbols of the alphabet at the positions of the wildcards.
+// It encrypts the symbols together with FF1, and returns the value where they are replaced
+// by the ciphertext. The key must be a valid AES key and the length of tweak must be in
+// [0..maxTweakLenFF1].
+func (f *Format) Encrypt(key, tweak []byte, value string) (string, error) {
+	return f.crypt(key, tweak, value, FF1Encrypt)
+}
+
+// Decrypt takes a value returned by Encrypt and returns the original value. The key and
+// tweak must match the ones used to encrypt it.
+func (f *Format) Decrypt(key, tweak []byte, value string) (string, error) {
+	return f.crypt(key, tweak, value, FF1Decrypt)
+}
+
+func (f *Format) crypt(key, tweak []byte, value string, crypt func(key, tweak []byte, radix uint32, input []uint16) ([]uint16, error)) (string, error) {
+	var runes = []rune(value)
+	if len(runes) != len(f.template) {
+		return "", fmt.Errorf("fpe: value has %d characters, the template has %d", len(runes), len(f.template))
+	}
+
+	var symbols = make([]rune, 0, f.n)
+	for i, r := range f.template {
+		if r == f.wildcard {
+			symbols = append(symbols, runes[i])
+		} else if runes[i] != r {
+			return "", fmt.Errorf("fpe: character %d of the value is %q, the template has %q", i, runes[i], r)
+		}
+	}
+
+	var numerals, err = f.alphabet.ToNumerals(string(symbols))
+	if err != nil {
+		return "", err
+	}
+	if numerals, err = crypt(key, tweak, f.alphabet.Radix(), numerals); err != nil {
+		return "", err
+	}
+	var result string
+	if result, err = f.alphabet.ToString(numerals); err != nil {
+		return "", err
+	}
+
+	var encrypted = []rune(result)
+	var j int
+	for i, r := range f.template {
+		if r == f.wildcard {
+			runes[i] = encrypted[j]
+			j++
+		}
+	}
+	return string(runes), nil
+}
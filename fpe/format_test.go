@@ -0,0 +1,91 @@
+package fpe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var decimal = mustNewAlphabet("0123456789")
+
+	for _, test := range []struct {
+		template string
+		wildcard rune
+		alphabet *Alphabet
+		value    string
+	}{
+		// Phone number
+		{"999-999-9999", '9', decimal, "415-555-0199"},
+		{"(###) ###-####", '#', decimal, "(415) 555-0199"},
+		// Social security number
+		{"999-99-9999", '9', decimal, "078-05-1120"},
+		// The wildcard and the literals may be any rune.
+		{"ref:**.**.**", '*', mustNewAlphabet("abcdef"), "ref:ab.cd.ef"},
+		{"№ ☐☐☐", '☐', decimal, "№ 042"},
+	} {
+		var f, err = NewFormat(test.template, test.wildcard, test.alphabet)
+		assert.Nil(t, err)
+
+		var ciphertext string
+		ciphertext, err = f.Encrypt(key, tweak, test.value)
+		assert.Nil(t, err)
+		// With a random key, the ciphertext equals the plaintext once in radix^n runs, so
+		// the inequality is only checked for the large domains.
+		var n = strings.Count(test.template, string(test.wildcard))
+		if DomainSize(test.alphabet.Radix(), n).Cmp(big.NewInt(1e9)) >= 0 {
+			assert.NotEqual(t, test.value, ciphertext)
+		}
+
+		// The literals are kept, the other characters are symbols of the alphabet.
+		var template, runes = []rune(test.template), []rune(ciphertext)
+		assert.Equal(t, len(template), len(runes))
+		for i, r := range template {
+			if r != test.wildcard {
+				assert.Equal(t, r, runes[i])
+			} else {
+				var _, err = test.alphabet.ToNumerals(string(runes[i]))
+				assert.Nil(t, err)
+			}
+		}
+
+		var plaintext string
+		plaintext, err = f.Decrypt(key, tweak, ciphertext)
+		assert.Nil(t, err)
+		assert.Equal(t, test.value, plaintext)
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var decimal = mustNewAlphabet("0123456789")
+
+	// Invalid formats
+	var _, err = NewFormat("999-999-9999", '9', nil)
+	assert.NotNil(t, err)
+	_, err = NewFormat("9-x", '9', decimal)
+	assert.NotNil(t, err)
+	_, err = NewFormat("xxx", '9', decimal)
+	assert.NotNil(t, err)
+
+	// Values not matching the template
+	var f, _ = NewFormat("999-99-9999", '9', decimal)
+	for _, value := range []string{
+		"",
+		"078-05-112",
+		"078-05-11200",
+		"078/05/1120",
+		"078-05-112a",
+	} {
+		var result string
+		result, err = f.Encrypt(key, tweak, value)
+		assert.NotNil(t, err, value)
+		assert.Equal(t, "", result)
+	}
+
+	// Invalid key
+	_, err = f.Encrypt(key[:10], tweak, "078-05-1120")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,101 @@
+package fpe
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+// The fuzz tests below only run their seed corpus with go test. Run them with, e.g.,
+// go test -fuzz FuzzFF1RoundTrip to generate new inputs.
+
+// The maximum number of numerals of the fuzzed inputs, to keep each run fast.
+const maxFuzzInputLen = 256
+
+func FuzzConversions(f *testing.F) {
+	f.Add([]byte{}, uint8(0))
+	f.Add([]byte{0x00, 0x01, 0xff, 0xfe}, uint8(4))
+	f.Add([]byte{0x01, 0x02, 0x03}, uint8(2))
+	f.Add([]byte{0x00, 0x00, 0x80}, uint8(1))
+
+	f.Fuzz(func(t *testing.T, b []byte, size uint8) {
+		// Numeral strings: 2 bytes per numeral, odd lengths are rejected.
+		if len(b)%2 != 0 {
+			assert.Panics(t, func() { BytesToNumeralString(b) })
+		} else {
+			var x = BytesToNumeralString(b)
+			assert.Len(t, x, len(b)/2)
+			assert.Equal(t, b, NumeralStringToBytes(x))
+		}
+
+		// getAsBBytes writes num(b) on size bytes, or panics if it does not fit.
+		var n = new(big.Int).SetBytes(b)
+		if (n.BitLen()+7)/8 > int(size) {
+			assert.Panics(t, func() { getAsBBytes(n, uint64(size)) })
+		} else {
+			var out = getAsBBytes(n, uint64(size))
+			assert.Len(t, out, int(size))
+			assert.Equal(t, 0, n.Cmp(new(big.Int).SetBytes(out)))
+		}
+	})
+}
+
+func FuzzFF1RoundTrip(f *testing.F) {
+	f.Add(make([]byte, 16), []byte{}, uint32(10), []byte{0, 1, 0, 2, 0, 3})
+	f.Add(bytes.Repeat([]byte{0x2b}, 32), []byte("tweak"), uint32(36), bytes.Repeat([]byte{0, 35}, 40))
+	f.Add(bytes.Repeat([]byte{0x7e}, 24), []byte{1}, uint32(0), bytes.Repeat([]byte{0xff}, 14))
+
+	f.Fuzz(func(t *testing.T, key, tweak []byte, radix uint32, input []byte) {
+		radix %= maxRadixFF1 + 1
+		var x, ok = fuzzNumeralString(radix, input)
+		if !ok || ValidateFF1Params(len(key), len(tweak), radix, len(x)) != nil {
+			t.Skip()
+		}
+
+		var ciphertext, err = FF1Encrypt(key, tweak, radix, x)
+		assert.Nil(t, err)
+		assert.True(t, isNumeralStringValid(ciphertext, radix))
+
+		var decrypted []uint16
+		decrypted, err = FF1Decrypt(key, tweak, radix, ciphertext)
+		assert.Nil(t, err)
+		assert.Equal(t, x, decrypted)
+	})
+}
+
+func FuzzFF3RoundTrip(f *testing.F) {
+	f.Add(make([]byte, 16), make([]byte, 8), uint32(10), []byte{0, 1, 0, 2, 0, 3})
+	f.Add(bytes.Repeat([]byte{0x2b}, 32), []byte("abcdefgh"), uint32(26), bytes.Repeat([]byte{0, 25}, 20))
+
+	f.Fuzz(func(t *testing.T, key, tweak []byte, radix uint32, input []byte) {
+		radix %= maxRadixFF3 + 1
+		var x, ok = fuzzNumeralString(radix, input)
+		if !ok || ValidateFF3Params(len(key), len(tweak), radix, len(x)) != nil {
+			t.Skip()
+		}
+
+		var ciphertext, err = FF3Encrypt(key, tweak, radix, x)
+		assert.Nil(t, err)
+		assert.True(t, isNumeralStringValid(ciphertext, radix))
+
+		var decrypted []uint16
+		decrypted, err = FF3Decrypt(key, tweak, radix, ciphertext)
+		assert.Nil(t, err)
+		assert.Equal(t, x, decrypted)
+	})
+}
+
+// fuzzNumeralString takes an integer radix and a fuzzed byte string b. It returns a valid
+// numeral string built from b, with each numeral reduced modulo radix, and false if there is
+// no such numeral string.
+func fuzzNumeralString(radix uint32, b []byte) ([]uint16, bool) {
+	if radix == 0 || len(b)/2 > maxFuzzInputLen {
+		return nil, false
+	}
+	var x = BytesToNumeralString(b[:len(b)-len(b)%2])
+	for i := range x {
+		x[i] = uint16(uint32(x[i]) % radix)
+	}
+	return x, true
+}
@@ -0,0 +1,58 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"math/bits"
+)
+
+// EncryptUint64 encrypts the integer value in [0..n[ with FF1 and returns another integer in
+// [0..n[. The value is written in binary, on just enough bits for n - 1, and encrypted with
+// cycle walking: FF1 is applied until the result falls back in [0..n[. As the binary domain
+// is less than twice n, it takes less than 2 encryptions on average. The n must be at least
+// 100, to satisfy the minimum domain size of FF1, the key must be a valid AES key and the
+// length of tweak must be in [0..maxTweakLenFF1].
+func EncryptUint64(key, tweak []byte, value, n uint64) (uint64, error) {
+	return cryptUint64(key, tweak, value, n, func(enc, _ cipher.BlockMode) cipher.BlockMode { return enc })
+}
+
+// DecryptUint64 takes an integer returned by EncryptUint64 and returns the original integer.
+// The key, tweak and n must match the ones used to encrypt it.
+func DecryptUint64(key, tweak []byte, value, n uint64) (uint64, error) {
+	return cryptUint64(key, tweak, value, n, func(_, dec cipher.BlockMode) cipher.BlockMode { return dec })
+}
+
+func cryptUint64(key, tweak []byte, value, n uint64, selectMode func(enc, dec cipher.BlockMode) cipher.BlockMode) (uint64, error) {
+	if n < minDomainFF1 {
+		return 0, fmt.Errorf("fpe: n must be at least %d", minDomainFF1)
+	}
+	if value >= n {
+		return 0, fmt.Errorf("fpe: value must be in [0..%d[", n)
+	}
+
+	var encrypter, decrypter, err = newFF1BlockModes(key, tweak, minRadixFF1)
+	if err != nil {
+		return 0, err
+	}
+
+	return cycleWalkUint64(selectMode(encrypter, decrypter), minRadixFF1, uint32(bits.Len64(n-1)), value, n)
+}
+
+// cycleWalkUint64 takes a FF1 encrypter or decrypter, the integers radix and m, and the
+// integers x and n, with x < n <= radix^m. It returns the image of x by the permutation of
+// [0..n[ obtained by cycle walking: x is written as a numeral string of length m, which is
+// encrypted or decrypted until its value falls back in [0..n[. As the input is in [0..n[,
+// this terminates, and the same walk with the inverse mode recovers x. The value of the
+// numeral strings, radix^m - 1, must fit in a uint64.
+func cycleWalkUint64(mode cipher.BlockMode, radix, m uint32, x, n uint64) (uint64, error) {
+	for {
+		var y, err = cryptModeNumerals(mode, strMRadixUint64(radix, m, x))
+		if err != nil {
+			return 0, err
+		}
+		x = numRadixUint64(y, radix)
+		if x < n {
+			return x, nil
+		}
+	}
+}
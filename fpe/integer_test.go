@@ -0,0 +1,54 @@
+package fpe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestEncryptDecryptUint64(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+
+	// Powers of 2, where there is no cycle walking, and worst cases just above them.
+	for _, n := range []uint64{100, 128, 129, 1000, 1 << 20, 1<<20 + 1, 1<<63 + 1, math.MaxUint64} {
+		for i := 0; i < 50; i++ {
+			var value = rand.Uint64() % n
+			var encrypted, err = EncryptUint64(key, tweak, value, n)
+			assert.Nil(t, err)
+			assert.True(t, encrypted < n)
+
+			var decrypted uint64
+			decrypted, err = DecryptUint64(key, tweak, encrypted, n)
+			assert.Nil(t, err)
+			assert.Equal(t, value, decrypted)
+		}
+	}
+}
+
+func TestEncryptUint64IsPermutation(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var n uint64 = 300
+
+	var seen = make([]bool, n)
+	for value := uint64(0); value < n; value++ {
+		var encrypted, err = EncryptUint64(key, tweak, value, n)
+		assert.Nil(t, err)
+		assert.False(t, seen[encrypted])
+		seen[encrypted] = true
+	}
+}
+
+func TestEncryptUint64Errors(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+
+	// n < 100, value not in [0..n[, invalid key
+	var _, err = EncryptUint64(key, tweak, 5, 99)
+	assert.NotNil(t, err)
+	_, err = EncryptUint64(key, tweak, 100, 100)
+	assert.NotNil(t, err)
+	_, err = DecryptUint64(key, tweak, 100, 100)
+	assert.NotNil(t, err)
+	_, err = EncryptUint64(key[:10], tweak, 5, 100)
+	assert.NotNil(t, err)
+}
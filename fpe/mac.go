@@ -0,0 +1,146 @@
+package fpe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// The tag length must be in [minTagLen..blockSizeFF1] bytes.
+	minTagLen = 4
+)
+
+// FPE only provides the confidentiality of the values, within their format: a ciphertext
+// modified by an attacker decrypts to another valid plaintext, without any error. The
+// functions below add an integrity check, at the cost of a tag stored next to the
+// ciphertext, which is not format-preserving.
+
+// FF1EncryptWithTag encrypts the numeral string plaintext with FF1, as FF1Encrypt does, and
+// returns the ciphertext and a tag of tagLen bytes, in [4..16], which authenticates the
+// plaintext, the tweak, the radix and the tag length. The tag is an AES-CMAC (NIST SP
+// 800-38B), truncated to tagLen bytes, under a key derived from key with AES, so that key
+// is not used both for FF1 and for CMAC. It is deterministic: equal plaintexts have equal
+// tags. The tags shorter than 8 bytes can be forged by trial and error, SP 800-38B
+// recommends at least 8 bytes.
+func FF1EncryptWithTag(key, tweak []byte, radix uint32, plaintext []uint16, tagLen int) ([]uint16, []byte, error) {
+	if tagLen < minTagLen || tagLen > blockSizeFF1 {
+		return nil, nil, fmt.Errorf("fpe: tag length must be in [%d..%d], got %d", minTagLen, blockSizeFF1, tagLen)
+	}
+
+	var ciphertext, err = FF1Encrypt(key, tweak, radix, plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	var tag []byte
+	if tag, err = getFF1Tag(key, tweak, radix, plaintext, tagLen); err != nil {
+		return nil, nil, err
+	}
+	return ciphertext, tag, nil
+}
+
+// FF1DecryptWithTag takes a ciphertext and a tag returned by FF1EncryptWithTag. It decrypts
+// the ciphertext with FF1 and returns the plaintext if the tag matches it, or an error if the
+// ciphertext, the tag, the tweak or the radix were modified, or if the key is not the one
+// used to encrypt it.
+func FF1DecryptWithTag(key, tweak []byte, radix uint32, ciphertext []uint16, tag []byte) ([]uint16, error) {
+	if len(tag) < minTagLen || len(tag) > blockSizeFF1 {
+		return nil, fmt.Errorf("fpe: tag length must be in [%d..%d], got %d", minTagLen, blockSizeFF1, len(tag))
+	}
+
+	var plaintext, err = FF1Decrypt(key, tweak, radix, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	var expected []byte
+	if expected, err = getFF1Tag(key, tweak, radix, plaintext, len(tag)); err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(expected, tag) != 1 {
+		return nil, fmt.Errorf("fpe: tag does not match, the data was modified")
+	}
+	return plaintext, nil
+}
+
+// getFF1Tag takes the parameters of a FF1 encryption, the numeral string plaintext and the
+// tag length tagLen. It returns the first tagLen bytes of the CMAC of
+// [tagLen]1 || [radix]4 || [len(tweak)]4 || tweak || NumeralStringToBytes(plaintext), under
+// the key derived by getTagKey. The lengths make the encoding unambiguous, and the tag length
+// is authenticated so that a tag truncated after the encryption does not verify.
+func getFF1Tag(key, tweak []byte, radix uint32, plaintext []uint16, tagLen int) ([]byte, error) {
+	var aesBlock, err = aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	var tagBlock cipher.Block
+	if tagBlock, err = aes.NewCipher(getTagKey(aesBlock)); err != nil {
+		return nil, err
+	}
+
+	var msg = make([]byte, 9, 9+len(tweak)+EncodedByteLen(len(plaintext)))
+	msg[0] = byte(tagLen)
+	binary.BigEndian.PutUint32(msg[1:5], radix)
+	binary.BigEndian.PutUint32(msg[5:9], uint32(len(tweak)))
+	msg = append(msg, tweak...)
+	msg = append(msg, NumeralStringToBytes(plaintext)...)
+
+	return cmac(tagBlock, msg)[:tagLen], nil
+}
+
+// getTagKey takes the AES block of the FF1 key. It returns the 32-byte key of the tags, the
+// encryption of two constant blocks. They differ from the P blocks, the only fixed blocks
+// that FF1 encrypts, which start with 1, 2, 1 where these ones start with 0xff.
+func getTagKey(aesBlock cipher.Block) []byte {
+	var out = make([]byte, 2*blockSizeFF1)
+	for i := 0; i < 2; i++ {
+		var block = out[blockSizeFF1*i : blockSizeFF1*(i+1) : blockSizeFF1*(i+1)]
+		copy(block, "\xfffpe tag key")
+		block[blockSizeFF1-1] = byte(i)
+		aesBlock.Encrypt(block, block)
+	}
+	return out
+}
+
+// cmac takes an AES block and a byte string msg. It returns the 16-byte AES-CMAC of msg
+// (NIST SP 800-38B, RFC 4493).
+func cmac(aesBlock cipher.Block, msg []byte) []byte {
+	// The subkeys are L = AES(0) doubled once and twice in GF(2^128).
+	var k1 = make([]byte, blockSizeFF1)
+	aesBlock.Encrypt(k1, k1)
+	cmacDouble(k1)
+	var k2 = dup(k1)
+	cmacDouble(k2)
+
+	// All the blocks but the last one are chained as in CBC-MAC. The last block is xored
+	// with K1 if it is complete, and padded with 10* and xored with K2 otherwise.
+	var nbrFull int
+	if len(msg) > 0 {
+		nbrFull = (len(msg) - 1) / blockSizeFF1
+	}
+	var out = make([]byte, blockSizeFF1)
+	cbcMACUpdate(aesBlock, out, msg[:nbrFull*blockSizeFF1])
+
+	var last = make([]byte, blockSizeFF1)
+	var rest = msg[nbrFull*blockSizeFF1:]
+	copy(last, rest)
+	if len(rest) == blockSizeFF1 {
+		xorBytes(last, last, k1)
+	} else {
+		last[len(rest)] = 0x80
+		xorBytes(last, last, k2)
+	}
+	cbcMACUpdate(aesBlock, out, last)
+
+	return out
+}
+
+// cmacDouble multiplies the 16-byte x by 2 in GF(2^128), in place.
+func cmacDouble(x []byte) {
+	var msb = x[0] >> 7
+	for i := 0; i < len(x)-1; i++ {
+		x[i] = x[i]<<1 | x[i+1]>>7
+	}
+	x[len(x)-1] = x[len(x)-1]<<1 ^ 0x87*msb
+}
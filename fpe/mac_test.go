@@ -0,0 +1,94 @@
+package fpe
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// The test vectors of RFC 4493.
+func TestCMAC(t *testing.T) {
+	var key, _ = hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	var msg, _ = hex.DecodeString("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710")
+	var aesBlock, _ = aes.NewCipher(key)
+
+	for _, test := range []struct {
+		len int
+		tag string
+	}{
+		{0, "bb1d6929e95937287fa37d129b756746"},
+		{16, "070a16b46b4d4144f79bdd9dd04a287c"},
+		{40, "dfa66747de9ae63030ca32611497c827"},
+		{64, "51f0bebf7e3b9d92fc49741779363cfe"},
+	} {
+		var expected, _ = hex.DecodeString(test.tag)
+		assert.Equal(t, expected, cmac(aesBlock, msg[:test.len]))
+	}
+}
+
+func TestFF1WithTag(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var plaintext = generateRandomNumeralString(10, 16)
+
+	for tagLen := minTagLen; tagLen <= blockSizeFF1; tagLen++ {
+		var ciphertext, tag, err = FF1EncryptWithTag(key, tweak, 10, plaintext, tagLen)
+		assert.Nil(t, err)
+		assert.Len(t, tag, tagLen)
+
+		// The ciphertext is the FF1 one, and the tag is deterministic.
+		var expected, _ = FF1Encrypt(key, tweak, 10, plaintext)
+		assert.Equal(t, expected, ciphertext)
+		var _, tagAgain, _ = FF1EncryptWithTag(key, tweak, 10, plaintext, tagLen)
+		assert.Equal(t, tag, tagAgain)
+
+		var decrypted []uint16
+		decrypted, err = FF1DecryptWithTag(key, tweak, 10, ciphertext, tag)
+		assert.Nil(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	}
+}
+
+// A modification of the ciphertext, the tag, the tweak, the radix or the key must be detected.
+func TestFF1WithTagTampering(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var plaintext = generateRandomNumeralString(10, 16)
+	var ciphertext, tag, _ = FF1EncryptWithTag(key, tweak, 10, plaintext, 8)
+
+	var modifiedCiphertext = append([]uint16(nil), ciphertext...)
+	modifiedCiphertext[3] = (modifiedCiphertext[3] + 1) % 10
+	var modifiedTag = append([]byte(nil), tag...)
+	modifiedTag[0] ^= 1
+	var modifiedTweak = append([]byte(nil), tweak...)
+	modifiedTweak[0] ^= 1
+	var modifiedKey = append([]byte(nil), key...)
+	modifiedKey[0] ^= 1
+
+	for _, test := range []struct {
+		key, tweak []byte
+		radix      uint32
+		ciphertext []uint16
+		tag        []byte
+	}{
+		{key, tweak, 10, modifiedCiphertext, tag},
+		{key, tweak, 10, ciphertext, modifiedTag},
+		{key, tweak, 10, ciphertext, tag[:7]},
+		{key, modifiedTweak, 10, ciphertext, tag},
+		{key, tweak, 11, ciphertext, tag},
+		{modifiedKey, tweak, 10, ciphertext, tag},
+		{key, tweak, 10, ciphertext, nil},
+		{key, tweak, 10, ciphertext, make([]byte, 17)},
+	} {
+		var result, err = FF1DecryptWithTag(test.key, test.tweak, test.radix, test.ciphertext, test.tag)
+		assert.NotNil(t, err)
+		assert.Nil(t, result)
+	}
+
+	// Invalid tag lengths and parameters
+	for _, tagLen := range []int{0, minTagLen - 1, blockSizeFF1 + 1} {
+		var _, _, err = FF1EncryptWithTag(key, tweak, 10, plaintext, tagLen)
+		assert.NotNil(t, err)
+	}
+	var _, _, err = FF1EncryptWithTag(key[:10], tweak, 10, plaintext, 8)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,110 @@
+// Known-answer tests with the sample data published by NIST for FF1 and FF3
+// (http://csrc.nist.gov/groups/ST/toolkit/documents/Examples/FF1samples.pdf and
+// http://csrc.nist.gov/groups/ST/toolkit/documents/Examples/FF3samples.pdf).
+// The numeral strings are written as in the samples, with the symbols 0-9a-z.
+// Unlike ff1_test.go and ff3_test.go, these tests only check the inputs and outputs
+// of the block modes, not the intermediate values of each Feistel round.
+package fpe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type nistSample struct {
+	sample     int
+	key        string
+	radix      uint32
+	tweak      string
+	plaintext  string
+	ciphertext string
+}
+
+var nistFF1Samples = []nistSample{
+	{1, "2b7e151628aed2a6abf7158809cf4f3c", 10, "", "0123456789", "2433477484"},
+	{2, "2b7e151628aed2a6abf7158809cf4f3c", 10, "39383736353433323130", "0123456789", "6124200773"},
+	{3, "2b7e151628aed2a6abf7158809cf4f3c", 36, "3737373770717273373737", "0123456789abcdefghi", "a9tv40mll9kdu509eum"},
+	{4, "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f", 10, "", "0123456789", "2830668132"},
+	{5, "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f", 10, "39383736353433323130", "0123456789", "2496655549"},
+	{6, "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f", 36, "3737373770717273373737", "0123456789abcdefghi", "xbj3kv35jrawxv32ysr"},
+	{7, "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f7f036d6f04fc6a94", 10, "", "0123456789", "6657667009"},
+	{8, "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f7f036d6f04fc6a94", 10, "39383736353433323130", "0123456789", "1001623463"},
+	{9, "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f7f036d6f04fc6a94", 36, "3737373770717273373737", "0123456789abcdefghi", "xs8a0azh2avyalyzuwd"},
+}
+
+var nistFF3Samples = []nistSample{
+	{1, "ef4359d8d580aa4f7f036d6f04fc6a94", 10, "d8e7920afa330a73", "890121234567890000", "750918814058654607"},
+	{2, "ef4359d8d580aa4f7f036d6f04fc6a94", 10, "9a768a92f60e12d8", "890121234567890000", "018989839189395384"},
+	{3, "ef4359d8d580aa4f7f036d6f04fc6a94", 10, "d8e7920afa330a73", "89012123456789000000789000000", "48598367162252569629397416226"},
+	{4, "ef4359d8d580aa4f7f036d6f04fc6a94", 10, "0000000000000000", "89012123456789000000789000000", "34695224821734535122613701434"},
+	{5, "ef4359d8d580aa4f7f036d6f04fc6a94", 26, "9a768a92f60e12d8", "0123456789abcdefghi", "g2pk40i992fn20cjakb"},
+	{6, "ef4359d8d580aa4f7f036d6f04fc6a942b7e151628aed2a6", 10, "d8e7920afa330a73", "890121234567890000", "646965393875028755"},
+	{7, "ef4359d8d580aa4f7f036d6f04fc6a942b7e151628aed2a6", 10, "9a768a92f60e12d8", "890121234567890000", "961610514491424446"},
+	{8, "ef4359d8d580aa4f7f036d6f04fc6a942b7e151628aed2a6", 10, "d8e7920afa330a73", "89012123456789000000789000000", "53048884065350204541786380807"},
+	{9, "ef4359d8d580aa4f7f036d6f04fc6a942b7e151628aed2a6", 10, "0000000000000000", "89012123456789000000789000000", "98083802678820389295041483512"},
+	{10, "ef4359d8d580aa4f7f036d6f04fc6a942b7e151628aed2a6", 26, "9a768a92f60e12d8", "0123456789abcdefghi", "i0ihe2jfj7a9opf9p88"},
+	{11, "ef4359d8d580aa4f7f036d6f04fc6a942b7e151628aed2a6abf7158809cf4f3c", 10, "d8e7920afa330a73", "890121234567890000", "922011205562777495"},
+	{12, "ef4359d8d580aa4f7f036d6f04fc6a942b7e151628aed2a6abf7158809cf4f3c", 10, "9a768a92f60e12d8", "890121234567890000", "504149865578056140"},
+	{13, "ef4359d8d580aa4f7f036d6f04fc6a942b7e151628aed2a6abf7158809cf4f3c", 10, "d8e7920afa330a73", "89012123456789000000789000000", "04344343235792599165734622699"},
+	{14, "ef4359d8d580aa4f7f036d6f04fc6a942b7e151628aed2a6abf7158809cf4f3c", 10, "0000000000000000", "89012123456789000000789000000", "30859239999374053872365555822"},
+	{15, "ef4359d8d580aa4f7f036d6f04fc6a942b7e151628aed2a6abf7158809cf4f3c", 26, "9a768a92f60e12d8", "0123456789abcdefghi", "p0b2godfja9bhb7bk38"},
+}
+
+func TestNISTFF1Samples(t *testing.T) {
+	for _, sample := range nistFF1Samples {
+		var key, tweak, plaintext, ciphertext = decodeNISTSample(t, sample)
+
+		var encrypter, err = getFF1Encrypter(key, tweak, sample.radix)
+		assert.Nil(t, err)
+		var data = plaintext.Bytes()
+		encrypter.CryptBlocks(data, data)
+		assert.Equal(t, ciphertext, NumeralStringFromBytes(data), fmt.Sprintf("FF1 sample #%d", sample.sample))
+
+		var decrypter cipher.BlockMode
+		decrypter, err = getFF1Decrypter(key, tweak, sample.radix)
+		assert.Nil(t, err)
+		decrypter.CryptBlocks(data, data)
+		assert.Equal(t, plaintext, NumeralStringFromBytes(data), fmt.Sprintf("FF1 sample #%d", sample.sample))
+	}
+}
+
+func TestNISTFF3Samples(t *testing.T) {
+	for _, sample := range nistFF3Samples {
+		var key, tweak, plaintext, ciphertext = decodeNISTSample(t, sample)
+
+		// The NIST standard require to reverse the key bytes for FF3.
+		var aesBlock, err = aes.NewCipher(RevB(key))
+		assert.Nil(t, err)
+
+		var encrypter = NewFF3Encrypter(aesBlock, tweak, sample.radix)
+		var data = plaintext.Bytes()
+		encrypter.CryptBlocks(data, data)
+		assert.Equal(t, ciphertext, NumeralStringFromBytes(data), fmt.Sprintf("FF3 sample #%d", sample.sample))
+
+		var decrypter = NewFF3Decrypter(aesBlock, tweak, sample.radix)
+		decrypter.CryptBlocks(data, data)
+		assert.Equal(t, plaintext, NumeralStringFromBytes(data), fmt.Sprintf("FF3 sample #%d", sample.sample))
+	}
+}
+
+func decodeNISTSample(t *testing.T, sample nistSample) (key, tweak []byte, plaintext, ciphertext NumeralString) {
+	var alphabet = mustNewAlphabet("0123456789abcdefghijklmnopqrstuvwxyz")
+	var err error
+
+	key, err = hex.DecodeString(sample.key)
+	assert.Nil(t, err)
+	tweak, err = hex.DecodeString(sample.tweak)
+	assert.Nil(t, err)
+	plaintext, err = alphabet.ToNumerals(sample.plaintext)
+	assert.Nil(t, err)
+	ciphertext, err = alphabet.ToNumerals(sample.ciphertext)
+	assert.Nil(t, err)
+
+	assert.True(t, plaintext.IsValid(sample.radix))
+	assert.True(t, ciphertext.IsValid(sample.radix))
+	return
+}
@@ -0,0 +1,47 @@
+package fpe
+
+import (
+	"fmt"
+)
+
+// PadToMinLength takes a numeral string input and an integer radix in [2..2^16]. If input is
+// shorter than MinInputLength(radix), it returns a copy of input left-padded with zero
+// numerals up to this length, and the number of numerals added. Otherwise, it returns a copy
+// of input and 0. The padding changes the domain: the ciphertext of a padded input has the
+// padded length, and its leading numerals are not zeros, so the format of the input is not
+// preserved. The padding must be applied in the same way on both sides: the padded ciphertext
+// is decrypted as is, and Unpad removes the zeros from the plaintext. The pad count is not
+// secret, but it must be known to Unpad, e.g. from the length of the field.
+func PadToMinLength(input []uint16, radix uint32) ([]uint16, int) {
+	if radix < minRadixFF1 || radix > maxRadixFF1 {
+		panic(fmt.Sprintf("PadToMinLength: radix must be in [%d..%d].", minRadixFF1, maxRadixFF1))
+	}
+
+	var padLen = MinInputLength(radix) - len(input)
+	if padLen < 0 {
+		padLen = 0
+	}
+
+	var out = make([]uint16, padLen+len(input))
+	copy(out[padLen:], input)
+	return out, padLen
+}
+
+// Unpad takes a numeral string x padded by PadToMinLength, once decrypted, and the pad count
+// padLen. It returns a copy of x without its first padLen numerals. It returns an error if
+// padLen is not in [0..len(x)], or if one of the removed numerals is not 0, which means that
+// x was not padded with this pad count or was decrypted with other parameters.
+func Unpad(x []uint16, padLen int) ([]uint16, error) {
+	if padLen < 0 || padLen > len(x) {
+		return nil, fmt.Errorf("fpe: pad count %d out of range of input of length %d", padLen, len(x))
+	}
+	for i := 0; i < padLen; i++ {
+		if x[i] != 0 {
+			return nil, fmt.Errorf("fpe: padding numeral %d is %d, not 0", i, x[i])
+		}
+	}
+
+	var out = make([]uint16, len(x)-padLen)
+	copy(out, x[padLen:])
+	return out, nil
+}
@@ -0,0 +1,63 @@
+package fpe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPadToMinLength(t *testing.T) {
+	// Radix 10: 10^2 = 100 is the boundary, so 2 numerals need no padding.
+	var out, padLen = PadToMinLength([]uint16{7}, 10)
+	assert.Equal(t, []uint16{0, 7}, out)
+	assert.Equal(t, 1, padLen)
+	out, padLen = PadToMinLength([]uint16{4, 2}, 10)
+	assert.Equal(t, []uint16{4, 2}, out)
+	assert.Equal(t, 0, padLen)
+	out, padLen = PadToMinLength(nil, 10)
+	assert.Equal(t, []uint16{0, 0}, out)
+	assert.Equal(t, 2, padLen)
+
+	// Radix 2: 2^6 = 64 < 100 <= 2^7 = 128.
+	out, padLen = PadToMinLength([]uint16{1, 0, 1, 1, 0, 1}, 2)
+	assert.Equal(t, []uint16{0, 1, 0, 1, 1, 0, 1}, out)
+	assert.Equal(t, 1, padLen)
+	out, padLen = PadToMinLength([]uint16{1, 0, 1, 1, 0, 1, 1}, 2)
+	assert.Equal(t, []uint16{1, 0, 1, 1, 0, 1, 1}, out)
+	assert.Equal(t, 0, padLen)
+
+	// The input is copied.
+	var input = []uint16{1, 2, 3}
+	out, _ = PadToMinLength(input, 10)
+	out[0] = 9
+	assert.Equal(t, []uint16{1, 2, 3}, input)
+
+	assert.Panics(t, func() { PadToMinLength(input, 1) })
+	assert.Panics(t, func() { PadToMinLength(input, maxRadixFF1+1) })
+}
+
+func TestUnpad(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+
+	for _, radix := range []uint32{2, 3, 10, 99, 100} {
+		for n := 0; n <= MinInputLength(radix); n++ {
+			var input = generateRandomNumeralString(radix, n)
+			var padded, padLen = PadToMinLength(input, radix)
+			assert.Equal(t, MinInputLength(radix), len(padded))
+
+			var ciphertext, err = FF1Encrypt(key, tweak, radix, padded)
+			assert.Nil(t, err)
+			var decrypted, _ = FF1Decrypt(key, tweak, radix, ciphertext)
+			var result []uint16
+			result, err = Unpad(decrypted, padLen)
+			assert.Nil(t, err)
+			assert.Equal(t, input, result)
+		}
+	}
+
+	var _, err = Unpad([]uint16{0, 1}, 3)
+	assert.NotNil(t, err)
+	_, err = Unpad([]uint16{0, 1}, -1)
+	assert.NotNil(t, err)
+	_, err = Unpad([]uint16{0, 1}, 2)
+	assert.NotNil(t, err)
+}
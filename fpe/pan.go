@@ -0,0 +1,82 @@
+package fpe
+
+import (
+	"fmt"
+)
+
+const (
+	// The PAN length must be in [13..19].
+	minPANLen = 13
+	maxPANLen = 19
+	// The length of the bank identification number (BIN), which is not encrypted.
+	panBINLen = 6
+)
+
+var decimalAlphabet = mustNewAlphabet("0123456789")
+
+// EncryptPAN encrypts the primary account number pan with FF1 and returns a token that is
+// also a valid PAN. The BIN (the first 6 digits) is kept unencrypted, the account number
+// (the digits between the BIN and the check digit) is encrypted, and the Luhn check digit
+// is recomputed on the result. The pan must be made of 13 to 19 digits and pass the Luhn
+// check, the key must be a valid AES key and the length of tweak must be in [0..maxTweakLenFF1].
+func EncryptPAN(key, tweak []byte, pan string) (string, error) {
+	return cryptPAN(key, tweak, pan, FF1Encrypt)
+}
+
+// DecryptPAN takes a token returned by EncryptPAN and returns the original primary account
+// number. The key and tweak must match the ones used to encrypt it.
+func DecryptPAN(key, tweak []byte, token string) (string, error) {
+	return cryptPAN(key, tweak, token, FF1Decrypt)
+}
+
+func cryptPAN(key, tweak []byte, pan string, crypt func(key, tweak []byte, radix uint32, input []uint16) ([]uint16, error)) (string, error) {
+	var digits, err = decimalAlphabet.ToNumerals(pan)
+	if err != nil {
+		return "", err
+	}
+	if len(digits) < minPANLen || len(digits) > maxPANLen {
+		return "", fmt.Errorf("fpe: PAN must be [%d..%d] digits", minPANLen, maxPANLen)
+	}
+	if !isLuhnValid(digits) {
+		return "", fmt.Errorf("fpe: PAN does not pass the Luhn check")
+	}
+
+	var l = len(digits)
+	var accountNumber []uint16
+	accountNumber, err = crypt(key, tweak, decimalAlphabet.Radix(), digits[panBINLen:l-1])
+	if err != nil {
+		return "", err
+	}
+
+	var out = make([]uint16, l)
+	copy(out, digits[:panBINLen])
+	copy(out[panBINLen:], accountNumber)
+	out[l-1] = getLuhnCheckDigit(out[:l-1])
+
+	return decimalAlphabet.ToString(out)
+}
+
+// getLuhnCheckDigit takes a string of decimal digits x. It returns the digit that must be
+// appended to x so that it passes the Luhn check.
+func getLuhnCheckDigit(x []uint16) uint16 {
+	var sum uint16
+	// The digits are doubled starting from the rightmost digit of x.
+	for i := len(x) - 1; i >= 0; i -= 2 {
+		var d = 2 * x[i]
+		if d > 9 {
+			d -= 9
+		}
+		sum += d
+		if i > 0 {
+			sum += x[i-1]
+		}
+	}
+	return (10 - sum%10) % 10
+}
+
+// isLuhnValid takes a string of decimal digits x. It returns true if x passes the Luhn check,
+// false otherwise.
+func isLuhnValid(x []uint16) bool {
+	var l = len(x)
+	return l > 0 && getLuhnCheckDigit(x[:l-1]) == x[l-1]
+}
@@ -0,0 +1,87 @@
+package fpe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestLuhn(t *testing.T) {
+	var valid = []string{"79927398713", "4111111111111111", "5555555555554444", "378282246310005", "6011111111111117"}
+	for _, s := range valid {
+		var digits, err = decimalAlphabet.ToNumerals(s)
+		assert.Nil(t, err)
+		assert.True(t, isLuhnValid(digits), s)
+	}
+
+	var invalid = []string{"79927398710", "4111111111111112", "5555555555554440"}
+	for _, s := range invalid {
+		var digits, err = decimalAlphabet.ToNumerals(s)
+		assert.Nil(t, err)
+		assert.False(t, isLuhnValid(digits), s)
+	}
+
+	assert.Equal(t, uint16(3), getLuhnCheckDigit([]uint16{7, 9, 9, 2, 7, 3, 9, 8, 7, 1}))
+}
+
+func TestEncryptDecryptPAN(t *testing.T) {
+	for l := minPANLen; l <= maxPANLen; l++ {
+		for i := 0; i < 100; i++ {
+			var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+			var pan = generateRandomPAN(l)
+
+			var token, err = EncryptPAN(key, tweak, pan)
+			assert.Nil(t, err)
+			assert.Equal(t, len(pan), len(token))
+			// The BIN is preserved and the token passes the Luhn check.
+			assert.Equal(t, pan[:panBINLen], token[:panBINLen])
+			var digits []uint16
+			digits, err = decimalAlphabet.ToNumerals(token)
+			assert.Nil(t, err)
+			assert.True(t, isLuhnValid(digits))
+
+			var decrypted string
+			decrypted, err = DecryptPAN(key, tweak, token)
+			assert.Nil(t, err)
+			assert.Equal(t, pan, decrypted)
+		}
+	}
+}
+
+func TestEncryptPANErrors(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+
+	var invalid = []string{
+		// Not digits
+		"4111 1111 1111 1111",
+		"411111111111111A",
+		// Invalid length
+		generateRandomPAN(minPANLen - 1),
+		generateRandomPAN(maxPANLen + 1),
+		// Invalid check digit
+		"4111111111111112",
+	}
+
+	for _, pan := range invalid {
+		var _, err = EncryptPAN(key, tweak, pan)
+		assert.NotNil(t, err, pan)
+		_, err = DecryptPAN(key, tweak, pan)
+		assert.NotNil(t, err, pan)
+	}
+
+	// Invalid key
+	var _, err = EncryptPAN(key[:10], tweak, "4111111111111111")
+	assert.NotNil(t, err)
+}
+
+// generateRandomPAN returns a random PAN of length l that passes the Luhn check.
+func generateRandomPAN(l int) string {
+	var digits = make([]uint16, l)
+	for i := 0; i < l-1; i++ {
+		digits[i] = uint16(rand.Intn(10))
+	}
+	digits[l-1] = getLuhnCheckDigit(digits[:l-1])
+
+	var pan, _ = decimalAlphabet.ToString(digits)
+	return pan
+}
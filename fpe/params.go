@@ -0,0 +1,146 @@
+package fpe
+
+import (
+	"fmt"
+)
+
+// The names of the parameters reported in ParamError.Field.
+const (
+	FieldKey       = "key"
+	FieldTweak     = "tweak"
+	FieldRadix     = "radix"
+	FieldInputLen  = "inputLen"
+	FieldInput     = "input"
+	FieldBlockSize = "blockSize"
+)
+
+// ParamError is returned when an encryption parameter does not satisfy a rule of the mode.
+// Field is the name of the offending parameter, one of the Field constants. For the
+// numerical parameters, Value is the offending value and [Min..Max] is the range it must be
+// in; for the key length, the range also contains 20 or 28, which are not AES key sizes.
+// For FieldInput, which reports numerals not in [0..radix[, Value is the first offending
+// numeral and [Min..Max] is [0..radix-1].
+type ParamError struct {
+	Field    string
+	Value    int64
+	Min, Max int64
+	Msg      string
+}
+
+func (e *ParamError) Error() string {
+	return "fpe: " + e.Msg
+}
+
+// ValidateFF1Params takes the length of the key and of the tweak in bytes, the radix and the
+// length of the input numeral string. It returns a *ParamError describing the first rule of
+// FF1 they violate, or nil if FF1 can encrypt such an input. The numerals themselves are not
+// checked, they must be in [0..radix[.
+func ValidateFF1Params(keyLen, tweakLen int, radix uint32, inputLen int) error {
+	if err := validateKeyLen(keyLen); err != nil {
+		return err
+	}
+	if err := validateFF1Tweak(tweakLen); err != nil {
+		return err
+	}
+	if err := validateFF1Radix(radix); err != nil {
+		return err
+	}
+	return validateFF1InputLen(radix, inputLen)
+}
+
+// ValidateFF3Params takes the length of the key and of the tweak in bytes, the radix and the
+// length of the input numeral string. It returns a *ParamError describing the first rule of
+// FF3 they violate, or nil if FF3 can encrypt such an input. The numerals themselves are not
+// checked, they must be in [0..radix[.
+func ValidateFF3Params(keyLen, tweakLen int, radix uint32, inputLen int) error {
+	if err := validateKeyLen(keyLen); err != nil {
+		return err
+	}
+	if err := validateFF3Tweak(tweakLen); err != nil {
+		return err
+	}
+	if err := validateFF3Radix(radix); err != nil {
+		return err
+	}
+	return validateFF3InputLen(radix, inputLen)
+}
+
+// validateKeyLen returns an error if keyLen is not an AES key size, i.e. 16, 24 or 32 bytes.
+func validateKeyLen(keyLen int) error {
+	switch keyLen {
+	case 16, 24, 32:
+		return nil
+	default:
+		return &ParamError{FieldKey, int64(keyLen), 16, 32, fmt.Sprintf("key must be 16, 24 or 32 bytes, got %d", keyLen)}
+	}
+}
+
+func validateFF1Tweak(tweakLen int) error {
+	if tweakLen < minTweakLenFF1 || tweakLen > maxTweakLenFF1 {
+		return &ParamError{FieldTweak, int64(tweakLen), minTweakLenFF1, maxTweakLenFF1, fmt.Sprintf("tweak must be [%d..%d] bytes", minTweakLenFF1, maxTweakLenFF1)}
+	}
+	return nil
+}
+
+func validateFF1Radix(radix uint32) error {
+	if radix < minRadixFF1 || radix > maxRadixFF1 {
+		return &ParamError{FieldRadix, int64(radix), minRadixFF1, maxRadixFF1, fmt.Sprintf("radix must be in [%d..%d]", minRadixFF1, maxRadixFF1)}
+	}
+	return nil
+}
+
+func validateFF1InputLen(radix uint32, n int) error {
+	if n < minInputLenFF1 || uint64(n) > maxInputLenFF1 {
+		return &ParamError{FieldInputLen, int64(n), minInputLenFF1, maxInputLenFF1, fmt.Sprintf("input length must be in [%d..%d]", minInputLenFF1, uint64(maxInputLenFF1))}
+	}
+	if !isDomainLargeEnough(radix, uint64(n), minDomainFF1) {
+		return newDomainError(radix, n, minDomainFF1, maxInputLenFF1)
+	}
+	return nil
+}
+
+func validateFF3Tweak(tweakLen int) error {
+	if tweakLen != tweakLenFF3 {
+		return &ParamError{FieldTweak, int64(tweakLen), tweakLenFF3, tweakLenFF3, fmt.Sprintf("tweak must be %d bytes", tweakLenFF3)}
+	}
+	return nil
+}
+
+func validateFF31Tweak(tweakLen int) error {
+	if tweakLen != tweakLenFF31 {
+		return &ParamError{FieldTweak, int64(tweakLen), tweakLenFF31, tweakLenFF31, fmt.Sprintf("tweak must be %d bytes", tweakLenFF31)}
+	}
+	return nil
+}
+
+func validateFF3Radix(radix uint32) error {
+	if radix < minRadixFF3 || radix > maxRadixFF3 {
+		return &ParamError{FieldRadix, int64(radix), minRadixFF3, maxRadixFF3, fmt.Sprintf("radix must be in [%d..%d]", minRadixFF3, maxRadixFF3)}
+	}
+	return nil
+}
+
+func validateFF3InputLen(radix uint32, n int) error {
+	if n < minInputLenFF3 || n > maxLength(radix) {
+		return &ParamError{FieldInputLen, int64(n), minInputLenFF3, int64(maxLength(radix)), fmt.Sprintf("input length must be in [%d..%d]", minInputLenFF3, maxLength(radix))}
+	}
+	if !isDomainLargeEnough(radix, uint64(n), minDomainFF3) {
+		return newDomainError(radix, n, minDomainFF3, int64(maxLength(radix)))
+	}
+	return nil
+}
+
+// newDomainError returns the error for an input length n such that radix^n < min. The
+// range of the error starts at the smallest length such that radix^len >= min.
+func newDomainError(radix uint32, n int, min, maxLen int64) *ParamError {
+	return &ParamError{FieldInputLen, int64(n), int64(minDomainLength(radix, min)), maxLen, fmt.Sprintf("radix^len < %d", min)}
+}
+
+// validateNumerals returns an error naming the first numeral of x which is not in [0..radix[.
+func validateNumerals(x []uint16, radix uint32) error {
+	var i = FirstInvalidNumeral(x, radix)
+	if i == -1 {
+		return nil
+	}
+	return &ParamError{FieldInput, int64(x[i]), 0, int64(radix) - 1, fmt.Sprintf("numeral %d (value %d) exceeds radix %d", i, x[i], radix)}
+}
@@ -0,0 +1,130 @@
+package fpe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateFF1Params(t *testing.T) {
+	var tests = []struct {
+		keyLen   int
+		tweakLen int
+		radix    uint32
+		inputLen int
+		param    string
+	}{
+		{16, 0, 10, 2, ""},
+		{24, maxTweakLenFF1, 2, 7, ""},
+		{32, 8, maxRadixFF1, 2, ""},
+		{20, 8, 10, 10, "key"},
+		{16, maxTweakLenFF1 + 1, 10, 10, "tweak"},
+		{16, 8, minRadixFF1 - 1, 10, "radix"},
+		{16, 8, maxRadixFF1 + 1, 10, "radix"},
+		{16, 8, maxRadixFF1, 1, "inputLen"},
+		{16, 8, 2, 6, "inputLen"},
+		// The first violated rule is returned.
+		{20, -1, 0, 0, "key"},
+		{16, -1, 0, 0, "tweak"},
+	}
+
+	for _, test := range tests {
+		var err = ValidateFF1Params(test.keyLen, test.tweakLen, test.radix, test.inputLen)
+		if test.param == "" {
+			assert.Nil(t, err)
+		} else {
+			var paramErr, ok = err.(*ParamError)
+			assert.True(t, ok)
+			if ok {
+				assert.Equal(t, test.param, paramErr.Field)
+			}
+		}
+	}
+}
+
+func TestValidateFF3Params(t *testing.T) {
+	var tests = []struct {
+		keyLen   int
+		tweakLen int
+		radix    uint32
+		inputLen int
+		param    string
+	}{
+		{16, 8, 10, 2, ""},
+		{24, 8, 2, 192, ""},
+		{32, 8, maxRadixFF3, 12, ""},
+		{20, 8, 10, 10, "key"},
+		{16, 7, 10, 10, "tweak"},
+		{16, 8, minRadixFF3 - 1, 10, "radix"},
+		{16, 8, maxRadixFF3 + 1, 10, "radix"},
+		{16, 8, 10, 57, "inputLen"},
+		{16, 8, maxRadixFF3, 13, "inputLen"},
+		{16, 8, 2, 6, "inputLen"},
+	}
+
+	for _, test := range tests {
+		var err = ValidateFF3Params(test.keyLen, test.tweakLen, test.radix, test.inputLen)
+		if test.param == "" {
+			assert.Nil(t, err)
+		} else {
+			var paramErr, ok = err.(*ParamError)
+			assert.True(t, ok)
+			if ok {
+				assert.Equal(t, test.param, paramErr.Field)
+			}
+		}
+	}
+}
+
+func TestParamErrorBounds(t *testing.T) {
+	var tests = []struct {
+		err      error
+		expected ParamError
+	}{
+		{ValidateFF1Params(20, 8, 10, 10), ParamError{Field: FieldKey, Value: 20, Min: 16, Max: 32}},
+		{ValidateFF1Params(16, maxTweakLenFF1+1, 10, 10), ParamError{Field: FieldTweak, Value: maxTweakLenFF1 + 1, Min: 0, Max: maxTweakLenFF1}},
+		{ValidateFF1Params(16, 8, 1, 10), ParamError{Field: FieldRadix, Value: 1, Min: 2, Max: maxRadixFF1}},
+		{ValidateFF1Params(16, 8, 10, 1), ParamError{Field: FieldInputLen, Value: 1, Min: 2, Max: maxInputLenFF1}},
+		// 2^7 is the smallest power of 2 >= 100.
+		{ValidateFF1Params(16, 8, 2, 6), ParamError{Field: FieldInputLen, Value: 6, Min: 7, Max: maxInputLenFF1}},
+		{ValidateFF3Params(16, 7, 10, 10), ParamError{Field: FieldTweak, Value: 7, Min: 8, Max: 8}},
+		{ValidateFF3Params(16, 8, 10, 57), ParamError{Field: FieldInputLen, Value: 57, Min: 2, Max: 56}},
+		{validateNumerals([]uint16{0, 1, 2, 3, 4, 5, 6, 42, 8}, 10), ParamError{Field: FieldInput, Value: 42, Min: 0, Max: 9}},
+	}
+
+	for _, test := range tests {
+		var paramErr, ok = test.err.(*ParamError)
+		assert.True(t, ok)
+		if ok {
+			assert.Equal(t, test.expected.Field, paramErr.Field)
+			assert.Equal(t, test.expected.Value, paramErr.Value)
+			assert.Equal(t, test.expected.Min, paramErr.Min)
+			assert.Equal(t, test.expected.Max, paramErr.Max)
+			assert.NotEmpty(t, paramErr.Error())
+		}
+	}
+}
+
+// The validation must agree with FF1Encrypt and FF3Encrypt.
+func TestValidateParamsAgreement(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, tweakLenFF3, 0)
+
+	for _, radix := range []uint32{2, 10, 26, maxRadixFF1} {
+		for l := 0; l < 200; l++ {
+			var input = make([]uint16, l)
+			var _, err = FF1Encrypt(key, tweak, radix, input)
+			assert.Equal(t, err, ValidateFF1Params(len(key), len(tweak), radix, l))
+			_, err = FF3Encrypt(key, tweak, radix, input)
+			assert.Equal(t, err, ValidateFF3Params(len(key), len(tweak), radix, l))
+		}
+	}
+}
+
+func TestInvalidNumeralMessage(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, blockSizeFF1)
+	var _, err = FF1Encrypt(key, tweak, 10, []uint16{0, 1, 2, 3, 4, 5, 6, 42, 8})
+	assert.NotNil(t, err)
+	assert.Equal(t, "fpe: numeral 7 (value 42) exceeds radix 10", err.Error())
+
+	err = validateNumerals([]uint16{0, 1, 2}, 10)
+	assert.Nil(t, err)
+}
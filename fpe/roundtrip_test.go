@@ -0,0 +1,81 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"flag"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// The round-trip test below uses a fixed seed by default, so that its configurations are the
+// same from a run to another. Run it with go test -run TestRoundTrip -args -roundtrip.seed=0
+// to draw a random seed, which is logged so that a failure can be reproduced.
+var roundTripSeed = flag.Int64("roundtrip.seed", 1, "seed of TestRoundTrip, 0 for a random seed")
+
+// The number of random configurations of each mode tested by TestRoundTrip.
+const roundTripConfigs = 200
+
+// For random valid configurations of FF1, FF3 and FF3-1, the decrypter must invert the
+// encrypter, and the encryption must change the inputs whose domain is large enough for a
+// fixed point to be unlikely.
+func TestRoundTrip(t *testing.T) {
+	var seed = *roundTripSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	t.Logf("seed %d", seed)
+	var rng = rand.New(rand.NewSource(seed))
+
+	var modes = []struct {
+		name     string
+		tweakLen func() int
+		minLen   func(radix uint32) int
+		maxLen   func(radix uint32) int
+		new      func(key, tweak []byte, radix uint32) (cipher.BlockMode, cipher.BlockMode, error)
+	}{
+		{"FF1", func() int { return rng.Intn(64) }, MinInputLength, func(radix uint32) int { return MinInputLength(radix) + 100 }, newFF1BlockModes},
+		{"FF3", func() int { return tweakLenFF3 }, MinInputLength, maxLength, newFF3BlockModes},
+		{"FF3-1", func() int { return tweakLenFF31 }, func(radix uint32) int { return minDomainLength(radix, minDomainFF31) }, maxLength, newFF31BlockModes},
+	}
+
+	for _, mode := range modes {
+		for i := 0; i < roundTripConfigs; i++ {
+			// Half of the radices are small, as most alphabets are.
+			var radix = uint32(2 + rng.Intn(maxRadixFF1-1))
+			if i%2 == 0 {
+				radix = uint32(2 + rng.Intn(63))
+			}
+			var minLen, maxLen = mode.minLen(radix), mode.maxLen(radix)
+			var n = minLen + rng.Intn(maxLen-minLen+1)
+
+			var key = make([]byte, 16+8*rng.Intn(3))
+			var tweak = make([]byte, mode.tweakLen())
+			rng.Read(key)
+			rng.Read(tweak)
+			var plaintext = make([]uint16, n)
+			for j := range plaintext {
+				plaintext[j] = uint16(rng.Intn(int(radix)))
+			}
+
+			var msg = fmt.Sprintf("%s, seed %d, key %x, tweak %x, radix %d, n %d", mode.name, seed, key, tweak, radix, n)
+			var encrypter, decrypter, err = mode.new(key, tweak, radix)
+			if !assert.Nil(t, err, msg) {
+				continue
+			}
+
+			var ciphertext, decrypted []uint16
+			ciphertext, err = cryptModeNumerals(encrypter, plaintext)
+			assert.Nil(t, err, msg)
+			decrypted, err = cryptModeNumerals(decrypter, ciphertext)
+			assert.Nil(t, err, msg)
+			assert.Equal(t, plaintext, decrypted, msg)
+
+			if isDomainLargeEnough(radix, uint64(n), 1<<40) {
+				assert.NotEqual(t, plaintext, ciphertext, msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"fmt"
+)
+
+// Scratch holds the buffers of the FF1 rounds, so that FF1Cipher.EncryptInto and DecryptInto
+// can reuse them from a call to another. The zero value is ready to use: the first call sizes
+// the buffers, and they are only resized when the length of the input, the radix or the tweak
+// length change. The encryptions of inputs of the same length then allocate nothing, as long
+// as radix^ceil(n/2) fits in a uint64, e.g. up to 38 decimal numerals. The longer inputs use
+// the big.Int values of a pool, and still allocate. A Scratch is not safe for concurrent use,
+// each goroutine needs its own.
+type Scratch struct {
+	n, radix uint32
+	tweakLen int
+	rf       *ff1RoundFunction
+	f        feistel
+}
+
+// prepare takes the AES block, the tweak and the radix of a FF1 block mode, the number of
+// rounds and the length n of the input. It returns the Feistel structure for the input,
+// whose round function uses the buffers of s.
+func (s *Scratch) prepare(aesBlock cipher.Block, tweak []byte, radix uint32, rounds int, n uint32) *feistel {
+	if s.rf == nil || s.n != n || s.radix != radix || s.tweakLen != len(tweak) {
+		s.n, s.radix, s.tweakLen = n, radix, len(tweak)
+		s.rf = newFF1RoundFunction(tweak, radix, n/2, n)
+		s.f = feistel{radix: radix, roundFunction: s.rf.round}
+	}
+	// The key and the tweak may have changed since the last call, so the fixed part of
+	// the PRF is always recomputed.
+	s.rf.setKey(aesBlock, tweak)
+	s.f.rounds = rounds
+	return &s.f
+}
+
+// scratchCrypter is implemented by the FF1 BlockModes. cryptNumeralsWithScratch is
+// cryptNumerals, using the buffers of the given Scratch.
+type scratchCrypter interface {
+	cryptNumeralsWithScratch(x []uint16, s *Scratch)
+}
+
+func (x *ff1Encrypter) cryptNumeralsWithScratch(numeralString []uint16, s *Scratch) {
+	var n = uint32(len(numeralString))
+	var f = s.prepare(x.aesBlock, x.getTweakAtomic(), x.radix, getFF1Rounds(x.rounds, x.roundSchedule, int(n)), n)
+	f.constantTime = x.constantTime
+	f.encrypt(numeralString, n/2)
+}
+
+func (x *ff1Decrypter) cryptNumeralsWithScratch(numeralString []uint16, s *Scratch) {
+	var n = uint32(len(numeralString))
+	var f = s.prepare(x.aesBlock, x.getTweakAtomic(), x.radix, getFF1Rounds(x.rounds, x.roundSchedule, int(n)), n)
+	f.constantTime = x.constantTime
+	f.decrypt(numeralString, n/2)
+}
+
+// cryptModeNumeralsInto takes a FF1 BlockMode, the numeral strings dst and src, and a Scratch,
+// which may be nil. It writes the encryption or decryption of src to dst, or returns an error
+// if src is not a valid input or if dst does not have its length, leaving dst unchanged.
+func cryptModeNumeralsInto(mode cipher.BlockMode, dst, src []uint16, s *Scratch) error {
+	if len(dst) != len(src) {
+		return fmt.Errorf("fpe: dst length %d differs from src length %d", len(dst), len(src))
+	}
+	if err := checkModeInput(mode, src); err != nil {
+		return err
+	}
+	if s == nil {
+		s = new(Scratch)
+	}
+
+	copy(dst, src)
+	mode.(scratchCrypter).cryptNumeralsWithScratch(dst, s)
+	return nil
+}
@@ -0,0 +1,174 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// FF1Stream is an io.WriteCloser which enciphers or deciphers fixed-width records with a FF1
+// BlockMode and writes them to an underlying writer. A record is a numeral string of width
+// numerals, represented as a byte string as in NumeralStringToBytes. The partial records
+// are buffered until they are complete. Write and Close are safe for concurrent use, the
+// records are processed one at a time.
+type FF1Stream struct {
+	mu     sync.Mutex
+	w      io.Writer
+	mode   cipher.BlockMode
+	record []byte
+	l      int
+}
+
+// NewFF1Stream returns a FF1Stream which writes to w the records processed by mode. With a
+// FF1 encrypter, the stream enciphers the records, with a FF1 decrypter, it deciphers them:
+// the FF1 decrypter with the key, tweak and radix of the encrypter turns the output of an
+// enciphering stream back into the plaintext records. The width is the number of numerals
+// in a record, it must be at least 2, and radix^width must be at least the minimum domain of
+// the mode. It panics if mode is not a FF1 encrypter or decrypter.
+func NewFF1Stream(w io.Writer, mode cipher.BlockMode, width int) *FF1Stream {
+	checkFF1StreamMode("NewFF1Stream", mode, width)
+	return &FF1Stream{
+		w:      w,
+		mode:   mode,
+		record: make([]byte, EncodedByteLen(width)),
+	}
+}
+
+// checkFF1StreamMode panics, with the name of the calling constructor, if mode is not a FF1
+// encrypter or decrypter, or if it cannot process records of width numerals.
+func checkFF1StreamMode(name string, mode cipher.BlockMode, width int) {
+	var x *ff1
+	switch m := mode.(type) {
+	case *ff1Encrypter:
+		x = (*ff1)(m)
+	case *ff1Decrypter:
+		x = (*ff1)(m)
+	default:
+		panic(name + ": mode must be a FF1 encrypter or decrypter.")
+	}
+	if width < minInputLenFF1 || uint64(width) > maxInputLenFF1 {
+		panic(fmt.Sprintf("%s: width must be in [%d..%d].", name, minInputLenFF1, uint64(maxInputLenFF1)))
+	}
+	if !x.checkDomain(uint64(width)) {
+		panic(fmt.Sprintf("%s: radix^width < %v.", name, x.getMinDomain()))
+	}
+}
+
+// Write buffers p, and processes and writes each complete record to the underlying writer.
+// It returns the number of bytes of p that were consumed, and the first error returned by
+// the underlying writer. If a record is not a valid input of the BlockMode, e.g. if it holds
+// a numeral not smaller than the radix, Write returns an error instead: the record is
+// discarded and not written, and the bytes of p after it are not consumed.
+func (s *FF1Stream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for len(p) > 0 {
+		var k = copy(s.record[s.l:], p)
+		s.l += k
+		n += k
+		p = p[k:]
+
+		if s.l == len(s.record) {
+			s.l = 0
+			if err := checkModeInput(s.mode, BytesToNumeralString(s.record)); err != nil {
+				return n, err
+			}
+			s.mode.CryptBlocks(s.record, s.record)
+			if _, err := s.w.Write(s.record); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close returns an error if a partial record is buffered, i.e. if the number of bytes
+// written is not a multiple of the record size. It does not close the underlying writer.
+func (s *FF1Stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.l != 0 {
+		return fmt.Errorf("fpe: partial trailing record of %d bytes, records are %d bytes", s.l, len(s.record))
+	}
+	return nil
+}
+
+// FF1StreamReader is an io.Reader which reads fixed-width records from an underlying reader,
+// and returns them enciphered or deciphered with a FF1 BlockMode. The records are represented
+// as for FF1Stream. Read is safe for concurrent use, the records are processed one at a time.
+type FF1StreamReader struct {
+	mu     sync.Mutex
+	r      io.Reader
+	mode   cipher.BlockMode
+	record []byte
+	// off is the offset of the first byte of the processed record not yet returned.
+	off int
+	err error
+}
+
+// NewFF1StreamReader returns a FF1StreamReader which reads from r the records to process with
+// mode. With a FF1 encrypter, the reader enciphers the records, with a FF1 decrypter, it
+// deciphers them, e.g. the output of a FF1Stream built with the encrypter of the same key,
+// tweak and radix. The width and the mode must be valid as for NewFF1Stream, it panics
+// otherwise.
+func NewFF1StreamReader(r io.Reader, mode cipher.BlockMode, width int) *FF1StreamReader {
+	checkFF1StreamMode("NewFF1StreamReader", mode, width)
+	var record = make([]byte, EncodedByteLen(width))
+	return &FF1StreamReader{
+		r:      r,
+		mode:   mode,
+		record: record,
+		off:    len(record),
+	}
+}
+
+// Read reads the next records from the underlying reader, and copies the processed bytes to
+// p. It only reads from the underlying reader when no processed byte is left. It returns
+// io.EOF once the underlying reader is exhausted on a record boundary. If it ends in the
+// middle of a record, if a record is not a valid input of the BlockMode, or if the underlying
+// reader fails, an error is returned once the bytes processed before it were read, and the
+// following calls return it too.
+func (s *FF1StreamReader) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for n < len(p) {
+		if s.off == len(s.record) {
+			if n > 0 || s.err != nil {
+				break
+			}
+			if s.err = s.readRecord(); s.err != nil {
+				break
+			}
+			s.off = 0
+		}
+		var k = copy(p[n:], s.record[s.off:])
+		s.off += k
+		n += k
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, s.err
+}
+
+// readRecord reads the next record from the underlying reader and processes it in place.
+func (s *FF1StreamReader) readRecord() error {
+	var k, err = io.ReadFull(s.r, s.record)
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		return fmt.Errorf("fpe: partial trailing record of %d bytes, records are %d bytes", k, len(s.record))
+	case err != nil:
+		return err
+	}
+	if err = checkModeInput(s.mode, BytesToNumeralString(s.record)); err != nil {
+		return err
+	}
+	s.mode.CryptBlocks(s.record, s.record)
+	return nil
+}
@@ -0,0 +1,206 @@
+package fpe
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"testing"
+)
+
+func TestFF1Stream(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var radix uint32 = 10
+	var width = 12
+	var encrypter, decrypter, err = newFF1BlockModes(key, tweak, radix)
+	assert.Nil(t, err)
+
+	// Expected ciphertext, each record is enciphered separately.
+	var plaintext, expected []byte
+	for i := 0; i < 20; i++ {
+		var record = NumeralStringToBytes(generateRandomNumeralString(radix, width))
+		plaintext = append(plaintext, record...)
+		var ciphertext = make([]byte, len(record))
+		encrypter.CryptBlocks(ciphertext, record)
+		expected = append(expected, ciphertext...)
+	}
+
+	// The plaintext is written in chunks that do not match the records.
+	var out bytes.Buffer
+	var stream = NewFF1Stream(&out, encrypter, width)
+	for _, chunkSize := range []int{1, 7, 24, 25, 100} {
+		out.Reset()
+		for i := 0; i < len(plaintext); i += chunkSize {
+			var end = i + chunkSize
+			if end > len(plaintext) {
+				end = len(plaintext)
+			}
+			var n, err = stream.Write(plaintext[i:end])
+			assert.Nil(t, err)
+			assert.Equal(t, end-i, n)
+		}
+		assert.Nil(t, stream.Close())
+		assert.Equal(t, expected, out.Bytes())
+	}
+
+	// The decrypt stream returns the plaintext.
+	out.Reset()
+	stream = NewFF1Stream(&out, decrypter, width)
+	var n int
+	n, err = stream.Write(expected)
+	assert.Nil(t, err)
+	assert.Equal(t, len(expected), n)
+	assert.Nil(t, stream.Close())
+	assert.Equal(t, plaintext, out.Bytes())
+}
+
+func TestFF1StreamErrors(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var encrypter, _, err = newFF1BlockModes(key, tweak, 10)
+	assert.Nil(t, err)
+
+	// Invalid width
+	assert.Panics(t, func() { NewFF1Stream(&bytes.Buffer{}, encrypter, 1) })
+
+	// Partial trailing record
+	var stream = NewFF1Stream(&bytes.Buffer{}, encrypter, 4)
+	_, err = stream.Write(make([]byte, 10))
+	assert.Nil(t, err)
+	assert.NotNil(t, stream.Close())
+
+	// The errors of the underlying writer are returned.
+	stream = NewFF1Stream(&failingWriter{}, encrypter, 4)
+	var n int
+	n, err = stream.Write(make([]byte, 10))
+	assert.NotNil(t, err)
+	assert.Equal(t, 8, n)
+
+	// Invalid numeral string: the record is discarded with an error, the valid records
+	// before it are written, and the stream can still be used.
+	var out bytes.Buffer
+	stream = NewFF1Stream(&out, encrypter, 2)
+	var valid = NumeralStringToBytes([]uint16{1, 2})
+	var expected = make([]byte, len(valid))
+	encrypter.CryptBlocks(expected, valid)
+	var p = append(append(append([]byte(nil), valid...), NumeralStringToBytes([]uint16{10, 10})...), valid...)
+	assert.NotPanics(t, func() { n, err = stream.Write(p) })
+	assert.NotNil(t, err)
+	assert.Equal(t, 8, n)
+	assert.Equal(t, expected, out.Bytes())
+	n, err = stream.Write(valid)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	assert.Nil(t, stream.Close())
+	assert.Equal(t, append(expected, expected...), out.Bytes())
+
+	// radix^width below the minimum domain of the mode.
+	var binary, _, _ = newFF1BlockModes(key, tweak, 2)
+	assert.Panics(t, func() { NewFF1Stream(&bytes.Buffer{}, binary, 6) })
+	assert.NotPanics(t, func() { NewFF1Stream(&bytes.Buffer{}, binary, 7) })
+	var strict, _, _ = NewFF1(key, WithMinDomain(big.NewInt(1000)))
+	assert.Panics(t, func() { NewFF1Stream(&bytes.Buffer{}, strict, 2) })
+	assert.NotPanics(t, func() { NewFF1Stream(&bytes.Buffer{}, strict, 3) })
+
+	// The mode must be FF1.
+	var ff3Encrypter, _, _ = newFF3BlockModes(key, make([]byte, tweakLenFF3), 10)
+	assert.Panics(t, func() { NewFF1Stream(&bytes.Buffer{}, ff3Encrypter, 4) })
+	assert.Panics(t, func() { NewFF1Stream(&bytes.Buffer{}, &mockBlockMode{}, 4) })
+}
+
+func TestFF1StreamReader(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var radix uint32 = 36
+	var width = 9
+	var encrypter, decrypter, err = newFF1BlockModes(key, tweak, radix)
+	assert.Nil(t, err)
+
+	var plaintext []byte
+	for i := 0; i < 25; i++ {
+		plaintext = append(plaintext, NumeralStringToBytes(generateRandomNumeralString(radix, width))...)
+	}
+
+	// A multi-record stream enciphered by FF1Stream is deciphered by FF1StreamReader, read in
+	// chunks that do not match the records.
+	var ciphertext bytes.Buffer
+	var stream = NewFF1Stream(&ciphertext, encrypter, width)
+	var n int
+	n, err = stream.Write(plaintext)
+	assert.Nil(t, err)
+	assert.Equal(t, len(plaintext), n)
+	assert.Nil(t, stream.Close())
+	assert.NotEqual(t, plaintext, ciphertext.Bytes())
+
+	for _, chunkSize := range []int{1, 5, 18, 19, 1000} {
+		var reader = NewFF1StreamReader(bytes.NewReader(ciphertext.Bytes()), decrypter, width)
+		var decrypted []byte
+		var chunk = make([]byte, chunkSize)
+		for {
+			n, err = reader.Read(chunk)
+			decrypted = append(decrypted, chunk[:n]...)
+			if err != nil {
+				break
+			}
+		}
+		assert.Equal(t, io.EOF, err)
+		assert.Equal(t, plaintext, decrypted)
+	}
+
+	// The reader enciphers with a FF1 encrypter.
+	var enciphered, _ = ioutil.ReadAll(NewFF1StreamReader(bytes.NewReader(plaintext), encrypter, width))
+	assert.Equal(t, ciphertext.Bytes(), enciphered)
+}
+
+func TestFF1StreamReaderErrors(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var encrypter, _, err = newFF1BlockModes(key, tweak, 10)
+	assert.Nil(t, err)
+
+	// Partial trailing record: the complete records are returned before the error.
+	var valid = NumeralStringToBytes([]uint16{1, 2})
+	var expected = make([]byte, len(valid))
+	encrypter.CryptBlocks(expected, valid)
+	var reader = NewFF1StreamReader(bytes.NewReader(append(append([]byte(nil), valid...), 0, 1)), encrypter, 2)
+	var out []byte
+	out, err = ioutil.ReadAll(reader)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, expected, out)
+	var n int
+	n, err = reader.Read(make([]byte, 4))
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, n)
+
+	// Invalid numeral string
+	reader = NewFF1StreamReader(bytes.NewReader(append(append([]byte(nil), valid...), NumeralStringToBytes([]uint16{10, 10})...)), encrypter, 2)
+	assert.NotPanics(t, func() { out, err = ioutil.ReadAll(reader) })
+	assert.NotNil(t, err)
+	assert.Equal(t, expected, out)
+
+	// The errors of the underlying reader are returned.
+	reader = NewFF1StreamReader(&failingReader{}, encrypter, 2)
+	n, err = reader.Read(make([]byte, 4))
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, n)
+
+	// Invalid width, and modes which are not FF1.
+	assert.Panics(t, func() { NewFF1StreamReader(&bytes.Buffer{}, encrypter, 1) })
+	var binary, _, _ = newFF1BlockModes(key, tweak, 2)
+	assert.Panics(t, func() { NewFF1StreamReader(&bytes.Buffer{}, binary, 6) })
+	var ff3Encrypter, _, _ = newFF3BlockModes(key, make([]byte, tweakLenFF3), 10)
+	assert.Panics(t, func() { NewFF1StreamReader(&bytes.Buffer{}, ff3Encrypter, 4) })
+	assert.Panics(t, func() { NewFF1StreamReader(&bytes.Buffer{}, &mockBlockMode{}, 4) })
+}
+
+type failingWriter struct{}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+type failingReader struct{}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
@@ -0,0 +1,162 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"fmt"
+)
+
+// EncryptSubstring encrypts the numerals input[start:start+length] with the given mode, and
+// returns a copy of input where they are replaced by the ciphertext. The numerals before
+// and after the region are left in the clear. The mode must be a FF1, FF3 or FF3-1
+// encrypter, and the region must be long enough for the mode, e.g. radix^length >= 100 for
+// FF1. The input is not modified.
+func EncryptSubstring(mode cipher.BlockMode, input []uint16, start, length int) ([]uint16, error) {
+	return cryptSubstring(mode, input, start, length)
+}
+
+// DecryptSubstring takes a numeral string returned by EncryptSubstring and returns the
+// original numeral string. The mode must be the decrypter matching the encrypter, and start
+// and length must be the ones used to encrypt the data.
+func DecryptSubstring(mode cipher.BlockMode, input []uint16, start, length int) ([]uint16, error) {
+	return cryptSubstring(mode, input, start, length)
+}
+
+func cryptSubstring(mode cipher.BlockMode, input []uint16, start, length int) ([]uint16, error) {
+	if start < 0 || length < 0 || start > len(input)-length {
+		return nil, fmt.Errorf("fpe: region [%d:%d+%d] out of range of input of length %d", start, start, length, len(input))
+	}
+
+	var region = input[start : start+length]
+	if err := checkModeInput(mode, region); err != nil {
+		return nil, err
+	}
+
+	var out = make([]uint16, len(input))
+	copy(out, input)
+
+	var buf = NumeralStringToBytes(region)
+	mode.CryptBlocks(buf, buf)
+	copy(out[start:], BytesToNumeralString(buf))
+
+	return out, nil
+}
+
+// EncryptWithMask encrypts the numerals of input whose position is not marked in skip with
+// the given mode, and returns a copy of input where they are replaced by the ciphertext. The
+// numerals marked in skip, e.g. the separators of a formatted value, are left unchanged, and
+// the other ones are encrypted together as one numeral string, which must be long enough for
+// the mode. The length of skip must be the length of input. The input is not modified.
+func EncryptWithMask(mode cipher.BlockMode, input []uint16, skip []bool) ([]uint16, error) {
+	return cryptWithMask(mode, input, skip)
+}
+
+// DecryptWithMask takes a numeral string returned by EncryptWithMask and returns the
+// original numeral string. The mode must be the decrypter matching the encrypter, and skip
+// must be the mask used to encrypt the data.
+func DecryptWithMask(mode cipher.BlockMode, input []uint16, skip []bool) ([]uint16, error) {
+	return cryptWithMask(mode, input, skip)
+}
+
+func cryptWithMask(mode cipher.BlockMode, input []uint16, skip []bool) ([]uint16, error) {
+	if len(skip) != len(input) {
+		return nil, fmt.Errorf("fpe: mask length %d differs from input length %d", len(skip), len(input))
+	}
+
+	var gathered = make([]uint16, 0, len(input))
+	for i, numeral := range input {
+		if !skip[i] {
+			gathered = append(gathered, numeral)
+		}
+	}
+	if err := checkModeInput(mode, gathered); err != nil {
+		return nil, err
+	}
+
+	var buf = NumeralStringToBytes(gathered)
+	mode.CryptBlocks(buf, buf)
+	gathered = BytesToNumeralString(buf)
+
+	var out = make([]uint16, len(input))
+	var j int
+	for i, numeral := range input {
+		if skip[i] {
+			out[i] = numeral
+		} else {
+			out[i] = gathered[j]
+			j++
+		}
+	}
+	return out, nil
+}
+
+// numeralCrypter is implemented by the FF1, FF3 and FF3-1 BlockModes. cryptNumerals encrypts
+// or decrypts a valid numeral string in place, without converting it to bytes.
+type numeralCrypter interface {
+	cryptNumerals(x []uint16)
+}
+
+// keySetter is implemented by the FF1, FF3 and FF3-1 BlockModes.
+type keySetter interface {
+	SetKey(key []byte) error
+}
+
+// radixGetter is implemented by the FF1, FF3 and FF3-1 BlockModes.
+type radixGetter interface {
+	GetRadix() uint32
+}
+
+// cryptModeNumerals takes a FF1, FF3 or FF3-1 BlockMode and a numeral string x. It returns
+// the encryption or decryption of x, or an error if x is not a valid input. x is not modified.
+func cryptModeNumerals(mode cipher.BlockMode, x []uint16) ([]uint16, error) {
+	if err := checkModeInput(mode, x); err != nil {
+		return nil, err
+	}
+
+	var out = append([]uint16(nil), x...)
+	mode.(numeralCrypter).cryptNumerals(out)
+	return out, nil
+}
+
+// cryptModeNumeralsInPlace is cryptModeNumerals, but it overwrites x with the result. x is
+// checked first, so it is left unchanged if an error is returned.
+func cryptModeNumeralsInPlace(mode cipher.BlockMode, x []uint16) error {
+	if err := checkModeInput(mode, x); err != nil {
+		return err
+	}
+
+	mode.(numeralCrypter).cryptNumerals(x)
+	return nil
+}
+
+// checkModeInput takes a FF1, FF3 or FF3-1 BlockMode and a numeral string x. It returns an
+// error if x cannot be processed by the mode, i.e. in the cases where CryptBlocks would panic.
+func checkModeInput(mode cipher.BlockMode, x []uint16) error {
+	switch m := mode.(type) {
+	case *ff1Encrypter:
+		return checkFF1ModeInput(x, (*ff1)(m))
+	case *ff1Decrypter:
+		return checkFF1ModeInput(x, (*ff1)(m))
+	case *ff3Encrypter:
+		return checkFF3Input(x, m.radix)
+	case *ff3Decrypter:
+		return checkFF3Input(x, m.radix)
+	case *ff31Encrypter:
+		return checkFF31Input(x, m.radix)
+	case *ff31Decrypter:
+		return checkFF31Input(x, m.radix)
+	default:
+		return fmt.Errorf("fpe: mode must be a FF1, FF3 or FF3-1 BlockMode")
+	}
+}
+
+// checkFF31Input takes a numeral string x and an integer radix. It returns an error if x
+// cannot be processed by FF3-1, i.e. in the cases where CryptBlocks would panic.
+func checkFF31Input(x []uint16, radix uint32) error {
+	if err := checkFF3Input(x, radix); err != nil {
+		return err
+	}
+	if !isDomainLargeEnough(radix, uint64(len(x)), minDomainFF31) {
+		return newDomainError(radix, len(x), minDomainFF31, int64(maxLength(radix)))
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package fpe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEncryptDecryptSubstring(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var ff3Key, ff3Tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF3, 0)
+	var _, ff31Tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF31, 0)
+	var radix uint32 = 10
+
+	var modes [][2]cipher.BlockMode
+	for _, newModes := range []func() (cipher.BlockMode, cipher.BlockMode, error){
+		func() (cipher.BlockMode, cipher.BlockMode, error) { return newFF1BlockModes(key, tweak, radix) },
+		func() (cipher.BlockMode, cipher.BlockMode, error) { return newFF3BlockModes(ff3Key, ff3Tweak, radix) },
+		func() (cipher.BlockMode, cipher.BlockMode, error) { return newFF31BlockModes(ff3Key, ff31Tweak, radix) },
+	} {
+		var encrypter, decrypter, err = newModes()
+		assert.Nil(t, err)
+		modes = append(modes, [2]cipher.BlockMode{encrypter, decrypter})
+	}
+
+	var input = generateRandomNumeralString(radix, 16)
+	var start, length = 4, 8
+	for _, m := range modes {
+		var encrypted, err = EncryptSubstring(m[0], input, start, length)
+		assert.Nil(t, err)
+		assert.Equal(t, len(input), len(encrypted))
+		// The prefix and suffix are kept, the region is encrypted as a whole.
+		assert.Equal(t, input[:start], encrypted[:start])
+		assert.Equal(t, input[start+length:], encrypted[start+length:])
+		var expected = make([]byte, 2*length)
+		m[0].CryptBlocks(expected, NumeralStringToBytes(input[start:start+length]))
+		assert.Equal(t, BytesToNumeralString(expected), encrypted[start:start+length])
+
+		var decrypted []uint16
+		decrypted, err = DecryptSubstring(m[1], encrypted, start, length)
+		assert.Nil(t, err)
+		assert.Equal(t, input, decrypted)
+	}
+}
+
+func TestEncryptSubstringErrors(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var ff3Key, ff31Tweak, _ []byte = getRandomParameters(ff3DefaultKeySize, tweakLenFF31, 0)
+	var encrypter, _, _ = newFF1BlockModes(key, tweak, 10)
+	var ff31Encrypter, _, _ = newFF31BlockModes(ff3Key, ff31Tweak, 10)
+	var input = generateRandomNumeralString(10, 10)
+	var aesBlock, _ = aes.NewCipher(key)
+
+	var invalid = []struct {
+		mode          cipher.BlockMode
+		start, length int
+	}{
+		// Region out of range
+		{encrypter, -1, 4},
+		{encrypter, 2, -1},
+		{encrypter, 8, 4},
+		// Region too short: 10^1 < 100 for FF1 and 10^5 < 10^6 for FF3-1
+		{encrypter, 2, 1},
+		{ff31Encrypter, 2, 5},
+		// Not a FF1, FF3 or FF3-1 mode
+		{NewCBCWithSetIV(aesBlock, make([]byte, aes.BlockSize)), 2, 4},
+	}
+
+	for _, test := range invalid {
+		var _, err = EncryptSubstring(test.mode, input, test.start, test.length)
+		assert.NotNil(t, err)
+	}
+
+	// Invalid numerals in the region
+	var _, err = EncryptSubstring(encrypter, []uint16{1, 2, 10, 4}, 0, 4)
+	assert.NotNil(t, err)
+}
+
+func TestEncryptDecryptWithMask(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var alphabet = mustNewAlphabet("0123456789-")
+	var encrypter, decrypter, err = newFF1BlockModes(key, tweak, 10)
+	assert.Nil(t, err)
+
+	// The separators of a SSN are numeral 10, out of the radix of the mode.
+	var ssn, _ = alphabet.ToNumerals("123-45-6789")
+	var skip = make([]bool, len(ssn))
+	for i, numeral := range ssn {
+		skip[i] = numeral == 10
+	}
+
+	var encrypted []uint16
+	encrypted, err = EncryptWithMask(encrypter, ssn, skip)
+	assert.Nil(t, err)
+	var s, _ = alphabet.ToString(encrypted)
+	assert.Equal(t, "-", s[3:4])
+	assert.Equal(t, "-", s[6:7])
+
+	// The digits are encrypted together.
+	var digits, _ = decimalAlphabet.ToNumerals("123456789")
+	var expected = make([]byte, 2*len(digits))
+	encrypter.CryptBlocks(expected, NumeralStringToBytes(digits))
+	var encryptedDigits, _ = decimalAlphabet.ToNumerals(s[:3] + s[4:6] + s[7:])
+	assert.Equal(t, BytesToNumeralString(expected), encryptedDigits)
+
+	var decrypted []uint16
+	decrypted, err = DecryptWithMask(decrypter, encrypted, skip)
+	assert.Nil(t, err)
+	assert.Equal(t, ssn, decrypted)
+}
+
+func TestEncryptWithMaskErrors(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var encrypter, _, _ = newFF1BlockModes(key, tweak, 10)
+	var input = []uint16{1, 2, 3, 4}
+
+	// Mask length
+	var _, err = EncryptWithMask(encrypter, input, []bool{false, false, false})
+	assert.NotNil(t, err)
+
+	// Only one numeral left: 10^1 < 100
+	_, err = EncryptWithMask(encrypter, input, []bool{true, false, true, true})
+	assert.NotNil(t, err)
+
+	// A skipped numeral may be out of the radix, but not the other ones.
+	_, err = EncryptWithMask(encrypter, []uint16{1, 2, 10, 4}, []bool{false, false, true, false})
+	assert.Nil(t, err)
+	_, err = EncryptWithMask(encrypter, []uint16{1, 2, 10, 4}, []bool{false, false, false, false})
+	assert.NotNil(t, err)
+}
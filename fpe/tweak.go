@@ -0,0 +1,166 @@
+package fpe
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// HKDF can expand its input to at most 255 hashes.
+	maxHKDFLen = 255 * sha256.Size
+	// The length of the tweak fingerprints in bytes.
+	tweakFingerprintLen = 4
+)
+
+// DeriveTweak takes a base tweak and context strings (e.g. a table name, a column name, a
+// record id). It returns a 32-byte FF1 tweak that deterministically combines them, so that
+// the same plaintext is enciphered differently in each context. The base tweak and each
+// context string are prefixed by their length and hashed with SHA-256, hence ("ab", "c")
+// and ("a", "bc") yield different tweaks. The same base tweak and context strings, in the
+// same order, must be given to decrypt the data. The tweak is for FF1 only, whose SetTweak
+// accepts 32 bytes: a prefix of it may be used for a shorter FF1 tweak, but the SetTweak of
+// FF3 and FF3-1 panic on it. For FF3 and FF3-1, derive the tweak with DeriveTweakHKDF and
+// ModeFF3 or ModeFF31, e.g. with the length-prefixed context strings as info.
+func DeriveTweak(base []byte, context ...[]byte) []byte {
+	var h = sha256.New()
+	var l = make([]byte, 8)
+
+	for _, b := range append([][]byte{base}, context...) {
+		binary.BigEndian.PutUint64(l, uint64(len(b)))
+		h.Write(l)
+		h.Write(b)
+	}
+
+	return h.Sum(nil)
+}
+
+// DeriveTweakHKDF takes a mode, a master tweak, a salt, an info string (e.g. a record
+// identifier) and a length. It returns a tweak of length bytes for the mode, derived with
+// HKDF-SHA256 (RFC 5869), with the master tweak as input keying material, so that each record
+// gets its own tweak. The length must be a valid tweak length of the mode: 8 bytes for FF3,
+// 7 bytes for FF3-1, and for FF1 a length in [0..maxTweakLenFF1] which is at most 255 * 32
+// bytes for HKDF. The same inputs always yield the same tweak.
+func DeriveTweakHKDF(mode Mode, masterTweak, salt, info []byte, length int) ([]byte, error) {
+	var err error
+	switch mode {
+	case ModeFF1:
+		err = validateFF1Tweak(length)
+	case ModeFF3:
+		err = validateFF3Tweak(length)
+	case ModeFF31:
+		err = validateFF31Tweak(length)
+	default:
+		err = fmt.Errorf("fpe: unknown mode %d", mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if length > maxHKDFLen {
+		return nil, &ParamError{FieldTweak, int64(length), minTweakLenFF1, maxHKDFLen, fmt.Sprintf("tweak derived with HKDF must be at most %d bytes", maxHKDFLen)}
+	}
+
+	// Extract: PRK = HMAC(salt, IKM), with a salt of zeros if none is given.
+	if len(salt) == 0 {
+		salt = make([]byte, sha256.Size)
+	}
+	var extract = hmac.New(sha256.New, salt)
+	extract.Write(masterTweak)
+	var prk = extract.Sum(nil)
+
+	// Expand: T(i) = HMAC(PRK, T(i-1) || info || [i]1), the output is T(1) || T(2) || ...
+	var out = make([]byte, 0, length+sha256.Size)
+	var expand = hmac.New(sha256.New, prk)
+	var t []byte
+	for i := 1; len(out) < length; i++ {
+		expand.Reset()
+		expand.Write(t)
+		expand.Write(info)
+		expand.Write([]byte{byte(i)})
+		t = expand.Sum(nil)
+		out = append(out, t...)
+	}
+
+	return out[:length], nil
+}
+
+// RandomTweakFF1 returns a tweak of length bytes read from crypto/rand, for FF1. The length
+// must be in [0..maxTweakLenFF1]. A random tweak makes the encryption non-deterministic, it
+// must be stored with the ciphertext to decrypt it.
+func RandomTweakFF1(length int) ([]byte, error) {
+	if err := validateFF1Tweak(length); err != nil {
+		return nil, err
+	}
+	return randomBytes(length)
+}
+
+// RandomTweakFF3 returns a 8-byte tweak read from crypto/rand, for FF3, as RandomTweakFF1 does.
+func RandomTweakFF3() ([]byte, error) {
+	return randomBytes(tweakLenFF3)
+}
+
+// RandomTweakFF31 returns a 7-byte tweak read from crypto/rand, for FF3-1, as RandomTweakFF1 does.
+func RandomTweakFF31() ([]byte, error) {
+	return randomBytes(tweakLenFF31)
+}
+
+func randomBytes(length int) ([]byte, error) {
+	var out = make([]byte, length)
+	if _, err := rand.Read(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DiversificationCheck is a testing aid, to check that a tweak derivation diversifies the
+// ciphertexts. It takes a FF1, FF3 or FF3-1 BlockMode, tweaks and a numeral string plaintext.
+// It encrypts, or decrypts, plaintext under each tweak and returns the number of results equal
+// to the result of a previous tweak, i.e. len(tweaks) minus the number of distinct results.
+// The tweak of mode is not used nor modified, see CryptBlocksWithTweak. For a domain of
+// radix^n values, about CollisionProbability(radix, n, len(tweaks)) collisions are expected
+// for random tweaks, and duplicate tweaks always collide. It panics if mode is not a FF1, FF3
+// or FF3-1 BlockMode, or as CryptBlocksWithTweak if a tweak or plaintext is not valid.
+func DiversificationCheck(mode cipher.BlockMode, tweaks [][]byte, plaintext []uint16) int {
+	var tweakCrypter, ok = mode.(TweakCrypter)
+	if !ok {
+		panic("DiversificationCheck: mode must be a FF1, FF3 or FF3-1 BlockMode.")
+	}
+
+	var src = NumeralStringToBytes(plaintext)
+	var seen = make(map[string]bool, len(tweaks))
+	var collisions int
+	for _, tweak := range tweaks {
+		var dst = make([]byte, len(src))
+		tweakCrypter.CryptBlocksWithTweak(dst, src, tweak)
+		if seen[string(dst)] {
+			collisions++
+		}
+		seen[string(dst)] = true
+	}
+	return collisions
+}
+
+// TweakFingerprint takes a tweak. It returns a 4-byte fingerprint of the tweak, the first
+// bytes of DeriveTweak("fpe tweak fingerprint", tweak), i.e. of the SHA-256 hash of the
+// length-prefixed tweak, after a length-prefixed label which separates the fingerprints from
+// the derived tweaks. It is stored next to the ciphertexts, so that FF1DecryptVerify detects
+// a wrong tweak instead of returning a wrong plaintext. The tweak is not secret in FPE, but
+// the fingerprint lets anyone test a guess of a tweak: a tweak which must remain secret must
+// not be fingerprinted.
+func TweakFingerprint(tweak []byte) []byte {
+	return DeriveTweak([]byte("fpe tweak fingerprint"), tweak)[:tweakFingerprintLen]
+}
+
+// FF1DecryptVerify is FF1Decrypt, but it first checks that the tweak matches the fingerprint
+// returned by TweakFingerprint for the tweak used to encrypt the data. It returns an error if
+// it does not, e.g. if the tweak does not have the right length. A random wrong tweak goes
+// undetected with probability 2^-32.
+func FF1DecryptVerify(key, tweak []byte, radix uint32, ciphertext []uint16, fingerprint []byte) ([]uint16, error) {
+	if !hmac.Equal(TweakFingerprint(tweak), fingerprint) {
+		return nil, fmt.Errorf("fpe: tweak of %d bytes does not match the fingerprint of the encryption tweak", len(tweak))
+	}
+	return FF1Decrypt(key, tweak, radix, ciphertext)
+}
@@ -0,0 +1,215 @@
+package fpe
+
+import (
+	"crypto/aes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDeriveTweak(t *testing.T) {
+	var base = []byte("base tweak")
+
+	// The derivation is deterministic.
+	var tweak = DeriveTweak(base, []byte("users"), []byte("ccn"))
+	assert.Equal(t, tweak, DeriveTweak(base, []byte("users"), []byte("ccn")))
+	assert.Equal(t, sha256.Size, len(tweak))
+
+	// Different base tweaks or contexts yield different tweaks.
+	var tweaks = [][]byte{
+		tweak,
+		DeriveTweak(base),
+		DeriveTweak(nil, []byte("users"), []byte("ccn")),
+		DeriveTweak(base, []byte("users"), []byte("iban")),
+		DeriveTweak(base, []byte("ccn"), []byte("users")),
+		DeriveTweak(base, []byte("usersccn")),
+		DeriveTweak(base, []byte("user"), []byte("sccn")),
+		DeriveTweak(base, []byte("users"), []byte("ccn"), []byte{}),
+	}
+	for i := range tweaks {
+		for j := i + 1; j < len(tweaks); j++ {
+			assert.NotEqual(t, tweaks[i], tweaks[j])
+		}
+	}
+
+	// The tweak can be used with FF1.
+	var key, _, _ []byte = getRandomParameters(ff1DefaultKeySize, 0, 0)
+	var plaintext = generateRandomNumeralString(10, 16)
+	var ciphertext, err = FF1Encrypt(key, tweak, 10, plaintext)
+	assert.Nil(t, err)
+	var decrypted []uint16
+	decrypted, err = FF1Decrypt(key, DeriveTweak(base, []byte("users"), []byte("ccn")), 10, ciphertext)
+	assert.Nil(t, err)
+	assert.Equal(t, plaintext, decrypted)
+}
+
+func TestDeriveTweakHKDF(t *testing.T) {
+	// Test case 1 of RFC 5869.
+	var ikm, _ = hex.DecodeString("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b")
+	var salt, _ = hex.DecodeString("000102030405060708090a0b0c")
+	var info, _ = hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	var expected, _ = hex.DecodeString("3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865")
+	var tweak, err = DeriveTweakHKDF(ModeFF1, ikm, salt, info, 42)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, tweak)
+
+	// The derivation is deterministic, and the shorter tweaks are prefixes of the longer ones.
+	var master = []byte("master tweak")
+	for _, length := range []int{0, tweakLenFF31, tweakLenFF3, 32, 100, maxHKDFLen} {
+		tweak, err = DeriveTweakHKDF(ModeFF1, master, nil, []byte("record 42"), length)
+		assert.Nil(t, err)
+		assert.Equal(t, length, len(tweak))
+		var again, _ = DeriveTweakHKDF(ModeFF1, master, nil, []byte("record 42"), length)
+		assert.Equal(t, tweak, again)
+		var long, _ = DeriveTweakHKDF(ModeFF1, master, nil, []byte("record 42"), maxHKDFLen)
+		assert.Equal(t, long[:length], tweak)
+	}
+
+	// Different records yield different tweaks, which can be used with FF3-1.
+	var tweak1, _ = DeriveTweakHKDF(ModeFF31, master, nil, []byte("record 1"), tweakLenFF31)
+	var tweak2, _ = DeriveTweakHKDF(ModeFF31, master, nil, []byte("record 2"), tweakLenFF31)
+	assert.NotEqual(t, tweak1, tweak2)
+	var key, _, _ []byte = getRandomParameters(ff3DefaultKeySize, 0, 0)
+	_, err = NewFF31Cipher(key, tweak1, mustNewAlphabet("0123456789"))
+	assert.Nil(t, err)
+
+	// The FF3 tweaks are 8 bytes, and the FF3-1 ones 7 bytes, which the FF1 derivation agrees with.
+	var ff3Tweak []byte
+	ff3Tweak, err = DeriveTweakHKDF(ModeFF3, master, nil, []byte("record 1"), tweakLenFF3)
+	assert.Nil(t, err)
+	_, err = NewFF3Cipher(key, ff3Tweak, mustNewAlphabet("0123456789"))
+	assert.Nil(t, err)
+	var ff1Tweak, _ = DeriveTweakHKDF(ModeFF1, master, nil, []byte("record 1"), tweakLenFF3)
+	assert.Equal(t, ff1Tweak, ff3Tweak)
+
+	// Invalid lengths
+	for _, test := range []struct {
+		mode   Mode
+		length int
+	}{
+		{ModeFF1, -1},
+		{ModeFF1, maxHKDFLen + 1},
+		{ModeFF1, maxTweakLenFF1 + 1},
+		{ModeFF3, tweakLenFF31},
+		{ModeFF3, 0},
+		{ModeFF3, 32},
+		{ModeFF31, tweakLenFF3},
+		{ModeFF31, 0},
+		// Unknown mode
+		{0, tweakLenFF3},
+		{ModeFF31 + 1, tweakLenFF3},
+	} {
+		tweak, err = DeriveTweakHKDF(test.mode, master, nil, nil, test.length)
+		assert.NotNil(t, err)
+		assert.Nil(t, tweak)
+	}
+	var paramErr *ParamError
+	_, err = DeriveTweakHKDF(ModeFF3, master, nil, nil, tweakLenFF31)
+	assert.True(t, errors.As(err, &paramErr))
+	assert.Equal(t, FieldTweak, paramErr.Field)
+}
+
+func TestRandomTweak(t *testing.T) {
+	var key, _, _ []byte = getRandomParameters(ff1DefaultKeySize, 0, 0)
+	var alphabet = mustNewAlphabet("0123456789")
+
+	for _, length := range []int{0, 1, tweakLenFF31, tweakLenFF3, 32, maxTweakLenFF1} {
+		var tweak, err = RandomTweakFF1(length)
+		assert.Nil(t, err)
+		assert.Len(t, tweak, length)
+		_, err = NewFF1Cipher(key, tweak, alphabet)
+		assert.Nil(t, err)
+	}
+	for _, length := range []int{-1, maxTweakLenFF1 + 1} {
+		var tweak, err = RandomTweakFF1(length)
+		assert.NotNil(t, err)
+		assert.Nil(t, tweak)
+	}
+
+	var tweak, err = RandomTweakFF3()
+	assert.Nil(t, err)
+	assert.Len(t, tweak, tweakLenFF3)
+	_, err = NewFF3Cipher(key, tweak, alphabet)
+	assert.Nil(t, err)
+
+	tweak, err = RandomTweakFF31()
+	assert.Nil(t, err)
+	assert.Len(t, tweak, tweakLenFF31)
+	_, err = NewFF31Cipher(key, tweak, alphabet)
+	assert.Nil(t, err)
+
+	// Two calls return different tweaks.
+	var tweak1, _ = RandomTweakFF1(16)
+	var tweak2, _ = RandomTweakFF1(16)
+	assert.NotEqual(t, tweak1, tweak2)
+	tweak1, _ = RandomTweakFF3()
+	tweak2, _ = RandomTweakFF3()
+	assert.NotEqual(t, tweak1, tweak2)
+	tweak1, _ = RandomTweakFF31()
+	tweak2, _ = RandomTweakFF31()
+	assert.NotEqual(t, tweak1, tweak2)
+}
+
+func TestDiversificationCheck(t *testing.T) {
+	var key, _, _ []byte = getRandomParameters(ff1DefaultKeySize, 0, 0)
+	var encrypter, _ = NewFF1EncrypterFromKey(key, nil, 10)
+	var plaintext = generateRandomNumeralString(10, 16)
+
+	// The tweaks derived from distinct record identifiers diversify the ciphertexts.
+	var tweaks [][]byte
+	for i := 0; i < 1000; i++ {
+		tweaks = append(tweaks, DeriveTweak([]byte("base"), []byte{byte(i), byte(i >> 8)}))
+	}
+	assert.Equal(t, 0, DiversificationCheck(encrypter, tweaks, plaintext))
+
+	// A derivation ignoring the record identifier does not.
+	var constant = make([][]byte, 10)
+	for i := range constant {
+		constant[i] = DeriveTweak([]byte("base"))
+	}
+	assert.Equal(t, 9, DiversificationCheck(encrypter, constant, plaintext))
+
+	// With 100 values, 1000 tweaks give at least 900 collisions.
+	assert.True(t, DiversificationCheck(encrypter, tweaks, []uint16{4, 2}) >= 900)
+
+	// FF3-1, whose tweak is 7 bytes.
+	var aesBlock, _ = aes.NewCipher(key)
+	var ff31 = NewFF31Encrypter(aesBlock, make([]byte, tweakLenFF31), 10)
+	var ff31Tweaks [][]byte
+	for _, tweak := range tweaks {
+		ff31Tweaks = append(ff31Tweaks, tweak[:tweakLenFF31])
+	}
+	assert.Equal(t, 0, DiversificationCheck(ff31, ff31Tweaks, plaintext))
+
+	assert.Panics(t, func() { DiversificationCheck(NewCBCWithSetIV(aesBlock, make([]byte, 16)), tweaks, plaintext) })
+	assert.Panics(t, func() { DiversificationCheck(ff31, tweaks, plaintext) })
+}
+
+func TestFF1DecryptVerify(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, 16, 0)
+	var plaintext = generateRandomNumeralString(10, 16)
+	var ciphertext, _ = FF1Encrypt(key, tweak, 10, plaintext)
+	var fingerprint = TweakFingerprint(tweak)
+	assert.Len(t, fingerprint, tweakFingerprintLen)
+	assert.Equal(t, fingerprint, TweakFingerprint(append([]byte(nil), tweak...)))
+
+	var decrypted, err = FF1DecryptVerify(key, tweak, 10, ciphertext, fingerprint)
+	assert.Nil(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	// Wrong tweaks: a truncated one, a longer one, and a modified one.
+	var modified = append([]byte(nil), tweak...)
+	modified[0] ^= 1
+	for _, wrong := range [][]byte{tweak[:15], append(append([]byte(nil), tweak...), 0), modified, nil} {
+		decrypted, err = FF1DecryptVerify(key, wrong, 10, ciphertext, fingerprint)
+		assert.NotNil(t, err)
+		assert.Nil(t, decrypted)
+	}
+
+	// The empty tweak has a fingerprint, distinct from the one of a zero byte.
+	assert.NotEqual(t, TweakFingerprint(nil), TweakFingerprint([]byte{0}))
+	_, err = FF1DecryptVerify(key, nil, 10, ciphertext, fingerprint[:2])
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,121 @@
+package fpe
+
+import (
+	"container/list"
+	"sync"
+)
+
+// TokenVault tokenizes values over an alphabet with FF1. As FF1 is deterministic for a
+// given key and tweak, a value is always mapped to the same token and no mapping has to be
+// stored. The vault may keep the recently seen mappings in memory, which only saves the
+// FF1 computations: the tokens are always the ones FF1Cipher returns. A TokenVault is safe
+// for concurrent use.
+type TokenVault struct {
+	cipher *FF1Cipher
+	// The caches are nil if caching is disabled.
+	tokens *lruCache
+	values *lruCache
+}
+
+// NewTokenVault returns a TokenVault using the given key, tweak and alphabet, as
+// NewFF1Cipher does. If cacheSize > 0, up to cacheSize values and cacheSize tokens are
+// kept in memory, the least recently used being evicted first. If cacheSize <= 0, nothing
+// is cached.
+func NewTokenVault(key, tweak []byte, alphabet *Alphabet, cacheSize int) (*TokenVault, error) {
+	var c, err = NewFF1Cipher(key, tweak, alphabet)
+	if err != nil {
+		return nil, err
+	}
+
+	var v = &TokenVault{cipher: c}
+	if cacheSize > 0 {
+		v.tokens = newLRUCache(cacheSize)
+		v.values = newLRUCache(cacheSize)
+	}
+	return v, nil
+}
+
+// Tokenize takes a value made of symbols of the alphabet and returns its token.
+func (v *TokenVault) Tokenize(value string) (string, error) {
+	return v.lookup(value, v.tokens, v.values, v.cipher.EncryptString)
+}
+
+// Detokenize takes a token returned by Tokenize and returns the original value.
+func (v *TokenVault) Detokenize(token string) (string, error) {
+	return v.lookup(token, v.values, v.tokens, v.cipher.DecryptString)
+}
+
+// lookup returns the image of s from the cache, or computes it with crypt. The result is
+// added to the cache and the reverse mapping to the reverse cache.
+func (v *TokenVault) lookup(s string, cache, reverse *lruCache, crypt func(string) (string, error)) (string, error) {
+	if cache == nil {
+		return crypt(s)
+	}
+	if out, ok := cache.get(s); ok {
+		return out, nil
+	}
+
+	var out, err = crypt(s)
+	if err != nil {
+		return "", err
+	}
+	cache.add(s, out)
+	reverse.add(out, s)
+	return out, nil
+}
+
+// lruCache is a fixed-size map of strings, which evicts the least recently used entry when
+// it is full. It is safe for concurrent use.
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key, value string
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+func (c *lruCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var e, ok = c.entries[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+func (c *lruCache) add(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*lruEntry).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key, value})
+	if c.order.Len() > c.size {
+		var oldest = c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (c *lruCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,113 @@
+package fpe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestTokenVault(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var alphabet, _ = Alphabets("base36")
+
+	var c, err = NewFF1Cipher(key, tweak, alphabet)
+	assert.Nil(t, err)
+
+	var values = make([]string, 50)
+	for i := range values {
+		values[i], _ = alphabet.ToString(generateRandomNumeralString(alphabet.Radix(), 4+i%8))
+	}
+
+	// Without cache, with a cache smaller than the values to force evictions, and with a
+	// cache holding all the values.
+	for _, cacheSize := range []int{0, 7, 100} {
+		var v, err = NewTokenVault(key, tweak, alphabet, cacheSize)
+		assert.Nil(t, err)
+
+		for pass := 0; pass < 3; pass++ {
+			for _, value := range values {
+				var expected, _ = c.EncryptString(value)
+				var token, err = v.Tokenize(value)
+				assert.Nil(t, err)
+				assert.Equal(t, expected, token)
+
+				var detokenized string
+				detokenized, err = v.Detokenize(token)
+				assert.Nil(t, err)
+				assert.Equal(t, value, detokenized)
+			}
+		}
+
+		if cacheSize > 0 {
+			assert.True(t, v.tokens.len() <= cacheSize)
+			assert.True(t, v.values.len() <= cacheSize)
+		}
+	}
+}
+
+func TestTokenVaultErrors(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var alphabet, _ = Alphabets("decimal")
+
+	var _, err = NewTokenVault(key[:10], tweak, alphabet, 10)
+	assert.NotNil(t, err)
+
+	var v *TokenVault
+	v, err = NewTokenVault(key, tweak, alphabet, 10)
+	assert.Nil(t, err)
+
+	// Not in the alphabet, too short
+	for _, s := range []string{"12a4", "1"} {
+		_, err = v.Tokenize(s)
+		assert.NotNil(t, err)
+		_, err = v.Detokenize(s)
+		assert.NotNil(t, err)
+	}
+	// The errors are not cached.
+	assert.Equal(t, 0, v.tokens.len())
+	assert.Equal(t, 0, v.values.len())
+}
+
+func TestTokenVaultConcurrent(t *testing.T) {
+	var key, tweak, _ []byte = getRandomParameters(ff1DefaultKeySize, ff1DefaultTweakSize, 0)
+	var alphabet, _ = Alphabets("decimal")
+	var v, _ = NewTokenVault(key, tweak, alphabet, 5)
+
+	var values = []string{"0123456789", "1111111111", "4111111111111111", "99", "123456"}
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				var value = values[i%len(values)]
+				var token, err = v.Tokenize(value)
+				assert.Nil(t, err)
+				var detokenized string
+				detokenized, err = v.Detokenize(token)
+				assert.Nil(t, err)
+				assert.Equal(t, value, detokenized)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLRUCache(t *testing.T) {
+	var c = newLRUCache(2)
+	c.add("a", "1")
+	c.add("b", "2")
+
+	// "a" becomes the most recently used, so "b" is evicted.
+	var value, ok = c.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", value)
+	c.add("c", "3")
+
+	_, ok = c.get("b")
+	assert.False(t, ok)
+	value, ok = c.get("c")
+	assert.True(t, ok)
+	assert.Equal(t, "3", value)
+	assert.Equal(t, 2, c.len())
+}
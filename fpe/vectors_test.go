@@ -0,0 +1,115 @@
+// Known-answer tests read from testdata/vectors.json, so that interoperability vectors of
+// other implementations can be added without writing Go code. The file holds a JSON array of
+// objects with the fields:
+//   - name: a description of the vector, used in the failure messages,
+//   - mode: "FF1", "FF3" or "FF3-1",
+//   - key and tweak: hex encoded, the FF3 and FF3-1 keys in the byte order of the NIST samples,
+//   - radix: the radix,
+//   - plaintext and ciphertext: the numeral strings, written with the symbols of alphabet,
+//   - alphabet: optional, the symbols 0-9a-z by default, so it must be given for radix > 36.
+package fpe
+
+import (
+	"crypto/cipher"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+const testVectorsFile = "testdata/vectors.json"
+
+type testVector struct {
+	Name       string `json:"name"`
+	Mode       string `json:"mode"`
+	Key        string `json:"key"`
+	Tweak      string `json:"tweak"`
+	Radix      uint32 `json:"radix"`
+	Plaintext  string `json:"plaintext"`
+	Ciphertext string `json:"ciphertext"`
+	Alphabet   string `json:"alphabet,omitempty"`
+}
+
+func TestVectorsFile(t *testing.T) {
+	var vectors, err = loadTestVectors(testVectorsFile)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, vectors)
+
+	for _, vector := range vectors {
+		var msg = fmt.Sprintf("%s (%s)", vector.Name, vector.Mode)
+		var encrypter, decrypter, plaintext, ciphertext, err = vector.decode()
+		if !assert.Nil(t, err, msg) {
+			continue
+		}
+
+		var result []uint16
+		result, err = cryptModeNumerals(encrypter, plaintext)
+		assert.Nil(t, err, msg)
+		assert.Equal(t, ciphertext, result, msg)
+
+		result, err = cryptModeNumerals(decrypter, ciphertext)
+		assert.Nil(t, err, msg)
+		assert.Equal(t, plaintext, result, msg)
+	}
+}
+
+// loadTestVectors reads the test vectors of the JSON file at path.
+func loadTestVectors(path string) ([]testVector, error) {
+	var data, err = os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var vectors []testVector
+	if err = json.Unmarshal(data, &vectors); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return vectors, nil
+}
+
+// decode returns the encrypter and decrypter of the mode of the vector, and its plaintext
+// and ciphertext as numeral strings.
+func (v testVector) decode() (encrypter, decrypter cipher.BlockMode, plaintext, ciphertext []uint16, err error) {
+	var key, tweak []byte
+	if key, err = hex.DecodeString(v.Key); err != nil {
+		return
+	}
+	if tweak, err = hex.DecodeString(v.Tweak); err != nil {
+		return
+	}
+
+	switch v.Mode {
+	case "FF1":
+		encrypter, decrypter, err = newFF1BlockModes(key, tweak, v.Radix)
+	case "FF3":
+		encrypter, decrypter, err = newFF3BlockModes(key, tweak, v.Radix)
+	case "FF3-1":
+		encrypter, decrypter, err = newFF31BlockModes(key, tweak, v.Radix)
+	default:
+		err = fmt.Errorf("unknown mode %q", v.Mode)
+	}
+	if err != nil {
+		return
+	}
+
+	var symbols = v.Alphabet
+	if symbols == "" {
+		const defaultSymbols = "0123456789abcdefghijklmnopqrstuvwxyz"
+		if v.Radix > uint32(len(defaultSymbols)) {
+			err = fmt.Errorf("the alphabet must be given for radix %d", v.Radix)
+			return
+		}
+		symbols = defaultSymbols[:v.Radix]
+	}
+	var alphabet *Alphabet
+	if alphabet, err = NewAlphabet(symbols); err != nil {
+		return
+	}
+	if plaintext, err = alphabet.ToNumerals(v.Plaintext); err != nil {
+		return
+	}
+	ciphertext, err = alphabet.ToNumerals(v.Ciphertext)
+	return
+}